@@ -54,6 +54,12 @@ func (t Tag) GetTag() Tag {
 	return t
 }
 
+// SetTag is the counterpart of GetTag, changing the tag of a message without
+// type asserting.
+func (t *Tag) SetTag(nt Tag) {
+	*t = nt
+}
+
 // Fid is a "file identifier", and is quite similar in concept to a file
 // descriptor, and is used to keep track of a file and its potential opening
 // mode. The client is responsible for providing a unique Fid to use. The Fid
@@ -85,6 +91,21 @@ type Qid struct {
 	Path uint64
 }
 
+// IsDir reports whether the Qid refers to a directory.
+func (q Qid) IsDir() bool { return q.Type&QTDIR != 0 }
+
+// IsAppendOnly reports whether the Qid refers to an append-only file.
+func (q Qid) IsAppendOnly() bool { return q.Type&QTAPPEND != 0 }
+
+// IsExclusive reports whether the Qid refers to an exclusive use file.
+func (q Qid) IsExclusive() bool { return q.Type&QTEXCL != 0 }
+
+// IsAuth reports whether the Qid refers to an authentication file.
+func (q Qid) IsAuth() bool { return q.Type&QTAUTH != 0 }
+
+// IsTemp reports whether the Qid refers to a temporary file.
+func (q Qid) IsTemp() bool { return q.Type&QTTMP != 0 }
+
 func (q *Qid) EncodedSize() int { return 13 }
 
 func (q *Qid) Marshal(b []byte) error {
@@ -146,6 +167,10 @@ func (s *Stat) EncodedSize() int {
 }
 
 func (s *Stat) Marshal(b []byte) error {
+	if s.EncodedSize()-2 > maxStringSize {
+		return ErrDataTooLong
+	}
+
 	binary.LittleEndian.PutUint16(b[2:4], s.Type)
 	binary.LittleEndian.PutUint32(b[4:8], s.Dev)
 
@@ -225,7 +250,7 @@ func (s *Stat) Unmarshal(b []byte) error {
 	// UID
 	l = int(binary.LittleEndian.Uint16(b[idx : idx+2]))
 	t += l
-	if len(b) < t+l {
+	if len(b) < t {
 		return ErrPayloadTooShort
 	}
 	s.UID = string(b[idx+2 : idx+2+l])
@@ -275,6 +300,10 @@ func (vr *VersionRequest) EncodedSize() int {
 }
 
 func (vr *VersionRequest) Marshal(b []byte) error {
+	if err := checkStrings(vr.Version); err != nil {
+		return err
+	}
+
 	binary.LittleEndian.PutUint16(b[0:2], uint16(vr.Tag))
 	binary.LittleEndian.PutUint32(b[2:6], uint32(vr.MessageSize))
 	binary.LittleEndian.PutUint16(b[6:8], uint16(len(vr.Version)))
@@ -321,6 +350,10 @@ type VersionResponse struct {
 func (vr *VersionResponse) EncodedSize() int { return 2 + 4 + 2 + len(vr.Version) }
 
 func (vr *VersionResponse) Marshal(b []byte) error {
+	if err := checkStrings(vr.Version); err != nil {
+		return err
+	}
+
 	binary.LittleEndian.PutUint16(b[0:2], uint16(vr.Tag))
 	binary.LittleEndian.PutUint32(b[2:6], uint32(vr.MessageSize))
 	binary.LittleEndian.PutUint16(b[6:8], uint16(len(vr.Version)))
@@ -371,6 +404,10 @@ func (ar *AuthRequest) EncodedSize() int {
 }
 
 func (ar *AuthRequest) Marshal(b []byte) error {
+	if err := checkStrings(ar.Username, ar.Service); err != nil {
+		return err
+	}
+
 	binary.LittleEndian.PutUint16(b[0:2], uint16(ar.Tag))
 	binary.LittleEndian.PutUint32(b[2:6], uint32(ar.AuthFid))
 
@@ -470,6 +507,10 @@ func (ar *AttachRequest) EncodedSize() int {
 }
 
 func (ar *AttachRequest) Marshal(b []byte) error {
+	if err := checkStrings(ar.Username, ar.Service); err != nil {
+		return err
+	}
+
 	binary.LittleEndian.PutUint16(b[0:2], uint16(ar.Tag))
 	binary.LittleEndian.PutUint32(b[2:6], uint32(ar.Fid))
 	binary.LittleEndian.PutUint32(b[6:10], uint32(ar.AuthFid))
@@ -555,6 +596,10 @@ type ErrorResponse struct {
 func (er *ErrorResponse) EncodedSize() int { return 2 + 2 + len(er.Error) }
 
 func (er *ErrorResponse) Marshal(b []byte) error {
+	if err := checkStrings(er.Error); err != nil {
+		return err
+	}
+
 	binary.LittleEndian.PutUint16(b[0:2], uint16(er.Tag))
 	binary.LittleEndian.PutUint16(b[2:4], uint16(len(er.Error)))
 	copy(b[4:], []byte(er.Error))
@@ -651,6 +696,10 @@ func (wr *WalkRequest) EncodedSize() int {
 }
 
 func (wr *WalkRequest) Marshal(b []byte) error {
+	if err := checkStrings(wr.Names...); err != nil {
+		return err
+	}
+
 	binary.LittleEndian.PutUint16(b[0:2], uint16(wr.Tag))
 	binary.LittleEndian.PutUint32(b[2:6], uint32(wr.Fid))
 	binary.LittleEndian.PutUint32(b[6:10], uint32(wr.NewFid))
@@ -736,6 +785,7 @@ func (wr *WalkResponse) Unmarshal(b []byte) error {
 		wr.Qids[i].Type = QidType(b[idx])
 		wr.Qids[i].Version = binary.LittleEndian.Uint32(b[idx+1 : idx+5])
 		wr.Qids[i].Path = binary.LittleEndian.Uint64(b[idx+5 : idx+13])
+		idx += 13
 	}
 	return nil
 }
@@ -833,6 +883,10 @@ type CreateRequest struct {
 func (cr *CreateRequest) EncodedSize() int { return 2 + 4 + 2 + len(cr.Name) + 4 + 1 }
 
 func (cr *CreateRequest) Marshal(b []byte) error {
+	if err := checkStrings(cr.Name); err != nil {
+		return err
+	}
+
 	binary.LittleEndian.PutUint16(b[0:2], uint16(cr.Tag))
 	binary.LittleEndian.PutUint32(b[2:6], uint32(cr.Fid))
 	binary.LittleEndian.PutUint16(b[6:8], uint16(len(cr.Name)))
@@ -884,7 +938,7 @@ func (cr *CreateResponse) EncodedSize() int { return 2 + 13 + 4 }
 
 func (cr *CreateResponse) Marshal(b []byte) error {
 	binary.LittleEndian.PutUint16(b[0:2], uint16(cr.Tag))
-	b[3] = byte(cr.Qid.Type)
+	b[2] = byte(cr.Qid.Type)
 	binary.LittleEndian.PutUint32(b[3:7], cr.Qid.Version)
 	binary.LittleEndian.PutUint64(b[7:15], cr.Qid.Path)
 	binary.LittleEndian.PutUint32(b[15:19], cr.IOUnit)
@@ -896,7 +950,7 @@ func (cr *CreateResponse) Unmarshal(b []byte) error {
 		return ErrPayloadTooShort
 	}
 	cr.Tag = Tag(binary.LittleEndian.Uint16(b[0:2]))
-	cr.Qid.Type = QidType(b[3])
+	cr.Qid.Type = QidType(b[2])
 	cr.Qid.Version = binary.LittleEndian.Uint32(b[3:7])
 	cr.Qid.Path = binary.LittleEndian.Uint64(b[7:15])
 	cr.IOUnit = binary.LittleEndian.Uint32(b[15:19])
@@ -950,6 +1004,10 @@ type ReadResponse struct {
 func (rr *ReadResponse) EncodedSize() int { return 2 + 4 + len(rr.Data) }
 
 func (rr *ReadResponse) Marshal(b []byte) error {
+	if err := checkData(rr.Data); err != nil {
+		return err
+	}
+
 	binary.LittleEndian.PutUint16(b[0:2], uint16(rr.Tag))
 	binary.LittleEndian.PutUint32(b[2:6], uint32(len(rr.Data)))
 	copy(b[6:], rr.Data)
@@ -962,8 +1020,8 @@ func (rr *ReadResponse) Unmarshal(b []byte) error {
 	}
 
 	rr.Tag = Tag(binary.LittleEndian.Uint16(b[0:2]))
-	l := int(binary.LittleEndian.Uint32(b[2:6]))
-	if len(b) < 2+4+l {
+	l := int64(binary.LittleEndian.Uint32(b[2:6]))
+	if int64(len(b)) < 2+4+l {
 		return ErrPayloadTooShort
 	}
 	rr.Data = make([]byte, l)
@@ -971,6 +1029,21 @@ func (rr *ReadResponse) Unmarshal(b []byte) error {
 	return nil
 }
 
+// unmarshalShared is like Unmarshal, but leaves Data referencing b.
+func (rr *ReadResponse) unmarshalShared(b []byte) error {
+	if len(b) < 2+4 {
+		return ErrPayloadTooShort
+	}
+
+	rr.Tag = Tag(binary.LittleEndian.Uint16(b[0:2]))
+	l := int64(binary.LittleEndian.Uint32(b[2:6]))
+	if int64(len(b)) < 2+4+l {
+		return ErrPayloadTooShort
+	}
+	rr.Data = b[6 : 6+l : 6+l]
+	return nil
+}
+
 // WriteRequest is used to write to an open file.
 type WriteRequest struct {
 	Tag
@@ -990,6 +1063,10 @@ func (wr *WriteRequest) EncodedSize() int {
 }
 
 func (wr *WriteRequest) Marshal(b []byte) error {
+	if err := checkData(wr.Data); err != nil {
+		return err
+	}
+
 	binary.LittleEndian.PutUint16(b[0:2], uint16(wr.Tag))
 	binary.LittleEndian.PutUint32(b[2:6], uint32(wr.Fid))
 	binary.LittleEndian.PutUint64(b[6:14], wr.Offset)
@@ -1008,8 +1085,8 @@ func (wr *WriteRequest) Unmarshal(b []byte) error {
 	wr.Fid = Fid(binary.LittleEndian.Uint32(b[2:6]))
 	wr.Offset = binary.LittleEndian.Uint64(b[6:14])
 
-	l := int(binary.LittleEndian.Uint32(b[14:18]))
-	if len(b) < t+l {
+	l := int64(binary.LittleEndian.Uint32(b[14:18]))
+	if int64(len(b)) < int64(t)+l {
 		return ErrPayloadTooShort
 	}
 
@@ -1164,7 +1241,8 @@ func (sr *StatRequest) Unmarshal(b []byte) error {
 	return nil
 }
 
-// StatResponse contains the Stat struct of a file.
+// StatResponse contains the Stat struct of a file. On the wire, the stat is
+// preceded by a count of its bytes, in addition to its own size field.
 type StatResponse struct {
 	Tag
 
@@ -1188,7 +1266,12 @@ func (sr *StatResponse) Unmarshal(b []byte) error {
 	}
 
 	sr.Tag = Tag(binary.LittleEndian.Uint16(b[0:2]))
-	return sr.Stat.Unmarshal(b[4:])
+	st, err := unmarshalNestedStat(b[2:])
+	if err != nil {
+		return err
+	}
+	sr.Stat = st
+	return nil
 }
 
 // WriteStatRequest attempts to apply a Stat struct to a file. This requires a
@@ -1198,7 +1281,8 @@ func (sr *StatResponse) Unmarshal(b []byte) error {
 // are the maximum unsigned value of their respective types. The write is
 // either completely successful with all changes applied, or failed with no
 // changes applied. The server must not perform a partial application of the
-// Stat structure.
+// Stat structure. As in StatResponse, the stat is preceded by a count of its
+// bytes on the wire.
 type WriteStatRequest struct {
 	Tag
 
@@ -1227,7 +1311,23 @@ func (wsr *WriteStatRequest) Unmarshal(b []byte) error {
 
 	wsr.Tag = Tag(binary.LittleEndian.Uint16(b[0:2]))
 	wsr.Fid = Fid(binary.LittleEndian.Uint32(b[2:6]))
-	return wsr.Stat.Unmarshal(b[8:])
+	st, err := unmarshalNestedStat(b[6:])
+	if err != nil {
+		return err
+	}
+	wsr.Stat = st
+	return nil
+}
+
+// unmarshalNestedStat decodes the n[2] stat[n] form of StatResponse and
+// WriteStatRequest, in which the stat is prefixed by an additional count.
+func unmarshalNestedStat(b []byte) (Stat, error) {
+	n := 2 + int(binary.LittleEndian.Uint16(b[0:2]))
+	if len(b) < n {
+		return Stat{}, ErrPayloadTooShort
+	}
+	s, _, err := UnmarshalStat(b[2:n])
+	return s, err
 }
 
 // WriteStatResponse indicates a successful application of a Stat structure.
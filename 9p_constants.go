@@ -10,6 +10,11 @@ const (
 
 	// WriteOverhead is the total overhead in bytes for a 9P2000 write request.
 	WriteOverhead = HeaderSize + 2 + 4 + 8 + 4
+
+	// IOHeaderSize is the overhead in bytes of both read responses and write
+	// requests, being the larger of ReadOverhead and WriteOverhead. Payloads
+	// of msize minus IOHeaderSize bytes fit in either direction.
+	IOHeaderSize = WriteOverhead
 )
 
 // Version is the 9P2000 version string.
@@ -56,16 +61,21 @@ const (
 	NOFID Fid = 0xFFFFFFFF
 )
 
-// Opening modes.
+// MAXWELEM is the maximum number of path elements in a single walk request.
+const MAXWELEM = 16
+
+// Opening modes. The low two bits hold the access mode, one of OREAD,
+// OWRITE, ORDWR and OEXEC, which may be combined with the OTRUNC, OCEXEC and
+// ORCLOSE flags.
 const (
-	OREAD OpenMode = iota
-	OWRITE
-	ORDWR
-	OEXEC
+	OREAD  OpenMode = 0x00 // Open for reading.
+	OWRITE OpenMode = 0x01 // Open for writing.
+	ORDWR  OpenMode = 0x02 // Open for reading and writing.
+	OEXEC  OpenMode = 0x03 // Open for executing, which implies reading.
 
-	OTRUNC OpenMode = 16 * (iota + 1)
-	OCEXEC
-	ORCLOSE
+	OTRUNC  OpenMode = 0x10 // Truncate the file.
+	OCEXEC  OpenMode = 0x20 // Close the file on exec.
+	ORCLOSE OpenMode = 0x40 // Remove the file on clunk.
 )
 
 // Permission bits.
@@ -2,11 +2,15 @@ package qp
 
 import (
 	"bytes"
+	"encoding/hex"
+	"io/ioutil"
 	"reflect"
+	"strings"
 	"testing"
 )
 
 type Marshallable interface {
+	EncodedSize() int
 	Marshal(b []byte) error
 	Unmarshal(b []byte) error
 }
@@ -26,6 +30,8 @@ type MessageTestEntry struct {
 var (
 	_ Marshallable = (*Qid)(nil)
 	_ Marshallable = (*Stat)(nil)
+	_ Message      = (*RawMessage)(nil)
+	_ Message      = (*StreamingReadResponse)(nil)
 	_ Message      = (*VersionRequest)(nil)
 	_ Message      = (*VersionResponse)(nil)
 	_ Message      = (*AuthRequest)(nil)
@@ -68,7 +74,7 @@ var PrimitiveTestData = []PrimitiveTestEntry{
 			Type:   0xDEAD,
 			Dev:    0xABCDEF08,
 			Qid:    Qid{},
-			Mode:   FileMode(OTRUNC),
+			Mode:   0x50,
 			Atime:  90870987,
 			Mtime:  1234124,
 			Length: 0x23ABDDF8,
@@ -314,7 +320,8 @@ func reencode(i int, in Marshallable, reference []byte, t *testing.T, p Protocol
 		err error
 	)
 
-	if s, err = in.MarshalBinary(); err != nil {
+	s = make([]byte, in.EncodedSize())
+	if err = in.Marshal(s); err != nil {
 		t.Errorf("test %d: encoding failed for %T: %v", i, in, err)
 		return
 	}
@@ -324,7 +331,7 @@ func reencode(i int, in Marshallable, reference []byte, t *testing.T, p Protocol
 	}
 	// Magic to construct a new codec of the input type
 	other := ConstructNewMarshallable(in)
-	if err = other.UnmarshalBinary(s); err != nil {
+	if err = other.Unmarshal(s); err != nil {
 		t.Errorf("test %d: decoding failed for %T: %v", i, in, err)
 		return
 	}
@@ -341,13 +348,14 @@ func testUnmarshal(t *testing.T, i int, r Marshallable, x []byte) {
 			t.Errorf("test %d: short unmarshal for %T at length %d panicked: %v", i, r, len(x), rr)
 		}
 	}()
-	var err error
-	for len(x) > 0 {
-		err = r.UnmarshalBinary(x)
-		if err != ErrPayloadTooShort {
+	for {
+		if err := r.Unmarshal(x); err != ErrPayloadTooShort {
 			t.Errorf("test %d: short unmarshal for %T at length %d did not fail as expected: %v", i, r, len(x), err)
 			return
 		}
+		if len(x) == 0 {
+			return
+		}
 		x = x[:len(x)-1]
 	}
 }
@@ -375,3 +383,234 @@ func TestReencode(t *testing.T) {
 		reencode(i, tt.input, tt.reference, t, NineP2000)
 	}
 }
+
+// TestQidPredicates sets each Qid type bit, round-trips the Qid, and checks
+// that only the matching predicate reports true.
+func TestQidPredicates(t *testing.T) {
+	tests := []struct {
+		typ  QidType
+		dir  bool
+		app  bool
+		excl bool
+		auth bool
+		tmp  bool
+	}{
+		{QTFILE, false, false, false, false, false},
+		{QTDIR, true, false, false, false, false},
+		{QTAPPEND, false, true, false, false, false},
+		{QTEXCL, false, false, true, false, false},
+		{QTAUTH, false, false, false, true, false},
+		{QTTMP, false, false, false, false, true},
+		{QTDIR | QTTMP, true, false, false, false, true},
+	}
+
+	for i, tt := range tests {
+		in := Qid{Type: tt.typ, Version: 1, Path: 2}
+		b := make([]byte, in.EncodedSize())
+		in.Marshal(b)
+		var q Qid
+		if err := q.Unmarshal(b); err != nil {
+			t.Fatalf("test %d: unmarshal failed: %v", i, err)
+		}
+
+		if q.IsDir() != tt.dir {
+			t.Errorf("test %d: IsDir() = %t, expected %t", i, q.IsDir(), tt.dir)
+		}
+		if q.IsAppendOnly() != tt.app {
+			t.Errorf("test %d: IsAppendOnly() = %t, expected %t", i, q.IsAppendOnly(), tt.app)
+		}
+		if q.IsExclusive() != tt.excl {
+			t.Errorf("test %d: IsExclusive() = %t, expected %t", i, q.IsExclusive(), tt.excl)
+		}
+		if q.IsAuth() != tt.auth {
+			t.Errorf("test %d: IsAuth() = %t, expected %t", i, q.IsAuth(), tt.auth)
+		}
+		if q.IsTemp() != tt.tmp {
+			t.Errorf("test %d: IsTemp() = %t, expected %t", i, q.IsTemp(), tt.tmp)
+		}
+	}
+}
+
+// TestMarshalDirtyBuffer marshals into buffers filled with garbage, verifying
+// that messages overwrite every byte of their encoded form, as required for
+// buffer reuse.
+func TestMarshalDirtyBuffer(t *testing.T) {
+	tables := [][]MessageTestEntry{MessageTestData, MessageTestDataDotu, MessageTestDataDote, MessageTestDataDotl}
+	for _, table := range tables {
+		for i, tt := range table {
+			b := bytes.Repeat([]byte{0xFF}, tt.input.EncodedSize())
+			if err := tt.input.Marshal(b); err != nil {
+				t.Fatalf("test %d: marshal failed: %v", i, err)
+			}
+			if !bytes.Equal(b, tt.reference) {
+				t.Errorf("test %d: %T did not overwrite buffer.\n\tExpected: %#v\n\tGot:      %#v", i, tt.input, tt.reference, b)
+			}
+		}
+	}
+}
+
+func TestEmptyFields(t *testing.T) {
+	// Nil and empty fields encode identically, and decode to empty values
+	// that re-encode to the same bytes.
+	tests := []struct {
+		nil, empty Message
+		decoded    Marshallable
+	}{
+		{&WriteRequest{Tag: 1, Fid: 2}, &WriteRequest{Tag: 1, Fid: 2, Data: []byte{}}, &WriteRequest{}},
+		{&ReadResponse{Tag: 1}, &ReadResponse{Tag: 1, Data: []byte{}}, &ReadResponse{}},
+		{&WalkRequest{Tag: 1, Fid: 2, NewFid: 3}, &WalkRequest{Tag: 1, Fid: 2, NewFid: 3, Names: []string{}}, &WalkRequest{}},
+		{&WalkResponse{Tag: 1}, &WalkResponse{Tag: 1, Qids: []Qid{}}, &WalkResponse{}},
+		{&ErrorResponse{Tag: 1}, &ErrorResponse{Tag: 1, Error: ""}, &ErrorResponse{}},
+		{&StatResponse{Tag: 1}, &StatResponse{Tag: 1, Stat: Stat{}}, &StatResponse{}},
+	}
+
+	for i, tt := range tests {
+		a := make([]byte, tt.nil.EncodedSize())
+		b := make([]byte, tt.empty.EncodedSize())
+		if err := tt.nil.Marshal(a); err != nil {
+			t.Fatalf("test %d: marshal failed: %v", i, err)
+		}
+		if err := tt.empty.Marshal(b); err != nil {
+			t.Fatalf("test %d: marshal failed: %v", i, err)
+		}
+		if !bytes.Equal(a, b) {
+			t.Errorf("test %d: nil and empty %T encode differently.\n\tNil:   %#v\n\tEmpty: %#v", i, tt.nil, a, b)
+		}
+
+		if err := tt.decoded.Unmarshal(a); err != nil {
+			t.Fatalf("test %d: unmarshal failed: %v", i, err)
+		}
+		c := make([]byte, tt.decoded.EncodedSize())
+		if err := tt.decoded.Marshal(c); err != nil {
+			t.Fatalf("test %d: marshal failed: %v", i, err)
+		}
+		if !bytes.Equal(a, c) {
+			t.Errorf("test %d: re-encoding of empty %T not stable.\n\tExpected: %#v\n\tGot:      %#v", i, tt.nil, a, c)
+		}
+	}
+
+	// A walk without names clones the fid.
+	var wr WalkRequest
+	if err := wr.Unmarshal([]byte{1, 0, 2, 0, 0, 0, 3, 0, 0, 0, 0, 0}); err != nil {
+		t.Fatalf("unmarshal failed: %v", err)
+	}
+	if wr.Fid != 2 || wr.NewFid != 3 || len(wr.Names) != 0 {
+		t.Errorf("got %v, expected a clone of fid 2 to 3", &wr)
+	}
+}
+
+// TestUnmarshalHugeCount checks that data counts beyond the range of a 32-bit
+// int are rejected rather than wrapping around.
+func TestUnmarshalHugeCount(t *testing.T) {
+	tests := []struct {
+		m Marshallable
+		b []byte
+	}{
+		{&ReadResponse{}, []byte{1, 0, 0xFF, 0xFF, 0xFF, 0xFF, 0}},
+		{&WriteRequest{}, []byte{1, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0xFF, 0xFF, 0xFF, 0xFF, 0}},
+		{&SimpleReadResponseDote{}, []byte{1, 0, 0xFF, 0xFF, 0xFF, 0xFF, 0}},
+		{&SimpleWriteRequestDote{}, []byte{1, 0, 0, 0, 0, 0, 0, 0, 0xFF, 0xFF, 0xFF, 0xFF, 0}},
+		{&ReadDirResponseDotl{}, []byte{1, 0, 0xFF, 0xFF, 0xFF, 0xFF, 0}},
+	}
+	for i, tt := range tests {
+		testUnmarshal(t, i, tt.m, tt.b)
+	}
+}
+
+func TestMarshalTooLong(t *testing.T) {
+	name := strings.Repeat("a", maxStringSize)
+
+	wr := &WalkRequest{Tag: 1, Fid: 2, NewFid: 3, Names: []string{"usr", name}}
+	b := make([]byte, wr.EncodedSize())
+	if err := wr.Marshal(b); err != nil {
+		t.Errorf("walk with name of %d bytes failed: %v", len(name), err)
+	}
+
+	wr.Names[1] += "a"
+	b = make([]byte, wr.EncodedSize())
+	if err := wr.Marshal(b); err != ErrStringTooLong {
+		t.Errorf("walk with name of %d bytes: expected %v, got %v", len(wr.Names[1]), ErrStringTooLong, err)
+	}
+	if err := NewEncoder(NineP2000, ioutil.Discard).WriteMessage(wr); err != ErrStringTooLong {
+		t.Errorf("encoding walk with long name: expected %v, got %v", ErrStringTooLong, err)
+	}
+
+	// A stat must fit in its own 16-bit size field.
+	sr := &StatResponse{Stat: Stat{Name: name[:maxStringSize-100], UID: name[:100]}}
+	b = make([]byte, sr.EncodedSize())
+	if err := sr.Marshal(b); err != ErrDataTooLong {
+		t.Errorf("oversized stat: expected %v, got %v", ErrDataTooLong, err)
+	}
+
+	// Data fields at the edge of their 32-bit count, which cannot be
+	// allocated in a test.
+	if err := checkDataSize(maxDataSize); err != nil {
+		t.Errorf("data of %d bytes failed: %v", uint64(maxDataSize), err)
+	}
+	if err := checkDataSize(maxDataSize + 1); err != ErrDataTooLong {
+		t.Errorf("data of %d bytes: expected %v, got %v", uint64(maxDataSize)+1, ErrDataTooLong, err)
+	}
+}
+
+// TestWireFormat checks messages against byte-exact encodings written out
+// field by field from the 9P2000 manual, independently of the test tables, to
+// lock down the byte order and field offsets.
+func TestWireFormat(t *testing.T) {
+	tests := []struct {
+		name     string
+		wire     string
+		expected Message
+	}{
+		{
+			"Tversion",
+			"13000000 64 ffff 00200000 0600 395032303030",
+			&VersionRequest{Tag: NOTAG, MessageSize: 8192, Version: "9P2000"},
+		},
+		{
+			"Rread",
+			"10000000 75 0100 05000000 68656c6c6f",
+			&ReadResponse{Tag: 1, Data: []byte("hello")},
+		},
+		{
+			"Rstat",
+			"4e000000 7d 0200 4500 " +
+				"4300 0000 00000000 00 03000000 2a00000000000000 a4010000 00ca9a3b 01ca9a3b 0c00000000000000 " +
+				"0500 68656c6c6f 0600 676c656e6461 0300 737973 0600 676c656e6461",
+			&StatResponse{Tag: 2, Stat: Stat{
+				Qid:    Qid{Type: QTFILE, Version: 3, Path: 0x2a},
+				Mode:   0644,
+				Atime:  1000000000,
+				Mtime:  1000000001,
+				Length: 12,
+				Name:   "hello",
+				UID:    "glenda",
+				GID:    "sys",
+				MUID:   "glenda",
+			}},
+		},
+	}
+
+	for _, tt := range tests {
+		wire, err := hex.DecodeString(strings.Replace(tt.wire, " ", "", -1))
+		if err != nil {
+			t.Fatalf("%s: invalid capture: %v", tt.name, err)
+		}
+
+		d := &Decoder{Protocol: NineP2000, Reader: bytes.NewReader(wire), Strict: true}
+		m, err := d.ReadMessage()
+		if err != nil {
+			t.Errorf("%s: decode failed: %v", tt.name, err)
+		} else if !MessagesEqual(m, tt.expected) {
+			t.Errorf("%s: decoded %v, expected %v", tt.name, m, tt.expected)
+		}
+
+		var buf bytes.Buffer
+		if err := NewEncoder(NineP2000, &buf).WriteMessage(tt.expected); err != nil {
+			t.Errorf("%s: encode failed: %v", tt.name, err)
+			continue
+		}
+		if !bytes.Equal(buf.Bytes(), wire) {
+			t.Errorf("%s: encoded\n\t%x\nexpected\n\t%x", tt.name, buf.Bytes(), wire)
+		}
+	}
+}
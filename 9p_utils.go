@@ -2,8 +2,49 @@ package qp
 
 import "errors"
 
-// ErrUnknownMessageType is used to indicate an unknown type of message.
-var ErrUnknownMessageType = errors.New("unknown message type")
+var (
+	// ErrUnknownMessageType is used to indicate an unknown type of message.
+	ErrUnknownMessageType = errors.New("unknown message type")
+
+	// ErrStringTooLong indicates that a string field is longer than its 16-bit
+	// length prefix can describe.
+	ErrStringTooLong = errors.New("string too long")
+
+	// ErrDataTooLong indicates that a data field is longer than its 32-bit
+	// length prefix can describe, or that a stat is larger than its 16-bit
+	// size prefix can describe.
+	ErrDataTooLong = errors.New("data too long")
+)
+
+// maxStringSize is the largest string a 9P string field can hold.
+const maxStringSize = 1<<16 - 1
+
+// maxDataSize is the largest data field a 9P data field can hold.
+const maxDataSize = 1<<32 - 1
+
+// checkStrings returns ErrStringTooLong if any of ss is too long to encode.
+func checkStrings(ss ...string) error {
+	for _, s := range ss {
+		if len(s) > maxStringSize {
+			return ErrStringTooLong
+		}
+	}
+	return nil
+}
+
+// checkData returns ErrDataTooLong if d is too long to encode.
+func checkData(d []byte) error {
+	return checkDataSize(uint64(len(d)))
+}
+
+// checkDataSize returns ErrDataTooLong if a data field of n bytes is too long
+// to encode.
+func checkDataSize(n uint64) error {
+	if n > maxDataSize {
+		return ErrDataTooLong
+	}
+	return nil
+}
 
 // nineP2000 implements the conversions for 9P2000.
 type nineP2000 struct{}
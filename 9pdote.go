@@ -90,6 +90,10 @@ func (srr *SimpleReadRequestDote) EncodedSize() int {
 }
 
 func (srr *SimpleReadRequestDote) Marshal(b []byte) error {
+	if err := checkStrings(srr.Names...); err != nil {
+		return err
+	}
+
 	binary.LittleEndian.PutUint16(b[0:2], uint16(srr.Tag))
 	binary.LittleEndian.PutUint32(b[2:6], uint32(srr.Fid))
 	binary.LittleEndian.PutUint16(b[6:8], uint16(len(srr.Names)))
@@ -140,6 +144,10 @@ func (srr *SimpleReadResponseDote) EncodedSize() int {
 }
 
 func (srr *SimpleReadResponseDote) Marshal(b []byte) error {
+	if err := checkData(srr.Data); err != nil {
+		return err
+	}
+
 	binary.LittleEndian.PutUint16(b[0:2], uint16(srr.Tag))
 	binary.LittleEndian.PutUint32(b[2:6], uint32(len(srr.Data)))
 	copy(b[6:], srr.Data)
@@ -152,8 +160,8 @@ func (srr *SimpleReadResponseDote) Unmarshal(b []byte) error {
 	}
 
 	srr.Tag = Tag(binary.LittleEndian.Uint16(b[0:2]))
-	l := int(binary.LittleEndian.Uint32(b[2:6]))
-	if len(b) < 2+4+l {
+	l := int64(binary.LittleEndian.Uint32(b[2:6]))
+	if int64(len(b)) < 2+4+l {
 		return ErrPayloadTooShort
 	}
 	srr.Data = make([]byte, l)
@@ -187,6 +195,13 @@ func (swr *SimpleWriteRequestDote) EncodedSize() int {
 }
 
 func (swr *SimpleWriteRequestDote) Marshal(b []byte) error {
+	if err := checkStrings(swr.Names...); err != nil {
+		return err
+	}
+	if err := checkData(swr.Data); err != nil {
+		return err
+	}
+
 	binary.LittleEndian.PutUint16(b[0:2], uint16(swr.Tag))
 	binary.LittleEndian.PutUint32(b[2:6], uint32(swr.Fid))
 	binary.LittleEndian.PutUint16(b[6:8], uint16(len(swr.Names)))
@@ -224,12 +239,12 @@ func (swr *SimpleWriteRequestDote) Unmarshal(b []byte) error {
 		idx += 2 + l
 		t += 2 + l
 	}
-	l = int(binary.LittleEndian.Uint32(b[idx : idx+4]))
-	if len(b) < t+l {
+	dl := int64(binary.LittleEndian.Uint32(b[idx : idx+4]))
+	if int64(len(b)) < int64(t)+dl {
 		return ErrPayloadTooShort
 	}
-	swr.Data = make([]byte, l)
-	copy(swr.Data, b[idx+4:idx+4+l])
+	swr.Data = make([]byte, dl)
+	copy(swr.Data, b[idx+4:])
 	return nil
 }
 
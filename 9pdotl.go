@@ -0,0 +1,933 @@
+package qp
+
+import "encoding/binary"
+
+// NineP2000Dotl implements 9P2000.L encoding and decoding. 9P2000.L is meant
+// to expose the Linux VFS more directly than 9P2000.u does, and is the dialect
+// spoken by the Linux v9fs client and servers such as diod. It replaces open,
+// create, stat and wstat with Linux-style equivalents, numeric error codes and
+// user IDs, and directory reads that return packed directory entries rather
+// than stat structures.
+//
+// Message types
+//
+// 9P2000.L replaces the following messages:
+// 	AuthRequestDotu:     size[4] Tauth tag[2] afid[4] uname[s] aname[s] n_uname[4]
+// 	AttachRequestDotu:   size[4] Tattach tag[2] fid[4] afid[4] uname[s] aname[s] n_uname[4]
+//
+// 9P2000.L adds the following messages:
+// 	ErrorResponseDotl:    size[4] Rlerror tag[2] ecode[4]
+// 	StatfsRequestDotl:    size[4] Tstatfs tag[2] fid[4]
+// 	StatfsResponseDotl:   size[4] Rstatfs tag[2] type[4] bsize[4] blocks[8] bfree[8] bavail[8]
+// 	                          files[8] ffree[8] fsid[8] namelen[4]
+// 	OpenRequestDotl:      size[4] Tlopen tag[2] fid[4] flags[4]
+// 	OpenResponseDotl:     size[4] Rlopen tag[2] qid[13] iounit[4]
+// 	CreateRequestDotl:    size[4] Tlcreate tag[2] fid[4] name[s] flags[4] mode[4] gid[4]
+// 	CreateResponseDotl:   size[4] Rlcreate tag[2] qid[13] iounit[4]
+// 	RenameRequestDotl:    size[4] Trename tag[2] fid[4] dfid[4] name[s]
+// 	RenameResponseDotl:   size[4] Rrename tag[2]
+// 	ReadLinkRequestDotl:  size[4] Treadlink tag[2] fid[4]
+// 	ReadLinkResponseDotl: size[4] Rreadlink tag[2] target[s]
+// 	GetAttrRequestDotl:   size[4] Tgetattr tag[2] fid[4] request_mask[8]
+// 	GetAttrResponseDotl:  size[4] Rgetattr tag[2] valid[8] qid[13] mode[4] uid[4] gid[4] nlink[8]
+// 	                          rdev[8] size[8] blksize[8] blocks[8] atime_sec[8] atime_nsec[8]
+// 	                          mtime_sec[8] mtime_nsec[8] ctime_sec[8] ctime_nsec[8]
+// 	                          btime_sec[8] btime_nsec[8] gen[8] data_version[8]
+// 	SetAttrRequestDotl:   size[4] Tsetattr tag[2] fid[4] valid[4] mode[4] uid[4] gid[4] size[8]
+// 	                          atime_sec[8] atime_nsec[8] mtime_sec[8] mtime_nsec[8]
+// 	SetAttrResponseDotl:  size[4] Rsetattr tag[2]
+// 	ReadDirRequestDotl:   size[4] Treaddir tag[2] fid[4] offset[8] count[4]
+// 	ReadDirResponseDotl:  size[4] Rreaddir tag[2] count[4] data[count]
+// 	MkdirRequestDotl:     size[4] Tmkdir tag[2] dfid[4] name[s] mode[4] gid[4]
+// 	MkdirResponseDotl:    size[4] Rmkdir tag[2] qid[13]
+//
+// Support structures
+//
+// 9P2000.L adds the following supporting structures:
+//    DirEntryDotl: qid[13] offset[8] type[1] name[s]
+var NineP2000Dotl = nineP2000Dotl{}
+
+// DirEntryDotl is a directory entry as returned by ReadDirResponseDotl.
+type DirEntryDotl struct {
+	// Qid is the Qid of the file.
+	Qid Qid
+
+	// Offset is the offset to pass in a ReadDirRequestDotl to continue
+	// reading after this entry.
+	Offset uint64
+
+	// Type is the file type, as used in the d_type field of a Linux dirent.
+	Type uint8
+
+	// Name is the name of the file.
+	Name string
+}
+
+func (de *DirEntryDotl) EncodedSize() int { return 13 + 8 + 1 + 2 + len(de.Name) }
+
+func (de *DirEntryDotl) Marshal(b []byte) error {
+	if err := checkStrings(de.Name); err != nil {
+		return err
+	}
+
+	b[0] = byte(de.Qid.Type)
+	binary.LittleEndian.PutUint32(b[1:5], de.Qid.Version)
+	binary.LittleEndian.PutUint64(b[5:13], de.Qid.Path)
+	binary.LittleEndian.PutUint64(b[13:21], de.Offset)
+	b[21] = de.Type
+	binary.LittleEndian.PutUint16(b[22:24], uint16(len(de.Name)))
+	copy(b[24:], []byte(de.Name))
+	return nil
+}
+
+func (de *DirEntryDotl) Unmarshal(b []byte) error {
+	t := 13 + 8 + 1 + 2
+	if len(b) < t {
+		return ErrPayloadTooShort
+	}
+	de.Qid.Type = QidType(b[0])
+	de.Qid.Version = binary.LittleEndian.Uint32(b[1:5])
+	de.Qid.Path = binary.LittleEndian.Uint64(b[5:13])
+	de.Offset = binary.LittleEndian.Uint64(b[13:21])
+	de.Type = b[21]
+
+	l := int(binary.LittleEndian.Uint16(b[22:24]))
+	t += l
+	if len(b) < t {
+		return ErrPayloadTooShort
+	}
+	de.Name = string(b[24 : 24+l])
+	return nil
+}
+
+// ErrorResponseDotl is used to report an error with a request. Unlike
+// ErrorResponse, it only carries a Linux errno value.
+type ErrorResponseDotl struct {
+	Tag
+
+	// Errno is the error code. This field is called "ecode" in the official
+	// implementation.
+	Errno uint32
+}
+
+func (er *ErrorResponseDotl) EncodedSize() int { return 2 + 4 }
+
+func (er *ErrorResponseDotl) Marshal(b []byte) error {
+	binary.LittleEndian.PutUint16(b[0:2], uint16(er.Tag))
+	binary.LittleEndian.PutUint32(b[2:6], er.Errno)
+	return nil
+}
+
+func (er *ErrorResponseDotl) Unmarshal(b []byte) error {
+	if len(b) < 2+4 {
+		return ErrPayloadTooShort
+	}
+	er.Tag = Tag(binary.LittleEndian.Uint16(b[0:2]))
+	er.Errno = binary.LittleEndian.Uint32(b[2:6])
+	return nil
+}
+
+// StatfsRequestDotl is used to retrieve file system information.
+type StatfsRequestDotl struct {
+	Tag
+
+	// Fid is a fid on the file system to retrieve information about.
+	Fid Fid
+}
+
+func (sr *StatfsRequestDotl) EncodedSize() int { return 2 + 4 }
+
+func (sr *StatfsRequestDotl) Marshal(b []byte) error {
+	binary.LittleEndian.PutUint16(b[0:2], uint16(sr.Tag))
+	binary.LittleEndian.PutUint32(b[2:6], uint32(sr.Fid))
+	return nil
+}
+
+func (sr *StatfsRequestDotl) Unmarshal(b []byte) error {
+	if len(b) < 2+4 {
+		return ErrPayloadTooShort
+	}
+	sr.Tag = Tag(binary.LittleEndian.Uint16(b[0:2]))
+	sr.Fid = Fid(binary.LittleEndian.Uint32(b[2:6]))
+	return nil
+}
+
+// StatfsResponseDotl contains file system information, mirroring the Linux
+// statfs structure.
+type StatfsResponseDotl struct {
+	Tag
+
+	// Type is the file system type.
+	Type uint32
+
+	// BlockSize is the optimal transfer block size.
+	BlockSize uint32
+
+	// Blocks is the total number of blocks in the file system.
+	Blocks uint64
+
+	// BlocksFree is the number of free blocks.
+	BlocksFree uint64
+
+	// BlocksAvailable is the number of blocks available to unprivileged
+	// users.
+	BlocksAvailable uint64
+
+	// Files is the total number of file nodes in the file system.
+	Files uint64
+
+	// FilesFree is the number of free file nodes.
+	FilesFree uint64
+
+	// FSID is the file system ID.
+	FSID uint64
+
+	// NameLength is the maximum length of file names.
+	NameLength uint32
+}
+
+func (sr *StatfsResponseDotl) EncodedSize() int { return 2 + 4 + 4 + 8*6 + 4 }
+
+func (sr *StatfsResponseDotl) Marshal(b []byte) error {
+	binary.LittleEndian.PutUint16(b[0:2], uint16(sr.Tag))
+	binary.LittleEndian.PutUint32(b[2:6], sr.Type)
+	binary.LittleEndian.PutUint32(b[6:10], sr.BlockSize)
+	binary.LittleEndian.PutUint64(b[10:18], sr.Blocks)
+	binary.LittleEndian.PutUint64(b[18:26], sr.BlocksFree)
+	binary.LittleEndian.PutUint64(b[26:34], sr.BlocksAvailable)
+	binary.LittleEndian.PutUint64(b[34:42], sr.Files)
+	binary.LittleEndian.PutUint64(b[42:50], sr.FilesFree)
+	binary.LittleEndian.PutUint64(b[50:58], sr.FSID)
+	binary.LittleEndian.PutUint32(b[58:62], sr.NameLength)
+	return nil
+}
+
+func (sr *StatfsResponseDotl) Unmarshal(b []byte) error {
+	if len(b) < 2+4+4+8*6+4 {
+		return ErrPayloadTooShort
+	}
+	sr.Tag = Tag(binary.LittleEndian.Uint16(b[0:2]))
+	sr.Type = binary.LittleEndian.Uint32(b[2:6])
+	sr.BlockSize = binary.LittleEndian.Uint32(b[6:10])
+	sr.Blocks = binary.LittleEndian.Uint64(b[10:18])
+	sr.BlocksFree = binary.LittleEndian.Uint64(b[18:26])
+	sr.BlocksAvailable = binary.LittleEndian.Uint64(b[26:34])
+	sr.Files = binary.LittleEndian.Uint64(b[34:42])
+	sr.FilesFree = binary.LittleEndian.Uint64(b[42:50])
+	sr.FSID = binary.LittleEndian.Uint64(b[50:58])
+	sr.NameLength = binary.LittleEndian.Uint32(b[58:62])
+	return nil
+}
+
+// OpenRequestDotl is used to open a fid using Linux open flags.
+type OpenRequestDotl struct {
+	Tag
+
+	// Fid is the file to open.
+	Fid Fid
+
+	// Flags are the Linux open flags to open the file with.
+	Flags uint32
+}
+
+func (or *OpenRequestDotl) EncodedSize() int { return 2 + 4 + 4 }
+
+func (or *OpenRequestDotl) Marshal(b []byte) error {
+	binary.LittleEndian.PutUint16(b[0:2], uint16(or.Tag))
+	binary.LittleEndian.PutUint32(b[2:6], uint32(or.Fid))
+	binary.LittleEndian.PutUint32(b[6:10], or.Flags)
+	return nil
+}
+
+func (or *OpenRequestDotl) Unmarshal(b []byte) error {
+	if len(b) < 2+4+4 {
+		return ErrPayloadTooShort
+	}
+	or.Tag = Tag(binary.LittleEndian.Uint16(b[0:2]))
+	or.Fid = Fid(binary.LittleEndian.Uint32(b[2:6]))
+	or.Flags = binary.LittleEndian.Uint32(b[6:10])
+	return nil
+}
+
+// OpenResponseDotl returns the qid and iounit of the opened file, exactly like
+// OpenResponse.
+type OpenResponseDotl struct {
+	Tag
+
+	// Qid is the qid of the opened file.
+	Qid Qid
+
+	// IOUnit is the maximum amount of data that can be read/written by a single
+	// call, or 0 for no specification.
+	IOUnit uint32
+}
+
+func (or *OpenResponseDotl) EncodedSize() int { return 2 + 13 + 4 }
+
+func (or *OpenResponseDotl) Marshal(b []byte) error {
+	binary.LittleEndian.PutUint16(b[0:2], uint16(or.Tag))
+	b[2] = byte(or.Qid.Type)
+	binary.LittleEndian.PutUint32(b[3:7], or.Qid.Version)
+	binary.LittleEndian.PutUint64(b[7:15], or.Qid.Path)
+	binary.LittleEndian.PutUint32(b[15:19], or.IOUnit)
+	return nil
+}
+
+func (or *OpenResponseDotl) Unmarshal(b []byte) error {
+	if len(b) < 2+13+4 {
+		return ErrPayloadTooShort
+	}
+	or.Tag = Tag(binary.LittleEndian.Uint16(b[0:2]))
+	or.Qid.Type = QidType(b[2])
+	or.Qid.Version = binary.LittleEndian.Uint32(b[3:7])
+	or.Qid.Path = binary.LittleEndian.Uint64(b[7:15])
+	or.IOUnit = binary.LittleEndian.Uint32(b[15:19])
+	return nil
+}
+
+// CreateRequestDotl is used to create and open a regular file using Linux open
+// flags and permissions. Upon success, Fid changes to the opened file.
+type CreateRequestDotl struct {
+	Tag
+
+	// Fid is the fid of the directory where the file should be created.
+	Fid Fid
+
+	// Name is the name of the file to create.
+	Name string
+
+	// Flags are the Linux open flags to open the file with.
+	Flags uint32
+
+	// Mode is the Linux permissions of the file to create.
+	Mode uint32
+
+	// GID is the numeric group ID of the file to create.
+	GID uint32
+}
+
+func (cr *CreateRequestDotl) EncodedSize() int { return 2 + 4 + 2 + len(cr.Name) + 4 + 4 + 4 }
+
+func (cr *CreateRequestDotl) Marshal(b []byte) error {
+	if err := checkStrings(cr.Name); err != nil {
+		return err
+	}
+
+	binary.LittleEndian.PutUint16(b[0:2], uint16(cr.Tag))
+	binary.LittleEndian.PutUint32(b[2:6], uint32(cr.Fid))
+	binary.LittleEndian.PutUint16(b[6:8], uint16(len(cr.Name)))
+
+	idx := 8
+	copy(b[idx:idx+len(cr.Name)], []byte(cr.Name))
+	idx += len(cr.Name)
+
+	binary.LittleEndian.PutUint32(b[idx:idx+4], cr.Flags)
+	binary.LittleEndian.PutUint32(b[idx+4:idx+8], cr.Mode)
+	binary.LittleEndian.PutUint32(b[idx+8:idx+12], cr.GID)
+	return nil
+}
+
+func (cr *CreateRequestDotl) Unmarshal(b []byte) error {
+	t := 2 + 4 + 2 + 4 + 4 + 4
+	if len(b) < t {
+		return ErrPayloadTooShort
+	}
+	cr.Tag = Tag(binary.LittleEndian.Uint16(b[0:2]))
+	cr.Fid = Fid(binary.LittleEndian.Uint32(b[2:6]))
+	l := int(binary.LittleEndian.Uint16(b[6:8]))
+	t += l
+	if len(b) < t {
+		return ErrPayloadTooShort
+	}
+
+	cr.Name = string(b[8 : 8+l])
+	idx := 8 + l
+	cr.Flags = binary.LittleEndian.Uint32(b[idx : idx+4])
+	cr.Mode = binary.LittleEndian.Uint32(b[idx+4 : idx+8])
+	cr.GID = binary.LittleEndian.Uint32(b[idx+8 : idx+12])
+	return nil
+}
+
+// CreateResponseDotl returns the qid and iounit of the created file, exactly
+// like CreateResponse.
+type CreateResponseDotl struct {
+	Tag
+
+	// Qid is the qid of the created file.
+	Qid Qid
+
+	// IOUnit is the maximum amount of data that can be read/written by a single
+	// call, or 0 for no specification.
+	IOUnit uint32
+}
+
+func (cr *CreateResponseDotl) EncodedSize() int { return 2 + 13 + 4 }
+
+func (cr *CreateResponseDotl) Marshal(b []byte) error {
+	binary.LittleEndian.PutUint16(b[0:2], uint16(cr.Tag))
+	b[2] = byte(cr.Qid.Type)
+	binary.LittleEndian.PutUint32(b[3:7], cr.Qid.Version)
+	binary.LittleEndian.PutUint64(b[7:15], cr.Qid.Path)
+	binary.LittleEndian.PutUint32(b[15:19], cr.IOUnit)
+	return nil
+}
+
+func (cr *CreateResponseDotl) Unmarshal(b []byte) error {
+	if len(b) < 2+13+4 {
+		return ErrPayloadTooShort
+	}
+	cr.Tag = Tag(binary.LittleEndian.Uint16(b[0:2]))
+	cr.Qid.Type = QidType(b[2])
+	cr.Qid.Version = binary.LittleEndian.Uint32(b[3:7])
+	cr.Qid.Path = binary.LittleEndian.Uint64(b[7:15])
+	cr.IOUnit = binary.LittleEndian.Uint32(b[15:19])
+	return nil
+}
+
+// RenameRequestDotl is used to rename a file, potentially moving it to
+// another directory.
+type RenameRequestDotl struct {
+	Tag
+
+	// Fid is the file to rename.
+	Fid Fid
+
+	// DirectoryFid is the directory the file should be moved to. This field
+	// is called "dfid" in the official implementation.
+	DirectoryFid Fid
+
+	// Name is the new name of the file.
+	Name string
+}
+
+func (rr *RenameRequestDotl) EncodedSize() int { return 2 + 4 + 4 + 2 + len(rr.Name) }
+
+func (rr *RenameRequestDotl) Marshal(b []byte) error {
+	if err := checkStrings(rr.Name); err != nil {
+		return err
+	}
+
+	binary.LittleEndian.PutUint16(b[0:2], uint16(rr.Tag))
+	binary.LittleEndian.PutUint32(b[2:6], uint32(rr.Fid))
+	binary.LittleEndian.PutUint32(b[6:10], uint32(rr.DirectoryFid))
+	binary.LittleEndian.PutUint16(b[10:12], uint16(len(rr.Name)))
+	copy(b[12:], []byte(rr.Name))
+	return nil
+}
+
+func (rr *RenameRequestDotl) Unmarshal(b []byte) error {
+	t := 2 + 4 + 4 + 2
+	if len(b) < t {
+		return ErrPayloadTooShort
+	}
+	rr.Tag = Tag(binary.LittleEndian.Uint16(b[0:2]))
+	rr.Fid = Fid(binary.LittleEndian.Uint32(b[2:6]))
+	rr.DirectoryFid = Fid(binary.LittleEndian.Uint32(b[6:10]))
+
+	l := int(binary.LittleEndian.Uint16(b[10:12]))
+	t += l
+	if len(b) < t {
+		return ErrPayloadTooShort
+	}
+	rr.Name = string(b[12 : 12+l])
+	return nil
+}
+
+// RenameResponseDotl indicates a successful rename.
+type RenameResponseDotl struct {
+	Tag
+}
+
+func (rr *RenameResponseDotl) EncodedSize() int { return 2 }
+
+func (rr *RenameResponseDotl) Marshal(b []byte) error {
+	binary.LittleEndian.PutUint16(b[0:2], uint16(rr.Tag))
+	return nil
+}
+
+func (rr *RenameResponseDotl) Unmarshal(b []byte) error {
+	if len(b) < 2 {
+		return ErrPayloadTooShort
+	}
+	rr.Tag = Tag(binary.LittleEndian.Uint16(b[0:2]))
+	return nil
+}
+
+// ReadLinkRequestDotl is used to read the target of a symbolic link.
+type ReadLinkRequestDotl struct {
+	Tag
+
+	// Fid is the symbolic link to read.
+	Fid Fid
+}
+
+func (rr *ReadLinkRequestDotl) EncodedSize() int { return 2 + 4 }
+
+func (rr *ReadLinkRequestDotl) Marshal(b []byte) error {
+	binary.LittleEndian.PutUint16(b[0:2], uint16(rr.Tag))
+	binary.LittleEndian.PutUint32(b[2:6], uint32(rr.Fid))
+	return nil
+}
+
+func (rr *ReadLinkRequestDotl) Unmarshal(b []byte) error {
+	if len(b) < 2+4 {
+		return ErrPayloadTooShort
+	}
+	rr.Tag = Tag(binary.LittleEndian.Uint16(b[0:2]))
+	rr.Fid = Fid(binary.LittleEndian.Uint32(b[2:6]))
+	return nil
+}
+
+// ReadLinkResponseDotl returns the target of a symbolic link.
+type ReadLinkResponseDotl struct {
+	Tag
+
+	// Target is the target of the symbolic link.
+	Target string
+}
+
+func (rr *ReadLinkResponseDotl) EncodedSize() int { return 2 + 2 + len(rr.Target) }
+
+func (rr *ReadLinkResponseDotl) Marshal(b []byte) error {
+	if err := checkStrings(rr.Target); err != nil {
+		return err
+	}
+
+	binary.LittleEndian.PutUint16(b[0:2], uint16(rr.Tag))
+	binary.LittleEndian.PutUint16(b[2:4], uint16(len(rr.Target)))
+	copy(b[4:], []byte(rr.Target))
+	return nil
+}
+
+func (rr *ReadLinkResponseDotl) Unmarshal(b []byte) error {
+	t := 2 + 2
+	if len(b) < t {
+		return ErrPayloadTooShort
+	}
+	rr.Tag = Tag(binary.LittleEndian.Uint16(b[0:2]))
+
+	l := int(binary.LittleEndian.Uint16(b[2:4]))
+	t += l
+	if len(b) < t {
+		return ErrPayloadTooShort
+	}
+	rr.Target = string(b[4 : 4+l])
+	return nil
+}
+
+// GetAttrRequestDotl is used to retrieve the attributes of a file.
+type GetAttrRequestDotl struct {
+	Tag
+
+	// Fid is the file to retrieve attributes for.
+	Fid Fid
+
+	// RequestMask is a bitmask of the requested attributes, composed of the
+	// GetAttr constants.
+	RequestMask uint64
+}
+
+func (gr *GetAttrRequestDotl) EncodedSize() int { return 2 + 4 + 8 }
+
+func (gr *GetAttrRequestDotl) Marshal(b []byte) error {
+	binary.LittleEndian.PutUint16(b[0:2], uint16(gr.Tag))
+	binary.LittleEndian.PutUint32(b[2:6], uint32(gr.Fid))
+	binary.LittleEndian.PutUint64(b[6:14], gr.RequestMask)
+	return nil
+}
+
+func (gr *GetAttrRequestDotl) Unmarshal(b []byte) error {
+	if len(b) < 2+4+8 {
+		return ErrPayloadTooShort
+	}
+	gr.Tag = Tag(binary.LittleEndian.Uint16(b[0:2]))
+	gr.Fid = Fid(binary.LittleEndian.Uint32(b[2:6]))
+	gr.RequestMask = binary.LittleEndian.Uint64(b[6:14])
+	return nil
+}
+
+// GetAttrResponseDotl returns the attributes of a file, mirroring the Linux
+// stat structure. Only the attributes marked in Valid are meaningful.
+type GetAttrResponseDotl struct {
+	Tag
+
+	// Valid is a bitmask of the returned attributes, composed of the GetAttr
+	// constants.
+	Valid uint64
+
+	// Qid is the qid of the file.
+	Qid Qid
+
+	// Mode is the Linux mode of the file.
+	Mode uint32
+
+	// UID is the numeric user ID of the owner.
+	UID uint32
+
+	// GID is the numeric group ID of the owning group.
+	GID uint32
+
+	// NLink is the number of hard links.
+	NLink uint64
+
+	// RDev is the device ID for special files.
+	RDev uint64
+
+	// Size is the size of the file in bytes.
+	Size uint64
+
+	// BlockSize is the optimal block size for I/O.
+	BlockSize uint64
+
+	// Blocks is the number of 512 byte blocks allocated.
+	Blocks uint64
+
+	// AtimeSec and AtimeNsec is the last access time.
+	AtimeSec  uint64
+	AtimeNsec uint64
+
+	// MtimeSec and MtimeNsec is the last modification time.
+	MtimeSec  uint64
+	MtimeNsec uint64
+
+	// CtimeSec and CtimeNsec is the last status change time.
+	CtimeSec  uint64
+	CtimeNsec uint64
+
+	// BtimeSec and BtimeNsec is the creation time. Reserved for future use.
+	BtimeSec  uint64
+	BtimeNsec uint64
+
+	// Gen is the inode generation number. Reserved for future use.
+	Gen uint64
+
+	// DataVersion is the data version. Reserved for future use.
+	DataVersion uint64
+}
+
+func (gr *GetAttrResponseDotl) EncodedSize() int { return 2 + 8 + 13 + 4 + 4 + 4 + 8*15 }
+
+func (gr *GetAttrResponseDotl) Marshal(b []byte) error {
+	binary.LittleEndian.PutUint16(b[0:2], uint16(gr.Tag))
+	binary.LittleEndian.PutUint64(b[2:10], gr.Valid)
+	b[10] = byte(gr.Qid.Type)
+	binary.LittleEndian.PutUint32(b[11:15], gr.Qid.Version)
+	binary.LittleEndian.PutUint64(b[15:23], gr.Qid.Path)
+	binary.LittleEndian.PutUint32(b[23:27], gr.Mode)
+	binary.LittleEndian.PutUint32(b[27:31], gr.UID)
+	binary.LittleEndian.PutUint32(b[31:35], gr.GID)
+	binary.LittleEndian.PutUint64(b[35:43], gr.NLink)
+	binary.LittleEndian.PutUint64(b[43:51], gr.RDev)
+	binary.LittleEndian.PutUint64(b[51:59], gr.Size)
+	binary.LittleEndian.PutUint64(b[59:67], gr.BlockSize)
+	binary.LittleEndian.PutUint64(b[67:75], gr.Blocks)
+	binary.LittleEndian.PutUint64(b[75:83], gr.AtimeSec)
+	binary.LittleEndian.PutUint64(b[83:91], gr.AtimeNsec)
+	binary.LittleEndian.PutUint64(b[91:99], gr.MtimeSec)
+	binary.LittleEndian.PutUint64(b[99:107], gr.MtimeNsec)
+	binary.LittleEndian.PutUint64(b[107:115], gr.CtimeSec)
+	binary.LittleEndian.PutUint64(b[115:123], gr.CtimeNsec)
+	binary.LittleEndian.PutUint64(b[123:131], gr.BtimeSec)
+	binary.LittleEndian.PutUint64(b[131:139], gr.BtimeNsec)
+	binary.LittleEndian.PutUint64(b[139:147], gr.Gen)
+	binary.LittleEndian.PutUint64(b[147:155], gr.DataVersion)
+	return nil
+}
+
+func (gr *GetAttrResponseDotl) Unmarshal(b []byte) error {
+	if len(b) < 2+8+13+4+4+4+8*15 {
+		return ErrPayloadTooShort
+	}
+	gr.Tag = Tag(binary.LittleEndian.Uint16(b[0:2]))
+	gr.Valid = binary.LittleEndian.Uint64(b[2:10])
+	gr.Qid.Type = QidType(b[10])
+	gr.Qid.Version = binary.LittleEndian.Uint32(b[11:15])
+	gr.Qid.Path = binary.LittleEndian.Uint64(b[15:23])
+	gr.Mode = binary.LittleEndian.Uint32(b[23:27])
+	gr.UID = binary.LittleEndian.Uint32(b[27:31])
+	gr.GID = binary.LittleEndian.Uint32(b[31:35])
+	gr.NLink = binary.LittleEndian.Uint64(b[35:43])
+	gr.RDev = binary.LittleEndian.Uint64(b[43:51])
+	gr.Size = binary.LittleEndian.Uint64(b[51:59])
+	gr.BlockSize = binary.LittleEndian.Uint64(b[59:67])
+	gr.Blocks = binary.LittleEndian.Uint64(b[67:75])
+	gr.AtimeSec = binary.LittleEndian.Uint64(b[75:83])
+	gr.AtimeNsec = binary.LittleEndian.Uint64(b[83:91])
+	gr.MtimeSec = binary.LittleEndian.Uint64(b[91:99])
+	gr.MtimeNsec = binary.LittleEndian.Uint64(b[99:107])
+	gr.CtimeSec = binary.LittleEndian.Uint64(b[107:115])
+	gr.CtimeNsec = binary.LittleEndian.Uint64(b[115:123])
+	gr.BtimeSec = binary.LittleEndian.Uint64(b[123:131])
+	gr.BtimeNsec = binary.LittleEndian.Uint64(b[131:139])
+	gr.Gen = binary.LittleEndian.Uint64(b[139:147])
+	gr.DataVersion = binary.LittleEndian.Uint64(b[147:155])
+	return nil
+}
+
+// SetAttrRequestDotl is used to change the attributes of a file. Only the
+// attributes marked in Valid are applied.
+type SetAttrRequestDotl struct {
+	Tag
+
+	// Fid is the file to change attributes for.
+	Fid Fid
+
+	// Valid is a bitmask of the attributes to set, composed of the SetAttr
+	// constants.
+	Valid uint32
+
+	// Mode is the Linux mode of the file.
+	Mode uint32
+
+	// UID is the numeric user ID of the owner.
+	UID uint32
+
+	// GID is the numeric group ID of the owning group.
+	GID uint32
+
+	// Size is the size of the file in bytes.
+	Size uint64
+
+	// AtimeSec and AtimeNsec is the last access time.
+	AtimeSec  uint64
+	AtimeNsec uint64
+
+	// MtimeSec and MtimeNsec is the last modification time.
+	MtimeSec  uint64
+	MtimeNsec uint64
+}
+
+func (sr *SetAttrRequestDotl) EncodedSize() int { return 2 + 4 + 4 + 4 + 4 + 4 + 8*5 }
+
+func (sr *SetAttrRequestDotl) Marshal(b []byte) error {
+	binary.LittleEndian.PutUint16(b[0:2], uint16(sr.Tag))
+	binary.LittleEndian.PutUint32(b[2:6], uint32(sr.Fid))
+	binary.LittleEndian.PutUint32(b[6:10], sr.Valid)
+	binary.LittleEndian.PutUint32(b[10:14], sr.Mode)
+	binary.LittleEndian.PutUint32(b[14:18], sr.UID)
+	binary.LittleEndian.PutUint32(b[18:22], sr.GID)
+	binary.LittleEndian.PutUint64(b[22:30], sr.Size)
+	binary.LittleEndian.PutUint64(b[30:38], sr.AtimeSec)
+	binary.LittleEndian.PutUint64(b[38:46], sr.AtimeNsec)
+	binary.LittleEndian.PutUint64(b[46:54], sr.MtimeSec)
+	binary.LittleEndian.PutUint64(b[54:62], sr.MtimeNsec)
+	return nil
+}
+
+func (sr *SetAttrRequestDotl) Unmarshal(b []byte) error {
+	if len(b) < 2+4+4+4+4+4+8*5 {
+		return ErrPayloadTooShort
+	}
+	sr.Tag = Tag(binary.LittleEndian.Uint16(b[0:2]))
+	sr.Fid = Fid(binary.LittleEndian.Uint32(b[2:6]))
+	sr.Valid = binary.LittleEndian.Uint32(b[6:10])
+	sr.Mode = binary.LittleEndian.Uint32(b[10:14])
+	sr.UID = binary.LittleEndian.Uint32(b[14:18])
+	sr.GID = binary.LittleEndian.Uint32(b[18:22])
+	sr.Size = binary.LittleEndian.Uint64(b[22:30])
+	sr.AtimeSec = binary.LittleEndian.Uint64(b[30:38])
+	sr.AtimeNsec = binary.LittleEndian.Uint64(b[38:46])
+	sr.MtimeSec = binary.LittleEndian.Uint64(b[46:54])
+	sr.MtimeNsec = binary.LittleEndian.Uint64(b[54:62])
+	return nil
+}
+
+// SetAttrResponseDotl indicates a successful attribute change.
+type SetAttrResponseDotl struct {
+	Tag
+}
+
+func (sr *SetAttrResponseDotl) EncodedSize() int { return 2 }
+
+func (sr *SetAttrResponseDotl) Marshal(b []byte) error {
+	binary.LittleEndian.PutUint16(b[0:2], uint16(sr.Tag))
+	return nil
+}
+
+func (sr *SetAttrResponseDotl) Unmarshal(b []byte) error {
+	if len(b) < 2 {
+		return ErrPayloadTooShort
+	}
+	sr.Tag = Tag(binary.LittleEndian.Uint16(b[0:2]))
+	return nil
+}
+
+// ReadDirRequestDotl is used to read directory entries from an open
+// directory.
+type ReadDirRequestDotl struct {
+	Tag
+
+	// Fid is the directory to read.
+	Fid Fid
+
+	// Offset is either 0, or the Offset of the last entry previously read.
+	Offset uint64
+
+	// Count is the maximum amount of bytes of directory entries requested.
+	Count uint32
+}
+
+func (rr *ReadDirRequestDotl) EncodedSize() int { return 2 + 4 + 8 + 4 }
+
+func (rr *ReadDirRequestDotl) Marshal(b []byte) error {
+	binary.LittleEndian.PutUint16(b[0:2], uint16(rr.Tag))
+	binary.LittleEndian.PutUint32(b[2:6], uint32(rr.Fid))
+	binary.LittleEndian.PutUint64(b[6:14], rr.Offset)
+	binary.LittleEndian.PutUint32(b[14:18], rr.Count)
+	return nil
+}
+
+func (rr *ReadDirRequestDotl) Unmarshal(b []byte) error {
+	if len(b) < 2+4+8+4 {
+		return ErrPayloadTooShort
+	}
+	rr.Tag = Tag(binary.LittleEndian.Uint16(b[0:2]))
+	rr.Fid = Fid(binary.LittleEndian.Uint32(b[2:6]))
+	rr.Offset = binary.LittleEndian.Uint64(b[6:14])
+	rr.Count = binary.LittleEndian.Uint32(b[14:18])
+	return nil
+}
+
+// ReadDirResponseDotl returns directory entries. The entries are packed
+// back-to-back in the data field, the size of which is given by count.
+type ReadDirResponseDotl struct {
+	Tag
+
+	// Entries are the read directory entries.
+	Entries []DirEntryDotl
+}
+
+func (rr *ReadDirResponseDotl) EncodedSize() int {
+	l := 2 + 4
+	for i := range rr.Entries {
+		l += rr.Entries[i].EncodedSize()
+	}
+	return l
+}
+
+func (rr *ReadDirResponseDotl) Marshal(b []byte) error {
+	if err := checkDataSize(uint64(rr.EncodedSize() - 6)); err != nil {
+		return err
+	}
+
+	binary.LittleEndian.PutUint16(b[0:2], uint16(rr.Tag))
+	binary.LittleEndian.PutUint32(b[2:6], uint32(rr.EncodedSize()-6))
+	idx := 6
+	for i := range rr.Entries {
+		if err := rr.Entries[i].Marshal(b[idx:]); err != nil {
+			return err
+		}
+		idx += rr.Entries[i].EncodedSize()
+	}
+	return nil
+}
+
+func (rr *ReadDirResponseDotl) Unmarshal(b []byte) error {
+	if len(b) < 2+4 {
+		return ErrPayloadTooShort
+	}
+	rr.Tag = Tag(binary.LittleEndian.Uint16(b[0:2]))
+	l := int64(binary.LittleEndian.Uint32(b[2:6]))
+	if int64(len(b)) < 2+4+l {
+		return ErrPayloadTooShort
+	}
+
+	b = b[6 : 6+l]
+	rr.Entries = nil
+	for len(b) > 0 {
+		var de DirEntryDotl
+		if err := de.Unmarshal(b); err != nil {
+			return err
+		}
+		rr.Entries = append(rr.Entries, de)
+		b = b[de.EncodedSize():]
+	}
+	return nil
+}
+
+// MkdirRequestDotl is used to create a directory.
+type MkdirRequestDotl struct {
+	Tag
+
+	// DirectoryFid is the directory to create the new directory in. This
+	// field is called "dfid" in the official implementation.
+	DirectoryFid Fid
+
+	// Name is the name of the directory to create.
+	Name string
+
+	// Mode is the Linux permissions of the directory to create.
+	Mode uint32
+
+	// GID is the numeric group ID of the directory to create.
+	GID uint32
+}
+
+func (mr *MkdirRequestDotl) EncodedSize() int { return 2 + 4 + 2 + len(mr.Name) + 4 + 4 }
+
+func (mr *MkdirRequestDotl) Marshal(b []byte) error {
+	if err := checkStrings(mr.Name); err != nil {
+		return err
+	}
+
+	binary.LittleEndian.PutUint16(b[0:2], uint16(mr.Tag))
+	binary.LittleEndian.PutUint32(b[2:6], uint32(mr.DirectoryFid))
+	binary.LittleEndian.PutUint16(b[6:8], uint16(len(mr.Name)))
+
+	idx := 8
+	copy(b[idx:idx+len(mr.Name)], []byte(mr.Name))
+	idx += len(mr.Name)
+
+	binary.LittleEndian.PutUint32(b[idx:idx+4], mr.Mode)
+	binary.LittleEndian.PutUint32(b[idx+4:idx+8], mr.GID)
+	return nil
+}
+
+func (mr *MkdirRequestDotl) Unmarshal(b []byte) error {
+	t := 2 + 4 + 2 + 4 + 4
+	if len(b) < t {
+		return ErrPayloadTooShort
+	}
+	mr.Tag = Tag(binary.LittleEndian.Uint16(b[0:2]))
+	mr.DirectoryFid = Fid(binary.LittleEndian.Uint32(b[2:6]))
+	l := int(binary.LittleEndian.Uint16(b[6:8]))
+	t += l
+	if len(b) < t {
+		return ErrPayloadTooShort
+	}
+
+	mr.Name = string(b[8 : 8+l])
+	idx := 8 + l
+	mr.Mode = binary.LittleEndian.Uint32(b[idx : idx+4])
+	mr.GID = binary.LittleEndian.Uint32(b[idx+4 : idx+8])
+	return nil
+}
+
+// MkdirResponseDotl returns the qid of the created directory.
+type MkdirResponseDotl struct {
+	Tag
+
+	// Qid is the qid of the created directory.
+	Qid Qid
+}
+
+func (mr *MkdirResponseDotl) EncodedSize() int { return 2 + 13 }
+
+func (mr *MkdirResponseDotl) Marshal(b []byte) error {
+	binary.LittleEndian.PutUint16(b[0:2], uint16(mr.Tag))
+	b[2] = byte(mr.Qid.Type)
+	binary.LittleEndian.PutUint32(b[3:7], mr.Qid.Version)
+	binary.LittleEndian.PutUint64(b[7:15], mr.Qid.Path)
+	return nil
+}
+
+func (mr *MkdirResponseDotl) Unmarshal(b []byte) error {
+	if len(b) < 2+13 {
+		return ErrPayloadTooShort
+	}
+	mr.Tag = Tag(binary.LittleEndian.Uint16(b[0:2]))
+	mr.Qid.Type = QidType(b[2])
+	mr.Qid.Version = binary.LittleEndian.Uint32(b[3:7])
+	mr.Qid.Path = binary.LittleEndian.Uint64(b[7:15])
+	return nil
+}
@@ -0,0 +1,62 @@
+package qp
+
+// VersionDotl is the 9P2000.L version string.
+const VersionDotl = "9P2000.L"
+
+// MessageType constants for 9P2000.L.
+const (
+	Tlerror   MessageType = 6 // Not a valid message.
+	Rlerror   MessageType = 7
+	Tstatfs   MessageType = 8
+	Rstatfs   MessageType = 9
+	Tlopen    MessageType = 12
+	Rlopen    MessageType = 13
+	Tlcreate  MessageType = 14
+	Rlcreate  MessageType = 15
+	Trename   MessageType = 20
+	Rrename   MessageType = 21
+	Treadlink MessageType = 22
+	Rreadlink MessageType = 23
+	Tgetattr  MessageType = 24
+	Rgetattr  MessageType = 25
+	Tsetattr  MessageType = 26
+	Rsetattr  MessageType = 27
+	Treaddir  MessageType = 40
+	Rreaddir  MessageType = 41
+	Tmkdir    MessageType = 72
+	Rmkdir    MessageType = 73
+)
+
+// Attribute request mask bits for 9P2000.L getattr.
+const (
+	GetAttrMode        uint64 = 0x00000001
+	GetAttrNLink       uint64 = 0x00000002
+	GetAttrUID         uint64 = 0x00000004
+	GetAttrGID         uint64 = 0x00000008
+	GetAttrRDev        uint64 = 0x00000010
+	GetAttrAtime       uint64 = 0x00000020
+	GetAttrMtime       uint64 = 0x00000040
+	GetAttrCtime       uint64 = 0x00000080
+	GetAttrIno         uint64 = 0x00000100
+	GetAttrSize        uint64 = 0x00000200
+	GetAttrBlocks      uint64 = 0x00000400
+	GetAttrBtime       uint64 = 0x00000800
+	GetAttrGen         uint64 = 0x00001000
+	GetAttrDataVersion uint64 = 0x00002000
+
+	GetAttrBasic uint64 = 0x000007ff
+	GetAttrAll   uint64 = 0x00003fff
+)
+
+// Attribute valid bits for 9P2000.L setattr.
+const (
+	SetAttrMode     uint32 = 0x00000001
+	SetAttrUID      uint32 = 0x00000002
+	SetAttrGID      uint32 = 0x00000004
+	SetAttrSize     uint32 = 0x00000008
+	SetAttrAtime    uint32 = 0x00000010
+	SetAttrMtime    uint32 = 0x00000020
+	SetAttrCtime    uint32 = 0x00000040
+	SetAttrAtimeSet uint32 = 0x00000080
+	SetAttrMtimeSet uint32 = 0x00000100
+)
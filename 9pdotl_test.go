@@ -0,0 +1,294 @@
+package qp
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+)
+
+// Test if the types live up to their interface
+var (
+	_ Marshallable = (*DirEntryDotl)(nil)
+	_ Message      = (*ErrorResponseDotl)(nil)
+	_ Message      = (*StatfsRequestDotl)(nil)
+	_ Message      = (*StatfsResponseDotl)(nil)
+	_ Message      = (*OpenRequestDotl)(nil)
+	_ Message      = (*OpenResponseDotl)(nil)
+	_ Message      = (*CreateRequestDotl)(nil)
+	_ Message      = (*CreateResponseDotl)(nil)
+	_ Message      = (*RenameRequestDotl)(nil)
+	_ Message      = (*RenameResponseDotl)(nil)
+	_ Message      = (*ReadLinkRequestDotl)(nil)
+	_ Message      = (*ReadLinkResponseDotl)(nil)
+	_ Message      = (*GetAttrRequestDotl)(nil)
+	_ Message      = (*GetAttrResponseDotl)(nil)
+	_ Message      = (*SetAttrRequestDotl)(nil)
+	_ Message      = (*SetAttrResponseDotl)(nil)
+	_ Message      = (*ReadDirRequestDotl)(nil)
+	_ Message      = (*ReadDirResponseDotl)(nil)
+	_ Message      = (*MkdirRequestDotl)(nil)
+	_ Message      = (*MkdirResponseDotl)(nil)
+)
+
+var PrimitiveTestDataDotl = []PrimitiveTestEntry{
+	{
+		&DirEntryDotl{
+			Qid:    Qid{Type: QTDIR, Version: 0, Path: 1},
+			Offset: 1,
+			Type:   4,
+			Name:   ".",
+		},
+		[]byte{0x80, 0x0, 0x0, 0x0, 0x0, 0x1, 0x0, 0x0, 0x0, 0x0, 0x0, 0x0, 0x0, 0x1, 0x0, 0x0, 0x0, 0x0, 0x0, 0x0, 0x0, 0x4, 0x1, 0x0, 0x2e},
+	},
+}
+
+var MessageTestDataDotl = []MessageTestEntry{
+	{
+		&ErrorResponseDotl{
+			Tag:   45,
+			Errno: 2,
+		},
+		[]byte{0x2d, 0x0, 0x2, 0x0, 0x0, 0x0},
+		[]byte{0xb, 0x0, 0x0, 0x0, 0x7, 0x2d, 0x0, 0x2, 0x0, 0x0, 0x0},
+	}, {
+		&StatfsRequestDotl{
+			Tag: 45,
+			Fid: 1234,
+		},
+		[]byte{0x2d, 0x0, 0xd2, 0x4, 0x0, 0x0},
+		[]byte{0xb, 0x0, 0x0, 0x0, 0x8, 0x2d, 0x0, 0xd2, 0x4, 0x0, 0x0},
+	}, {
+		&StatfsResponseDotl{
+			Tag:             45,
+			Type:            0x01021994,
+			BlockSize:       4096,
+			Blocks:          1000000,
+			BlocksFree:      500000,
+			BlocksAvailable: 400000,
+			Files:           65536,
+			FilesFree:       32768,
+			FSID:            0xDEADBEEF,
+			NameLength:      255,
+		},
+		[]byte{0x2d, 0x0, 0x94, 0x19, 0x2, 0x1, 0x0, 0x10, 0x0, 0x0, 0x40, 0x42, 0xf, 0x0, 0x0, 0x0, 0x0, 0x0, 0x20, 0xa1, 0x7, 0x0, 0x0, 0x0, 0x0, 0x0, 0x80, 0x1a, 0x6, 0x0, 0x0, 0x0, 0x0, 0x0, 0x0, 0x0, 0x1, 0x0, 0x0, 0x0, 0x0, 0x0, 0x0, 0x80, 0x0, 0x0, 0x0, 0x0, 0x0, 0x0, 0xef, 0xbe, 0xad, 0xde, 0x0, 0x0, 0x0, 0x0, 0xff, 0x0, 0x0, 0x0},
+		[]byte{0x43, 0x0, 0x0, 0x0, 0x9, 0x2d, 0x0, 0x94, 0x19, 0x2, 0x1, 0x0, 0x10, 0x0, 0x0, 0x40, 0x42, 0xf, 0x0, 0x0, 0x0, 0x0, 0x0, 0x20, 0xa1, 0x7, 0x0, 0x0, 0x0, 0x0, 0x0, 0x80, 0x1a, 0x6, 0x0, 0x0, 0x0, 0x0, 0x0, 0x0, 0x0, 0x1, 0x0, 0x0, 0x0, 0x0, 0x0, 0x0, 0x80, 0x0, 0x0, 0x0, 0x0, 0x0, 0x0, 0xef, 0xbe, 0xad, 0xde, 0x0, 0x0, 0x0, 0x0, 0xff, 0x0, 0x0, 0x0},
+	}, {
+		&OpenRequestDotl{
+			Tag:   45,
+			Fid:   4321,
+			Flags: 0100002,
+		},
+		[]byte{0x2d, 0x0, 0xe1, 0x10, 0x0, 0x0, 0x2, 0x80, 0x0, 0x0},
+		[]byte{0xf, 0x0, 0x0, 0x0, 0xc, 0x2d, 0x0, 0xe1, 0x10, 0x0, 0x0, 0x2, 0x80, 0x0, 0x0},
+	}, {
+		&OpenResponseDotl{
+			Tag:    45,
+			Qid:    Qid{Type: QTDIR, Version: 3, Path: 0x1234},
+			IOUnit: 8192,
+		},
+		[]byte{0x2d, 0x0, 0x80, 0x3, 0x0, 0x0, 0x0, 0x34, 0x12, 0x0, 0x0, 0x0, 0x0, 0x0, 0x0, 0x0, 0x20, 0x0, 0x0},
+		[]byte{0x18, 0x0, 0x0, 0x0, 0xd, 0x2d, 0x0, 0x80, 0x3, 0x0, 0x0, 0x0, 0x34, 0x12, 0x0, 0x0, 0x0, 0x0, 0x0, 0x0, 0x0, 0x20, 0x0, 0x0},
+	}, {
+		&CreateRequestDotl{
+			Tag:   45,
+			Fid:   234,
+			Name:  "newfile",
+			Flags: 01101,
+			Mode:  0644,
+			GID:   1000,
+		},
+		[]byte{0x2d, 0x0, 0xea, 0x0, 0x0, 0x0, 0x7, 0x0, 0x6e, 0x65, 0x77, 0x66, 0x69, 0x6c, 0x65, 0x41, 0x2, 0x0, 0x0, 0xa4, 0x1, 0x0, 0x0, 0xe8, 0x3, 0x0, 0x0},
+		[]byte{0x20, 0x0, 0x0, 0x0, 0xe, 0x2d, 0x0, 0xea, 0x0, 0x0, 0x0, 0x7, 0x0, 0x6e, 0x65, 0x77, 0x66, 0x69, 0x6c, 0x65, 0x41, 0x2, 0x0, 0x0, 0xa4, 0x1, 0x0, 0x0, 0xe8, 0x3, 0x0, 0x0},
+	}, {
+		&CreateResponseDotl{
+			Tag:    45,
+			Qid:    Qid{Type: QTFILE, Version: 1, Path: 0x4321},
+			IOUnit: 4096,
+		},
+		[]byte{0x2d, 0x0, 0x0, 0x1, 0x0, 0x0, 0x0, 0x21, 0x43, 0x0, 0x0, 0x0, 0x0, 0x0, 0x0, 0x0, 0x10, 0x0, 0x0},
+		[]byte{0x18, 0x0, 0x0, 0x0, 0xf, 0x2d, 0x0, 0x0, 0x1, 0x0, 0x0, 0x0, 0x21, 0x43, 0x0, 0x0, 0x0, 0x0, 0x0, 0x0, 0x0, 0x10, 0x0, 0x0},
+	}, {
+		&RenameRequestDotl{
+			Tag:          45,
+			Fid:          12,
+			DirectoryFid: 34,
+			Name:         "renamed",
+		},
+		[]byte{0x2d, 0x0, 0xc, 0x0, 0x0, 0x0, 0x22, 0x0, 0x0, 0x0, 0x7, 0x0, 0x72, 0x65, 0x6e, 0x61, 0x6d, 0x65, 0x64},
+		[]byte{0x18, 0x0, 0x0, 0x0, 0x14, 0x2d, 0x0, 0xc, 0x0, 0x0, 0x0, 0x22, 0x0, 0x0, 0x0, 0x7, 0x0, 0x72, 0x65, 0x6e, 0x61, 0x6d, 0x65, 0x64},
+	}, {
+		&RenameResponseDotl{
+			Tag: 45,
+		},
+		[]byte{0x2d, 0x0},
+		[]byte{0x7, 0x0, 0x0, 0x0, 0x15, 0x2d, 0x0},
+	}, {
+		&ReadLinkRequestDotl{
+			Tag: 45,
+			Fid: 5432,
+		},
+		[]byte{0x2d, 0x0, 0x38, 0x15, 0x0, 0x0},
+		[]byte{0xb, 0x0, 0x0, 0x0, 0x16, 0x2d, 0x0, 0x38, 0x15, 0x0, 0x0},
+	}, {
+		&ReadLinkResponseDotl{
+			Tag:    45,
+			Target: "/some/target",
+		},
+		[]byte{0x2d, 0x0, 0xc, 0x0, 0x2f, 0x73, 0x6f, 0x6d, 0x65, 0x2f, 0x74, 0x61, 0x72, 0x67, 0x65, 0x74},
+		[]byte{0x15, 0x0, 0x0, 0x0, 0x17, 0x2d, 0x0, 0xc, 0x0, 0x2f, 0x73, 0x6f, 0x6d, 0x65, 0x2f, 0x74, 0x61, 0x72, 0x67, 0x65, 0x74},
+	}, {
+		&GetAttrRequestDotl{
+			Tag:         45,
+			Fid:         987,
+			RequestMask: GetAttrAll,
+		},
+		[]byte{0x2d, 0x0, 0xdb, 0x3, 0x0, 0x0, 0xff, 0x3f, 0x0, 0x0, 0x0, 0x0, 0x0, 0x0},
+		[]byte{0x13, 0x0, 0x0, 0x0, 0x18, 0x2d, 0x0, 0xdb, 0x3, 0x0, 0x0, 0xff, 0x3f, 0x0, 0x0, 0x0, 0x0, 0x0, 0x0},
+	}, {
+		&GetAttrResponseDotl{
+			Tag:         45,
+			Valid:       GetAttrBasic,
+			Qid:         Qid{Type: QTDIR, Version: 2, Path: 0x98765},
+			Mode:        040755,
+			UID:         1000,
+			GID:         100,
+			NLink:       1,
+			RDev:        2,
+			Size:        3,
+			BlockSize:   4,
+			Blocks:      5,
+			AtimeSec:    6,
+			AtimeNsec:   7,
+			MtimeSec:    8,
+			MtimeNsec:   9,
+			CtimeSec:    10,
+			CtimeNsec:   11,
+			BtimeSec:    12,
+			BtimeNsec:   13,
+			Gen:         14,
+			DataVersion: 15,
+		},
+		[]byte{0x2d, 0x0, 0xff, 0x7, 0x0, 0x0, 0x0, 0x0, 0x0, 0x0, 0x80, 0x2, 0x0, 0x0, 0x0, 0x65, 0x87, 0x9, 0x0, 0x0, 0x0, 0x0, 0x0, 0xed, 0x41, 0x0, 0x0, 0xe8, 0x3, 0x0, 0x0, 0x64, 0x0, 0x0, 0x0, 0x1, 0x0, 0x0, 0x0, 0x0, 0x0, 0x0, 0x0, 0x2, 0x0, 0x0, 0x0, 0x0, 0x0, 0x0, 0x0, 0x3, 0x0, 0x0, 0x0, 0x0, 0x0, 0x0, 0x0, 0x4, 0x0, 0x0, 0x0, 0x0, 0x0, 0x0, 0x0, 0x5, 0x0, 0x0, 0x0, 0x0, 0x0, 0x0, 0x0, 0x6, 0x0, 0x0, 0x0, 0x0, 0x0, 0x0, 0x0, 0x7, 0x0, 0x0, 0x0, 0x0, 0x0, 0x0, 0x0, 0x8, 0x0, 0x0, 0x0, 0x0, 0x0, 0x0, 0x0, 0x9, 0x0, 0x0, 0x0, 0x0, 0x0, 0x0, 0x0, 0xa, 0x0, 0x0, 0x0, 0x0, 0x0, 0x0, 0x0, 0xb, 0x0, 0x0, 0x0, 0x0, 0x0, 0x0, 0x0, 0xc, 0x0, 0x0, 0x0, 0x0, 0x0, 0x0, 0x0, 0xd, 0x0, 0x0, 0x0, 0x0, 0x0, 0x0, 0x0, 0xe, 0x0, 0x0, 0x0, 0x0, 0x0, 0x0, 0x0, 0xf, 0x0, 0x0, 0x0, 0x0, 0x0, 0x0, 0x0},
+		[]byte{0xa0, 0x0, 0x0, 0x0, 0x19, 0x2d, 0x0, 0xff, 0x7, 0x0, 0x0, 0x0, 0x0, 0x0, 0x0, 0x80, 0x2, 0x0, 0x0, 0x0, 0x65, 0x87, 0x9, 0x0, 0x0, 0x0, 0x0, 0x0, 0xed, 0x41, 0x0, 0x0, 0xe8, 0x3, 0x0, 0x0, 0x64, 0x0, 0x0, 0x0, 0x1, 0x0, 0x0, 0x0, 0x0, 0x0, 0x0, 0x0, 0x2, 0x0, 0x0, 0x0, 0x0, 0x0, 0x0, 0x0, 0x3, 0x0, 0x0, 0x0, 0x0, 0x0, 0x0, 0x0, 0x4, 0x0, 0x0, 0x0, 0x0, 0x0, 0x0, 0x0, 0x5, 0x0, 0x0, 0x0, 0x0, 0x0, 0x0, 0x0, 0x6, 0x0, 0x0, 0x0, 0x0, 0x0, 0x0, 0x0, 0x7, 0x0, 0x0, 0x0, 0x0, 0x0, 0x0, 0x0, 0x8, 0x0, 0x0, 0x0, 0x0, 0x0, 0x0, 0x0, 0x9, 0x0, 0x0, 0x0, 0x0, 0x0, 0x0, 0x0, 0xa, 0x0, 0x0, 0x0, 0x0, 0x0, 0x0, 0x0, 0xb, 0x0, 0x0, 0x0, 0x0, 0x0, 0x0, 0x0, 0xc, 0x0, 0x0, 0x0, 0x0, 0x0, 0x0, 0x0, 0xd, 0x0, 0x0, 0x0, 0x0, 0x0, 0x0, 0x0, 0xe, 0x0, 0x0, 0x0, 0x0, 0x0, 0x0, 0x0, 0xf, 0x0, 0x0, 0x0, 0x0, 0x0, 0x0, 0x0},
+	}, {
+		&SetAttrRequestDotl{
+			Tag:       45,
+			Fid:       345,
+			Valid:     SetAttrMode | SetAttrSize,
+			Mode:      0644,
+			UID:       1000,
+			GID:       100,
+			Size:      4096,
+			AtimeSec:  11,
+			AtimeNsec: 12,
+			MtimeSec:  13,
+			MtimeNsec: 14,
+		},
+		[]byte{0x2d, 0x0, 0x59, 0x1, 0x0, 0x0, 0x9, 0x0, 0x0, 0x0, 0xa4, 0x1, 0x0, 0x0, 0xe8, 0x3, 0x0, 0x0, 0x64, 0x0, 0x0, 0x0, 0x0, 0x10, 0x0, 0x0, 0x0, 0x0, 0x0, 0x0, 0xb, 0x0, 0x0, 0x0, 0x0, 0x0, 0x0, 0x0, 0xc, 0x0, 0x0, 0x0, 0x0, 0x0, 0x0, 0x0, 0xd, 0x0, 0x0, 0x0, 0x0, 0x0, 0x0, 0x0, 0xe, 0x0, 0x0, 0x0, 0x0, 0x0, 0x0, 0x0},
+		[]byte{0x43, 0x0, 0x0, 0x0, 0x1a, 0x2d, 0x0, 0x59, 0x1, 0x0, 0x0, 0x9, 0x0, 0x0, 0x0, 0xa4, 0x1, 0x0, 0x0, 0xe8, 0x3, 0x0, 0x0, 0x64, 0x0, 0x0, 0x0, 0x0, 0x10, 0x0, 0x0, 0x0, 0x0, 0x0, 0x0, 0xb, 0x0, 0x0, 0x0, 0x0, 0x0, 0x0, 0x0, 0xc, 0x0, 0x0, 0x0, 0x0, 0x0, 0x0, 0x0, 0xd, 0x0, 0x0, 0x0, 0x0, 0x0, 0x0, 0x0, 0xe, 0x0, 0x0, 0x0, 0x0, 0x0, 0x0, 0x0},
+	}, {
+		&SetAttrResponseDotl{
+			Tag: 45,
+		},
+		[]byte{0x2d, 0x0},
+		[]byte{0x7, 0x0, 0x0, 0x0, 0x1b, 0x2d, 0x0},
+	}, {
+		&ReadDirRequestDotl{
+			Tag:    45,
+			Fid:    876,
+			Offset: 0,
+			Count:  8192,
+		},
+		[]byte{0x2d, 0x0, 0x6c, 0x3, 0x0, 0x0, 0x0, 0x0, 0x0, 0x0, 0x0, 0x0, 0x0, 0x0, 0x0, 0x20, 0x0, 0x0},
+		[]byte{0x17, 0x0, 0x0, 0x0, 0x28, 0x2d, 0x0, 0x6c, 0x3, 0x0, 0x0, 0x0, 0x0, 0x0, 0x0, 0x0, 0x0, 0x0, 0x0, 0x0, 0x20, 0x0, 0x0},
+	}, {
+		&ReadDirResponseDotl{
+			Tag: 45,
+			Entries: []DirEntryDotl{
+				{
+					Qid:    Qid{Type: QTDIR, Version: 0, Path: 1},
+					Offset: 1,
+					Type:   4,
+					Name:   ".",
+				}, {
+					Qid:    Qid{Type: QTFILE, Version: 5, Path: 2},
+					Offset: 2,
+					Type:   8,
+					Name:   "file.txt",
+				},
+			},
+		},
+		[]byte{0x2d, 0x0, 0x39, 0x0, 0x0, 0x0, 0x80, 0x0, 0x0, 0x0, 0x0, 0x1, 0x0, 0x0, 0x0, 0x0, 0x0, 0x0, 0x0, 0x1, 0x0, 0x0, 0x0, 0x0, 0x0, 0x0, 0x0, 0x4, 0x1, 0x0, 0x2e, 0x0, 0x5, 0x0, 0x0, 0x0, 0x2, 0x0, 0x0, 0x0, 0x0, 0x0, 0x0, 0x0, 0x2, 0x0, 0x0, 0x0, 0x0, 0x0, 0x0, 0x0, 0x8, 0x8, 0x0, 0x66, 0x69, 0x6c, 0x65, 0x2e, 0x74, 0x78, 0x74},
+		[]byte{0x44, 0x0, 0x0, 0x0, 0x29, 0x2d, 0x0, 0x39, 0x0, 0x0, 0x0, 0x80, 0x0, 0x0, 0x0, 0x0, 0x1, 0x0, 0x0, 0x0, 0x0, 0x0, 0x0, 0x0, 0x1, 0x0, 0x0, 0x0, 0x0, 0x0, 0x0, 0x0, 0x4, 0x1, 0x0, 0x2e, 0x0, 0x5, 0x0, 0x0, 0x0, 0x2, 0x0, 0x0, 0x0, 0x0, 0x0, 0x0, 0x0, 0x2, 0x0, 0x0, 0x0, 0x0, 0x0, 0x0, 0x0, 0x8, 0x8, 0x0, 0x66, 0x69, 0x6c, 0x65, 0x2e, 0x74, 0x78, 0x74},
+	}, {
+		&MkdirRequestDotl{
+			Tag:          45,
+			DirectoryFid: 44,
+			Name:         "dir",
+			Mode:         0755,
+			GID:          100,
+		},
+		[]byte{0x2d, 0x0, 0x2c, 0x0, 0x0, 0x0, 0x3, 0x0, 0x64, 0x69, 0x72, 0xed, 0x1, 0x0, 0x0, 0x64, 0x0, 0x0, 0x0},
+		[]byte{0x18, 0x0, 0x0, 0x0, 0x48, 0x2d, 0x0, 0x2c, 0x0, 0x0, 0x0, 0x3, 0x0, 0x64, 0x69, 0x72, 0xed, 0x1, 0x0, 0x0, 0x64, 0x0, 0x0, 0x0},
+	}, {
+		&MkdirResponseDotl{
+			Tag: 45,
+			Qid: Qid{Type: QTDIR, Version: 0, Path: 0x5555},
+		},
+		[]byte{0x2d, 0x0, 0x80, 0x0, 0x0, 0x0, 0x0, 0x55, 0x55, 0x0, 0x0, 0x0, 0x0, 0x0, 0x0},
+		[]byte{0x14, 0x0, 0x0, 0x0, 0x49, 0x2d, 0x0, 0x80, 0x0, 0x0, 0x0, 0x0, 0x55, 0x55, 0x0, 0x0, 0x0, 0x0, 0x0, 0x0},
+	},
+}
+
+func TestUnmarshalErrorDotl(t *testing.T) {
+	for i, tt := range PrimitiveTestDataDotl {
+		r := reflect.New(reflect.ValueOf(tt.input).Elem().Type()).Interface().(Marshallable)
+		testUnmarshal(t, i, r, tt.reference[:len(tt.reference)-1])
+	}
+	for i, tt := range MessageTestDataDotl {
+		r := reflect.New(reflect.ValueOf(tt.input).Elem().Type()).Interface().(Marshallable)
+		testUnmarshal(t, i, r, tt.reference[:len(tt.reference)-1])
+	}
+}
+
+// This test does NOT guarantee proper 9P2000 spec coding, but ensures at least
+// that all codecs are compatible with themselves.
+func TestReencodeDotl(t *testing.T) {
+	for i, tt := range PrimitiveTestDataDotl {
+		reencode(i, tt.input, tt.reference, t, NineP2000Dotl)
+	}
+	for i, tt := range MessageTestDataDotl {
+		reencode(i, tt.input, tt.reference, t, NineP2000Dotl)
+	}
+}
+
+// TestContainerDotl ensures that the 9P2000.L messages are selected by the
+// protocol when encoding and decoding full messages.
+func TestContainerDotl(t *testing.T) {
+	buf := new(bytes.Buffer)
+	e := Encoder{
+		Protocol: NineP2000Dotl,
+		Writer:   buf,
+	}
+	d := Decoder{
+		Protocol: NineP2000Dotl,
+		Reader:   buf,
+	}
+
+	for i, tt := range MessageTestDataDotl {
+		if err := e.WriteMessage(tt.input); err != nil {
+			t.Fatalf("test %d: encoding failed for %T: %v", i, tt.input, err)
+		}
+		if bytes.Compare(buf.Bytes(), tt.container) != 0 {
+			t.Errorf("test %d: encoded message did not match reference.\nExpected: %#v\n\tGot:      %#v", i, tt.container, buf.Bytes())
+		}
+
+		m, err := d.ReadMessage()
+		if err != nil {
+			t.Fatalf("test %d: decoding failed for %T: %v", i, tt.input, err)
+		}
+		if !CompareMarshallables(tt.input, m) {
+			t.Errorf("test %d: %T did not reencode correctly\n\tExpected: %#v\n\tGot:      %#v", i, tt.input, tt.input, m)
+		}
+	}
+}
@@ -0,0 +1,105 @@
+package qp
+
+// nineP2000Dotl implements the conversions for 9P2000.L.
+type nineP2000Dotl struct{}
+
+// Message returns an empty Message based on the provided message type for
+// 9P2000.L.
+func (nineP2000Dotl) Message(mt MessageType) (Message, error) {
+	switch mt {
+	case Tauth:
+		return &AuthRequestDotu{}, nil
+	case Tattach:
+		return &AttachRequestDotu{}, nil
+	case Rlerror:
+		return &ErrorResponseDotl{}, nil
+	case Tstatfs:
+		return &StatfsRequestDotl{}, nil
+	case Rstatfs:
+		return &StatfsResponseDotl{}, nil
+	case Tlopen:
+		return &OpenRequestDotl{}, nil
+	case Rlopen:
+		return &OpenResponseDotl{}, nil
+	case Tlcreate:
+		return &CreateRequestDotl{}, nil
+	case Rlcreate:
+		return &CreateResponseDotl{}, nil
+	case Trename:
+		return &RenameRequestDotl{}, nil
+	case Rrename:
+		return &RenameResponseDotl{}, nil
+	case Treadlink:
+		return &ReadLinkRequestDotl{}, nil
+	case Rreadlink:
+		return &ReadLinkResponseDotl{}, nil
+	case Tgetattr:
+		return &GetAttrRequestDotl{}, nil
+	case Rgetattr:
+		return &GetAttrResponseDotl{}, nil
+	case Tsetattr:
+		return &SetAttrRequestDotl{}, nil
+	case Rsetattr:
+		return &SetAttrResponseDotl{}, nil
+	case Treaddir:
+		return &ReadDirRequestDotl{}, nil
+	case Rreaddir:
+		return &ReadDirResponseDotl{}, nil
+	case Tmkdir:
+		return &MkdirRequestDotl{}, nil
+	case Rmkdir:
+		return &MkdirResponseDotl{}, nil
+	default:
+		return NineP2000.Message(mt)
+	}
+}
+
+// MessageType returns the message type of a given message for 9P2000.L.
+func (nineP2000Dotl) MessageType(d Message) (MessageType, error) {
+	switch d.(type) {
+	case *AuthRequestDotu:
+		return Tauth, nil
+	case *AttachRequestDotu:
+		return Tattach, nil
+	case *ErrorResponseDotl:
+		return Rlerror, nil
+	case *StatfsRequestDotl:
+		return Tstatfs, nil
+	case *StatfsResponseDotl:
+		return Rstatfs, nil
+	case *OpenRequestDotl:
+		return Tlopen, nil
+	case *OpenResponseDotl:
+		return Rlopen, nil
+	case *CreateRequestDotl:
+		return Tlcreate, nil
+	case *CreateResponseDotl:
+		return Rlcreate, nil
+	case *RenameRequestDotl:
+		return Trename, nil
+	case *RenameResponseDotl:
+		return Rrename, nil
+	case *ReadLinkRequestDotl:
+		return Treadlink, nil
+	case *ReadLinkResponseDotl:
+		return Rreadlink, nil
+	case *GetAttrRequestDotl:
+		return Tgetattr, nil
+	case *GetAttrResponseDotl:
+		return Rgetattr, nil
+	case *SetAttrRequestDotl:
+		return Tsetattr, nil
+	case *SetAttrResponseDotl:
+		return Rsetattr, nil
+	case *ReadDirRequestDotl:
+		return Treaddir, nil
+	case *ReadDirResponseDotl:
+		return Rreaddir, nil
+	case *MkdirRequestDotl:
+		return Tmkdir, nil
+	case *MkdirResponseDotl:
+		return Rmkdir, nil
+	default:
+		return NineP2000.MessageType(d)
+	}
+}
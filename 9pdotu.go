@@ -85,6 +85,10 @@ func (s *StatDotu) EncodedSize() int {
 }
 
 func (s *StatDotu) Marshal(b []byte) error {
+	if s.EncodedSize()-2 > maxStringSize {
+		return ErrDataTooLong
+	}
+
 	binary.LittleEndian.PutUint16(b[2:4], s.Type)
 	binary.LittleEndian.PutUint32(b[4:8], s.Dev)
 
@@ -239,6 +243,10 @@ func (ar *AuthRequestDotu) EncodedSize() int {
 }
 
 func (ar *AuthRequestDotu) Marshal(b []byte) error {
+	if err := checkStrings(ar.Username, ar.Service); err != nil {
+		return err
+	}
+
 	binary.LittleEndian.PutUint16(b[0:2], uint16(ar.Tag))
 	binary.LittleEndian.PutUint32(b[2:6], uint32(ar.AuthFid))
 
@@ -308,6 +316,10 @@ func (ar *AttachRequestDotu) EncodedSize() int {
 }
 
 func (ar *AttachRequestDotu) Marshal(b []byte) error {
+	if err := checkStrings(ar.Username, ar.Service); err != nil {
+		return err
+	}
+
 	binary.LittleEndian.PutUint16(b[0:2], uint16(ar.Tag))
 	binary.LittleEndian.PutUint32(b[2:6], uint32(ar.Fid))
 	binary.LittleEndian.PutUint32(b[6:10], uint32(ar.AuthFid))
@@ -369,6 +381,10 @@ func (er *ErrorResponseDotu) EncodedSize() int {
 }
 
 func (er *ErrorResponseDotu) Marshal(b []byte) error {
+	if err := checkStrings(er.Error); err != nil {
+		return err
+	}
+
 	binary.LittleEndian.PutUint16(b[0:2], uint16(er.Tag))
 	binary.LittleEndian.PutUint16(b[2:4], uint16(len(er.Error)))
 	copy(b[4:], []byte(er.Error))
@@ -422,6 +438,10 @@ func (cr *CreateRequestDotu) EncodedSize() int {
 }
 
 func (cr *CreateRequestDotu) Marshal(b []byte) error {
+	if err := checkStrings(cr.Name, cr.Extensions); err != nil {
+		return err
+	}
+
 	binary.LittleEndian.PutUint16(b[0:2], uint16(cr.Tag))
 	binary.LittleEndian.PutUint32(b[2:6], uint32(cr.Fid))
 	binary.LittleEndian.PutUint16(b[6:8], uint16(len(cr.Name)))
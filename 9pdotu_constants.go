@@ -3,6 +3,10 @@ package qp
 // VersionDotu is the 9P2000.u version string.
 const VersionDotu = "9P2000.u"
 
+// NONUNAME is the numeric user ID of auth and attach requests naming their
+// user by name only.
+const NONUNAME uint32 = ^uint32(0)
+
 // Permissions bits for 9P2000.u.
 const (
 	DMSYMLINK   FileMode = 0x02000000
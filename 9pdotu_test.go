@@ -1,6 +1,7 @@
 package qp
 
 import (
+	"bytes"
 	"reflect"
 	"testing"
 )
@@ -23,7 +24,7 @@ var PrimitiveTestDataDotu = []PrimitiveTestEntry{
 			Type:       0xDEAD,
 			Dev:        0xABCDEF08,
 			Qid:        Qid{},
-			Mode:       FileMode(OTRUNC),
+			Mode:       0x50,
 			Atime:      90870987,
 			Mtime:      1234124,
 			Length:     0x23ABDDF8,
@@ -120,3 +121,45 @@ func TestReencodeDotu(t *testing.T) {
 		reencode(i, tt.input, tt.reference, t, NineP2000Dotu)
 	}
 }
+
+// TestContainerDotu ensures that the 9P2000.u messages are selected by the
+// protocol when encoding and decoding full messages.
+func TestContainerDotu(t *testing.T) {
+	buf := new(bytes.Buffer)
+	e := Encoder{
+		Protocol: NineP2000Dotu,
+		Writer:   buf,
+	}
+	d := Decoder{
+		Protocol: NineP2000Dotu,
+		Reader:   buf,
+	}
+
+	for i, tt := range MessageTestDataDotu {
+		if err := e.WriteMessage(tt.input); err != nil {
+			t.Fatalf("test %d: encoding failed for %T: %v", i, tt.input, err)
+		}
+		if bytes.Compare(buf.Bytes(), tt.container) != 0 {
+			t.Errorf("test %d: encoded message did not match reference.\nExpected: %#v\n\tGot:      %#v", i, tt.container, buf.Bytes())
+		}
+
+		m, err := d.ReadMessage()
+		if err != nil {
+			t.Fatalf("test %d: decoding failed for %T: %v", i, tt.input, err)
+		}
+		if !CompareMarshallables(tt.input, m) {
+			t.Errorf("test %d: %T did not reencode correctly\n\tExpected: %#v\n\tGot:      %#v", i, tt.input, tt.input, m)
+		}
+	}
+
+	// The base protocol must not decode the 9P2000.u extensions.
+	d.Protocol = NineP2000
+	buf.Write(MessageTestDataDotu[2].container)
+	m, err := d.ReadMessage()
+	if err != nil {
+		t.Fatalf("decoding failed: %v", err)
+	}
+	if _, ok := m.(*ErrorResponse); !ok {
+		t.Errorf("expected *ErrorResponse from 9P2000, got %T", m)
+	}
+}
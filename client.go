@@ -0,0 +1,914 @@
+package qp
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+)
+
+var (
+	// ErrClientClosed indicates that the client has been closed.
+	ErrClientClosed = errors.New("client closed")
+
+	// ErrIncompleteWalk indicates that a walk did not reach its destination.
+	ErrIncompleteWalk = errors.New("walk incomplete")
+
+	// ErrInvalidWalk indicates that a walk response held more qids than the
+	// request held names.
+	ErrInvalidWalk = errors.New("walk response longer than request")
+
+	// ErrUnexpectedResponse indicates that a request was answered with a
+	// response of another type, other than an error response.
+	ErrUnexpectedResponse = errors.New("unexpected response")
+
+	// ErrBusy indicates that a request was not sent, as the limit set by
+	// SetMaxInflight was reached.
+	ErrBusy = errors.New("too many requests in flight")
+
+	// ErrFlushed indicates that a request was aborted by a flush before its
+	// response arrived.
+	ErrFlushed = errors.New("request flushed")
+
+	// ErrVersionRejected indicates that the server did not recognize the
+	// proposed protocol version, answering UnknownVersion.
+	ErrVersionRejected = errors.New("protocol version rejected")
+
+	// ErrUnknownVersion is the former name of ErrVersionRejected.
+	//
+	// Deprecated: Use ErrVersionRejected.
+	ErrUnknownVersion = ErrVersionRejected
+)
+
+// Client is a 9P client. It sends requests with unique tags, and matches the
+// responses read by a background goroutine to the waiting callers. Client is
+// thread safe, and requests may be issued in parallel from arbitrary
+// goroutines, with the exception of Version, which must complete before any
+// other request is sent.
+type Client struct {
+	rwc io.ReadWriteCloser
+	e   *Encoder
+	d   *Decoder
+
+	tags TagPool
+	fids FidPool
+
+	mu      sync.Mutex
+	pending map[Tag]chan Message
+	iounits map[Fid]uint32
+	err     error
+
+	// flushes holds the tags of requests being flushed. The value is set
+	// when the request has completed, and its tag awaits release once the
+	// flush is confirmed.
+	flushes map[Tag]bool
+
+	// closed is closed once the client has failed, as recorded in err.
+	closed chan struct{}
+
+	// inflight and inflightWait hold the limit set by SetMaxInflight, and are
+	// read together. inflight holds a token for every outstanding request, or
+	// is nil if there is no limit. inflightWait is set if requests wait for a
+	// token rather than failing with ErrBusy.
+	inflight     chan struct{}
+	inflightWait bool
+
+	// uidno is the numeric user ID sent by Auth and Attach in 9P2000.u and
+	// 9P2000.L, set by SetUIDno.
+	uidno uint32
+}
+
+// defaultMessageSize is the message size assumed for splitting reads and
+// writes when no message size has been negotiated.
+const defaultMessageSize = 8192
+
+// NewClient returns a Client speaking protocol p over rwc, and starts its
+// read loop. The client owns rwc, which is closed by Close.
+func NewClient(rwc io.ReadWriteCloser, p Protocol) *Client {
+	c := &Client{
+		rwc:     rwc,
+		e:       NewEncoder(p, rwc),
+		d:       NewDecoder(p, rwc),
+		pending: make(map[Tag]chan Message),
+		iounits: make(map[Fid]uint32),
+		flushes: make(map[Tag]bool),
+		closed:  make(chan struct{}),
+		uidno:   NONUNAME,
+	}
+	go c.readLoop()
+	return c
+}
+
+// readLoop reads responses and dispatches them to the waiting callers. When
+// reading fails, all pending and future requests fail with the read error.
+func (c *Client) readLoop() {
+	for {
+		m, err := c.d.ReadMessage()
+		if err != nil {
+			c.fail(err)
+			return
+		}
+
+		c.mu.Lock()
+		ch, ok := c.pending[m.GetTag()]
+		delete(c.pending, m.GetTag())
+		c.mu.Unlock()
+
+		// Responses to unknown tags are dropped.
+		if ok {
+			ch <- m
+		}
+	}
+}
+
+// fail stores err as the client error and wakes all pending callers.
+func (c *Client) fail(err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.err == nil {
+		c.err = err
+		close(c.closed)
+	}
+	for t, ch := range c.pending {
+		close(ch)
+		delete(c.pending, t)
+	}
+}
+
+// SetMaxInflight limits the number of outstanding requests to n, or removes
+// the limit if n is zero or less. Once n requests are outstanding, further
+// requests wait for one of them to complete if wait is set, or fail with
+// ErrBusy otherwise. Flushes are exempt from the limit, so that waiting
+// requests can always be flushed. Requests already outstanding when the limit
+// is changed are not counted against the new limit.
+func (c *Client) SetMaxInflight(n int, wait bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.inflight = nil
+	if n > 0 {
+		c.inflight = make(chan struct{}, n)
+	}
+	c.inflightWait = wait
+}
+
+// SetWriteBuffer buffers the requests of c in a buffer of size bytes, so that
+// requests issued close together, such as the pipelined requests of ReadFile
+// or requests sent from several goroutines, are coalesced into a single write
+// to the connection. A buffered request is not seen by the server, so waiting
+// for its response would deadlock. The buffer is therefore flushed whenever a
+// request starts waiting for its response, and FlushWrites flushes it
+// explicitly. A size of zero or less removes the buffer. SetWriteBuffer must
+// not be called while requests are outstanding, but may be called while
+// keepalives are enabled.
+func (c *Client) SetWriteBuffer(size int) error {
+	// The encoder reads its Writer with the lock held, so writes from other
+	// goroutines, such as keepalives, see either writer.
+	c.e.writeLock.Lock()
+	defer c.e.writeLock.Unlock()
+
+	if err := c.e.flush(); err != nil {
+		return err
+	}
+	if size <= 0 {
+		c.e.Writer = c.rwc
+		return nil
+	}
+	c.e.Writer = bufio.NewWriterSize(c.rwc, size)
+	return nil
+}
+
+// FlushWrites writes the requests buffered since SetWriteBuffer to the
+// connection without waiting for their responses. It is a no-op if requests
+// are not buffered.
+func (c *Client) FlushWrites() error {
+	return c.e.Flush()
+}
+
+// acquire takes a slot for a request if the number of requests is limited,
+// returning the channel to release it to, or nil if there is no limit.
+func (c *Client) acquire() (chan struct{}, error) {
+	c.mu.Lock()
+	sem, wait := c.inflight, c.inflightWait
+	c.mu.Unlock()
+
+	if sem == nil {
+		return nil, nil
+	}
+	if !wait {
+		select {
+		case sem <- struct{}{}:
+			return sem, nil
+		default:
+			return nil, ErrBusy
+		}
+	}
+
+	select {
+	case sem <- struct{}{}:
+		return sem, nil
+	case <-c.closed:
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		return nil, c.err
+	}
+}
+
+// tryAcquire is like acquire, but fails with ErrBusy rather than waiting for a
+// token.
+func (c *Client) tryAcquire() (chan struct{}, error) {
+	c.mu.Lock()
+	sem := c.inflight
+	c.mu.Unlock()
+
+	if sem == nil {
+		return nil, nil
+	}
+	select {
+	case sem <- struct{}{}:
+		return sem, nil
+	default:
+		return nil, ErrBusy
+	}
+}
+
+// rpc is like send, but counts the request against the limit set by
+// SetMaxInflight.
+func (c *Client) rpc(build func(Tag) Message) (Message, error) {
+	sem, err := c.acquire()
+	if err != nil {
+		return nil, err
+	}
+	if sem != nil {
+		defer func() { <-sem }()
+	}
+	return c.send(build)
+}
+
+// send allocates a tag, sends the request built by build with that tag, and
+// waits for the response.
+func (c *Client) send(build func(Tag) Message) (Message, error) {
+	t, err := c.tags.Allocate()
+	if err != nil {
+		return nil, err
+	}
+	defer c.releaseTag(t)
+
+	return c.roundTrip(t, build(t))
+}
+
+// releaseTag releases a tag once its request has completed. If the request is
+// being flushed, the release is left to Flush.
+func (c *Client) releaseTag(t Tag) {
+	c.mu.Lock()
+	if _, ok := c.flushes[t]; ok {
+		c.flushes[t] = true
+		c.mu.Unlock()
+		return
+	}
+	c.mu.Unlock()
+	c.tags.Release(t)
+}
+
+// roundTrip sends the request with tag t, and waits for the response. Error
+// responses are converted to Go errors by AsError.
+func (c *Client) roundTrip(t Tag, req Message) (Message, error) {
+	ch, err := c.start(t, req)
+	if err != nil {
+		return nil, err
+	}
+	return c.wait(ch)
+}
+
+// start sends the request with tag t, returning the channel its response is
+// delivered to.
+func (c *Client) start(t Tag, req Message) (chan Message, error) {
+	ch := make(chan Message, 1)
+
+	c.mu.Lock()
+	if c.err != nil {
+		c.mu.Unlock()
+		return nil, c.err
+	}
+	c.pending[t] = ch
+	c.mu.Unlock()
+
+	if err := c.e.WriteMessage(req); err != nil {
+		c.mu.Lock()
+		delete(c.pending, t)
+		c.mu.Unlock()
+		return nil, err
+	}
+	return ch, nil
+}
+
+// wait waits for the response delivered to ch by the read loop.
+func (c *Client) wait(ch chan Message) (Message, error) {
+	// The request may still be buffered, see SetWriteBuffer.
+	if err := c.e.Flush(); err != nil {
+		c.fail(err)
+	}
+
+	m, ok := <-ch
+	if !ok {
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		if c.err == nil {
+			// The channel was closed by Flush.
+			return nil, ErrFlushed
+		}
+		return nil, c.err
+	}
+
+	if err := AsError(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// unexpected returns an error wrapping ErrUnexpectedResponse for a response
+// of the wrong type.
+func unexpected(m Message) error {
+	return fmt.Errorf("%w %T", ErrUnexpectedResponse, m)
+}
+
+// Version negotiates the message size and protocol version. It must be the
+// first request on a connection. The negotiated message size and version are
+// returned, and requests larger than the negotiated message size are rejected
+// with ErrMessageTooBig from then on.
+func (c *Client) Version(msize uint32, version string) (uint32, string, error) {
+	m, err := c.roundTrip(NOTAG, &VersionRequest{
+		Tag:         NOTAG,
+		MessageSize: msize,
+		Version:     version,
+	})
+	if err != nil {
+		return 0, "", err
+	}
+	r, ok := m.(*VersionResponse)
+	if !ok {
+		return 0, "", unexpected(m)
+	}
+	c.e.MessageSize = r.MessageSize
+	return r.MessageSize, r.Version, nil
+}
+
+// Negotiate negotiates the message size and protocol version like Version,
+// but settles on the smaller of the proposed and the server's message size,
+// and fails with an error wrapping ErrVersionRejected, naming both versions,
+// if the server does not recognize version. A server answering with another
+// version, such as 9P2000 for 9P2000.u, is not rejecting version, and the
+// version it answered is returned.
+// As a version request starts a new session, all fids are forgotten and
+// outstanding requests fail with ErrFlushed.
+func (c *Client) Negotiate(msize uint32, version string) (uint32, string, error) {
+	rmsize, rversion, err := c.Version(msize, version)
+	if err != nil {
+		return 0, "", err
+	}
+	c.reset()
+
+	if rversion == UnknownVersion {
+		return 0, "", fmt.Errorf("%w: proposed %q, server answered %q", ErrVersionRejected, version, rversion)
+	}
+	if rmsize > msize {
+		rmsize = msize
+	}
+	c.e.MessageSize = rmsize
+	return rmsize, rversion, nil
+}
+
+// reset discards the state of the previous session. Pending requests are
+// woken as if flushed, and all fids are returned to the pool.
+func (c *Client) reset() {
+	c.mu.Lock()
+	for t, ch := range c.pending {
+		close(ch)
+		delete(c.pending, t)
+	}
+	c.iounits = make(map[Fid]uint32)
+	c.mu.Unlock()
+
+	c.fids.Reset()
+}
+
+// SetUIDno sets the numeric user ID sent by Auth and Attach when speaking
+// 9P2000.u or 9P2000.L, which is NONUNAME if not set, leaving the user to be
+// named by uname alone. Other protocols have no numeric user IDs, and ignore
+// it. It must not be called while Auth or Attach are in progress.
+func (c *Client) SetUIDno(uid uint32) {
+	c.uidno = uid
+}
+
+// numericUsers reports whether the protocol of the client carries numeric
+// user IDs in auth and attach requests, as 9P2000.u and 9P2000.L do.
+func (c *Client) numericUsers() bool {
+	m, err := c.e.Protocol.Message(Tattach)
+	_, ok := m.(*AttachRequestDotu)
+	return err == nil && ok
+}
+
+// Auth requests authentication of user uname for the file tree aname. An auth
+// fid is allocated and returned together with the auth qid. The auth protocol
+// is then run by reading and writing the auth fid, after which it is passed to
+// Attach. Servers not requiring authentication answer with an error response,
+// returned as a *NineError, in which case Attach is called with NOFID. In
+// 9P2000.u and 9P2000.L, the request carries the user ID set by SetUIDno.
+func (c *Client) Auth(uname, aname string) (Fid, Qid, error) {
+	afid, err := c.fids.Allocate()
+	if err != nil {
+		return NOFID, Qid{}, err
+	}
+
+	m, err := c.rpc(func(t Tag) Message {
+		if c.numericUsers() {
+			return &AuthRequestDotu{
+				Tag:      t,
+				AuthFid:  afid,
+				Username: uname,
+				Service:  aname,
+				UIDno:    c.uidno,
+			}
+		}
+		return &AuthRequest{
+			Tag:      t,
+			AuthFid:  afid,
+			Username: uname,
+			Service:  aname,
+		}
+	})
+	if err != nil {
+		c.fids.Release(afid)
+		return NOFID, Qid{}, err
+	}
+	r, ok := m.(*AuthResponse)
+	if !ok {
+		c.fids.Release(afid)
+		return NOFID, Qid{}, unexpected(m)
+	}
+	return afid, r.AuthQid, nil
+}
+
+// Attach attaches to the file tree aname as user uname, authenticated by
+// afid, which may be NOFID. A fid for the root of the tree is allocated and
+// returned together with its qid. In 9P2000.u and 9P2000.L, the request
+// carries the user ID set by SetUIDno.
+func (c *Client) Attach(afid Fid, uname, aname string) (Fid, Qid, error) {
+	fid, err := c.fids.Allocate()
+	if err != nil {
+		return NOFID, Qid{}, err
+	}
+
+	m, err := c.rpc(func(t Tag) Message {
+		if c.numericUsers() {
+			return &AttachRequestDotu{
+				Tag:      t,
+				Fid:      fid,
+				AuthFid:  afid,
+				Username: uname,
+				Service:  aname,
+				UIDno:    c.uidno,
+			}
+		}
+		return &AttachRequest{
+			Tag:      t,
+			Fid:      fid,
+			AuthFid:  afid,
+			Username: uname,
+			Service:  aname,
+		}
+	})
+	if err != nil {
+		c.fids.Release(fid)
+		return NOFID, Qid{}, err
+	}
+	r, ok := m.(*AttachResponse)
+	if !ok {
+		c.fids.Release(fid)
+		return NOFID, Qid{}, unexpected(m)
+	}
+	return fid, r.Qid, nil
+}
+
+// Walk walks from fid along names, returning a newly allocated fid for the
+// destination and the qids of the walked elements. If only part of the path
+// could be walked, no fid is allocated, and the qids that were walked are
+// returned with ErrIncompleteWalk. At most MAXWELEM names may be walked at
+// once; use WalkPath for longer paths.
+func (c *Client) Walk(fid Fid, names []string) (Fid, []Qid, error) {
+	newfid, err := c.fids.Allocate()
+	if err != nil {
+		return NOFID, nil, err
+	}
+
+	qids, err := c.walk(fid, newfid, names)
+	if err != nil {
+		c.fids.Release(newfid)
+		return NOFID, qids, err
+	}
+	return newfid, qids, nil
+}
+
+// Clone returns a new fid for the same file as fid, by walking zero names.
+// The new fid is independent of fid, and must be clunked separately.
+func (c *Client) Clone(fid Fid) (Fid, error) {
+	newfid, _, err := c.Walk(fid, nil)
+	return newfid, err
+}
+
+// WalkPath is like Walk, but walks paths of any length by splitting them with
+// SplitWalk and chaining the walks through the new fid. If a later walk fails,
+// the new fid is clunked before the error is returned.
+func (c *Client) WalkPath(fid Fid, names []string) (Fid, []Qid, error) {
+	groups := SplitWalk(names)
+	newfid, qids, err := c.Walk(fid, groups[0])
+	if err != nil {
+		return NOFID, qids, err
+	}
+
+	for _, g := range groups[1:] {
+		q, err := c.walk(newfid, newfid, g)
+		qids = append(qids, q...)
+		if err != nil {
+			// A failed walk leaves the fid where it was, so it still needs
+			// to be clunked.
+			c.Clunk(newfid)
+			return NOFID, qids, err
+		}
+	}
+	return newfid, qids, nil
+}
+
+// walk walks from fid to newfid along names. ErrIncompleteWalk is returned
+// with the walked qids if only part of the path could be walked.
+func (c *Client) walk(fid, newfid Fid, names []string) ([]Qid, error) {
+	m, err := c.rpc(func(t Tag) Message {
+		return &WalkRequest{
+			Tag:    t,
+			Fid:    fid,
+			NewFid: newfid,
+			Names:  names,
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+	r, ok := m.(*WalkResponse)
+	if !ok {
+		return nil, unexpected(m)
+	}
+	if len(r.Qids) > len(names) {
+		return nil, ErrInvalidWalk
+	}
+	if len(r.Qids) < len(names) {
+		return r.Qids, ErrIncompleteWalk
+	}
+	return r.Qids, nil
+}
+
+// WalkSucceeded reports whether r walks all the names of t. A walk failing
+// partway returns fewer qids than names, in which case the new fid was not
+// allocated by the server. A walk of zero names always succeeds.
+func WalkSucceeded(t *WalkRequest, r *WalkResponse) bool {
+	return len(r.Qids) == len(t.Names)
+}
+
+// Open opens fid with the provided mode, returning the qid and iounit of the
+// opened file. The mode is checked with ValidateOpenMode before the request is
+// sent.
+func (c *Client) Open(fid Fid, mode OpenMode) (Qid, uint32, error) {
+	if err := ValidateOpenMode(mode); err != nil {
+		return Qid{}, 0, err
+	}
+
+	m, err := c.rpc(func(t Tag) Message {
+		return &OpenRequest{
+			Tag:  t,
+			Fid:  fid,
+			Mode: mode,
+		}
+	})
+	if err != nil {
+		return Qid{}, 0, err
+	}
+	r, ok := m.(*OpenResponse)
+	if !ok {
+		return Qid{}, 0, unexpected(m)
+	}
+
+	c.mu.Lock()
+	c.iounits[fid] = r.IOUnit
+	c.mu.Unlock()
+
+	return r.Qid, r.IOUnit, nil
+}
+
+// ChunkSize returns the largest payload of a single read or write, given the
+// negotiated message size and the iounit returned when opening the file. A
+// non-zero iounit smaller than what fits in msize is preferred. Zero is
+// returned if msize cannot hold any payload. With an iounit of zero, it is the
+// largest payload of a read response or write request fitting in msize, being
+// msize minus IOHeaderSize. Reading or writing more fails, as the message would
+// exceed msize once its header is added.
+func ChunkSize(msize, iounit uint32) uint32 {
+	return chunkSize(msize, iounit, IOHeaderSize)
+}
+
+// chunkSize is like ChunkSize, but for messages with the given overhead.
+func chunkSize(msize, iounit uint32, overhead int) uint32 {
+	if msize <= uint32(overhead) {
+		return 0
+	}
+	n := msize - uint32(overhead)
+	if iounit > 0 && iounit < n {
+		n = iounit
+	}
+	return n
+}
+
+// chunkSize returns the largest amount of data to transfer in a single read or
+// write on fid, given the overhead of the message carrying it. It is bounded
+// by the iounit of the fid, if known, and by the negotiated message size.
+// Reads and writes use their exact overhead rather than IOHeaderSize, so a
+// read response may use the full message size.
+func (c *Client) chunkSize(fid Fid, overhead int) uint32 {
+	msize := c.e.MessageSize
+	if msize == 0 {
+		msize = defaultMessageSize
+	}
+
+	c.mu.Lock()
+	iounit := c.iounits[fid]
+	c.mu.Unlock()
+
+	return chunkSize(msize, iounit, overhead)
+}
+
+// Read reads up to count bytes from fid at offset.
+func (c *Client) Read(fid Fid, offset uint64, count uint32) ([]byte, error) {
+	m, err := c.rpc(func(t Tag) Message {
+		return &ReadRequest{
+			Tag:    t,
+			Fid:    fid,
+			Offset: offset,
+			Count:  count,
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+	r, ok := m.(*ReadResponse)
+	if !ok {
+		return nil, unexpected(m)
+	}
+	return r.Data, nil
+}
+
+// ReadAll reads fid from the start until the server returns no more data.
+// Each read requests as much as fits in a single response. Short reads are
+// continued at the offset they ended.
+func (c *Client) ReadAll(fid Fid) ([]byte, error) {
+	return c.readAll(fid, 0, nil)
+}
+
+// readAll is like ReadAll, but starts reading at offset, appending to data.
+func (c *Client) readAll(fid Fid, offset uint64, data []byte) ([]byte, error) {
+	count := c.chunkSize(fid, ReadOverhead)
+	if count == 0 {
+		return data, ErrMessageTooBig
+	}
+
+	for {
+		b, err := c.Read(fid, offset, count)
+		if err != nil {
+			return data, err
+		}
+		if len(b) == 0 {
+			return data, nil
+		}
+		data = append(data, b...)
+		offset += uint64(len(b))
+	}
+}
+
+// Write writes data to fid at offset, returning the amount of bytes written.
+func (c *Client) Write(fid Fid, offset uint64, data []byte) (uint32, error) {
+	m, err := c.rpc(func(t Tag) Message {
+		return &WriteRequest{
+			Tag:    t,
+			Fid:    fid,
+			Offset: offset,
+			Data:   data,
+		}
+	})
+	if err != nil {
+		return 0, err
+	}
+	r, ok := m.(*WriteResponse)
+	if !ok {
+		return 0, unexpected(m)
+	}
+	return r.Count, nil
+}
+
+// Flush aborts the request with tag oldtag, and waits for the server to
+// confirm. A flushed request may still have been answered before the flush
+// was handled by the server, in which case the response is delivered
+// normally. Otherwise, the server never answers the request, and it fails
+// with ErrFlushed once the flush is confirmed. Either way, the tag of the
+// flushed request remains allocated until the flush is confirmed, so that it
+// cannot be reused while the server may still answer it.
+func (c *Client) Flush(oldtag Tag) error {
+	c.mu.Lock()
+	if _, ok := c.flushes[oldtag]; ok {
+		c.mu.Unlock()
+		return errors.New("tag already being flushed")
+	}
+	c.flushes[oldtag] = false
+	c.mu.Unlock()
+	defer c.flushDone(oldtag)
+
+	m, err := c.send(func(t Tag) Message {
+		return &FlushRequest{
+			Tag:    t,
+			OldTag: oldtag,
+		}
+	})
+	if err != nil {
+		return err
+	}
+	if _, ok := m.(*FlushResponse); !ok {
+		return unexpected(m)
+	}
+
+	// Responses are read in order, so if the flushed request had been
+	// answered, it would have been dispatched before the flush response.
+	c.mu.Lock()
+	if ch, ok := c.pending[oldtag]; ok {
+		delete(c.pending, oldtag)
+		close(ch)
+	}
+	c.mu.Unlock()
+	return nil
+}
+
+// flushDone ends the flush of oldtag, releasing the tag if its request has
+// already completed.
+func (c *Client) flushDone(oldtag Tag) {
+	c.mu.Lock()
+	done := c.flushes[oldtag]
+	delete(c.flushes, oldtag)
+	c.mu.Unlock()
+
+	if done {
+		c.tags.Release(oldtag)
+	}
+}
+
+// WriteAll writes data to fid at offset, split into as many writes as needed
+// to fit each in a single request. It stops early if the server writes less
+// than it was sent, and returns the total amount of bytes written, which is
+// less than len(data) after a short write.
+func (c *Client) WriteAll(fid Fid, offset uint64, data []byte) (uint64, error) {
+	size := int(c.chunkSize(fid, WriteOverhead))
+	if size == 0 && len(data) > 0 {
+		return 0, ErrMessageTooBig
+	}
+
+	var total uint64
+	for len(data) > 0 {
+		chunk := data
+		if len(chunk) > size {
+			chunk = chunk[:size]
+		}
+
+		n, err := c.Write(fid, offset+total, chunk)
+		total += uint64(n)
+		if err != nil {
+			return total, err
+		}
+		if int(n) < len(chunk) {
+			return total, nil
+		}
+		data = data[len(chunk):]
+	}
+	return total, nil
+}
+
+// Clunk clunks fid. The fid is released for reuse even if an error is
+// returned, as the server forgets the fid regardless.
+func (c *Client) Clunk(fid Fid) error {
+	return c.clunk(fid, c.rpc)
+}
+
+// clunk clunks fid, issuing the request through call, which is either rpc or
+// send.
+func (c *Client) clunk(fid Fid, call func(func(Tag) Message) (Message, error)) error {
+	defer c.fids.Release(fid)
+
+	c.mu.Lock()
+	delete(c.iounits, fid)
+	c.mu.Unlock()
+
+	m, err := call(func(t Tag) Message {
+		return &ClunkRequest{
+			Tag: t,
+			Fid: fid,
+		}
+	})
+	if err != nil {
+		return err
+	}
+	if _, ok := m.(*ClunkResponse); !ok {
+		return unexpected(m)
+	}
+	return nil
+}
+
+// Remove removes the file represented by fid. A remove request clunks the fid
+// even if the removal fails, so the fid is invalid afterwards and is released
+// for reuse regardless of the outcome. It must not be clunked again.
+func (c *Client) Remove(fid Fid) error {
+	defer c.fids.Release(fid)
+
+	c.mu.Lock()
+	delete(c.iounits, fid)
+	c.mu.Unlock()
+
+	m, err := c.rpc(func(t Tag) Message {
+		return &RemoveRequest{
+			Tag: t,
+			Fid: fid,
+		}
+	})
+	if err != nil {
+		return err
+	}
+	if _, ok := m.(*RemoveResponse); !ok {
+		return unexpected(m)
+	}
+	return nil
+}
+
+// Stat returns the stat of the file represented by fid.
+func (c *Client) Stat(fid Fid) (Stat, error) {
+	m, err := c.rpc(func(t Tag) Message {
+		return &StatRequest{
+			Tag: t,
+			Fid: fid,
+		}
+	})
+	if err != nil {
+		return Stat{}, err
+	}
+	r, ok := m.(*StatResponse)
+	if !ok {
+		return Stat{}, unexpected(m)
+	}
+	return r.Stat, nil
+}
+
+// closeTimeout is how long Close waits for the fids to be clunked.
+const closeTimeout = time.Second
+
+// Close clunks all fids still allocated, and closes the underlying
+// connection. The clunks are sent in parallel, exempt from the limit set by
+// SetMaxInflight, and errors are ignored. If they have not completed within a
+// second, the connection is closed regardless. If the connection has already
+// failed, no clunks are sent. Pending and future requests fail with
+// ErrClientClosed.
+func (c *Client) Close() error {
+	c.mu.Lock()
+	broken := c.err != nil
+	c.mu.Unlock()
+
+	if !broken {
+		var wg sync.WaitGroup
+		for _, fid := range c.fids.Allocated() {
+			wg.Add(1)
+			go func(fid Fid) {
+				defer wg.Done()
+				c.clunk(fid, c.send)
+			}(fid)
+		}
+
+		done := make(chan struct{})
+		go func() {
+			wg.Wait()
+			close(done)
+		}()
+
+		timer := time.NewTimer(closeTimeout)
+		select {
+		case <-done:
+		case <-timer.C:
+		}
+		timer.Stop()
+	}
+
+	c.fail(ErrClientClosed)
+	return c.rwc.Close()
+}
@@ -0,0 +1,1028 @@
+package qp
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// serveFunc runs a fake server on one end of a pipe, answering each request
+// with the response returned by handle. Requests are handled concurrently, so
+// responses may be sent out of order. It returns the client end of the pipe.
+func serveFunc(handle func(req Message, tag Tag) Message) net.Conn {
+	cc, sc := net.Pipe()
+	go func() {
+		d := NewDecoder(NineP2000, sc)
+		e := NewEncoder(NineP2000, sc)
+		for {
+			m, err := d.ReadMessage()
+			if err != nil {
+				sc.Close()
+				return
+			}
+			go func(m Message) {
+				if r := handle(m, m.GetTag()); r != nil {
+					e.WriteMessage(r)
+				}
+			}(m)
+		}
+	}()
+	return cc
+}
+
+func TestClient(t *testing.T) {
+	root := Qid{Type: QTDIR, Version: 1, Path: 1}
+	walked := []Qid{
+		{Type: QTDIR, Version: 2, Path: 2},
+		{Type: QTFILE, Version: 3, Path: 3},
+	}
+	var written []byte
+
+	c := NewClient(serveFunc(func(req Message, tag Tag) Message {
+		switch r := req.(type) {
+		case *VersionRequest:
+			return &VersionResponse{Tag: tag, MessageSize: 4096, Version: r.Version}
+		case *AttachRequest:
+			return &AttachResponse{Tag: tag, Qid: root}
+		case *WalkRequest:
+			if len(r.Names) > 0 && r.Names[0] == "missing" {
+				return &ErrorResponse{Tag: tag, Error: "file not found"}
+			}
+			if len(r.Names) > len(walked) || len(r.Names) > 0 && r.Names[0] == "bogus" {
+				return &WalkResponse{Tag: tag, Qids: walked}
+			}
+			return &WalkResponse{Tag: tag, Qids: walked[:len(r.Names)]}
+		case *OpenRequest:
+			return &OpenResponse{Tag: tag, Qid: walked[1], IOUnit: 1024}
+		case *ReadRequest:
+			data := make([]byte, 8)
+			binary.LittleEndian.PutUint64(data, r.Offset)
+			return &ReadResponse{Tag: tag, Data: data}
+		case *WriteRequest:
+			written = r.Data
+			return &WriteResponse{Tag: tag, Count: uint32(len(r.Data))}
+		case *ClunkRequest:
+			return &ClunkResponse{Tag: tag}
+		}
+		return &ErrorResponse{Tag: tag, Error: "unsupported"}
+	}), NineP2000)
+	defer c.Close()
+
+	msize, version, err := c.Version(8192, Version)
+	if err != nil {
+		t.Fatalf("version failed: %v", err)
+	}
+	if msize != 4096 || version != Version {
+		t.Errorf("version: got %d %s, expected 4096 %s", msize, version, Version)
+	}
+
+	fid, qid, err := c.Attach(NOFID, "glenda", "")
+	if err != nil {
+		t.Fatalf("attach failed: %v", err)
+	}
+	if qid != root {
+		t.Errorf("attach: got qid %v, expected %v", qid, root)
+	}
+
+	newfid, qids, err := c.Walk(fid, []string{"usr", "local"})
+	if err != nil {
+		t.Fatalf("walk failed: %v", err)
+	}
+	if newfid == fid {
+		t.Errorf("walk: newfid equals fid %d", fid)
+	}
+	if len(qids) != 2 || qids[0] != walked[0] || qids[1] != walked[1] {
+		t.Errorf("walk: got qids %v, expected %v", qids, walked)
+	}
+
+	if _, qids, err = c.Walk(fid, []string{"usr", "local", "bin"}); err != ErrIncompleteWalk {
+		t.Errorf("incomplete walk: expected %v, got %v", ErrIncompleteWalk, err)
+	}
+	if len(qids) != 2 {
+		t.Errorf("incomplete walk: got %d qids, expected 2", len(qids))
+	}
+
+	if _, _, err = c.Walk(fid, []string{"bogus"}); err != ErrInvalidWalk {
+		t.Errorf("walk with excess qids: expected %v, got %v", ErrInvalidWalk, err)
+	}
+
+	if _, _, err = c.Walk(fid, []string{"missing"}); err == nil || err.Error() != "file not found" {
+		t.Errorf("failed walk: expected error \"file not found\", got %v", err)
+	}
+
+	qid, iounit, err := c.Open(newfid, OREAD)
+	if err != nil {
+		t.Fatalf("open failed: %v", err)
+	}
+	if qid != walked[1] || iounit != 1024 {
+		t.Errorf("open: got %v %d, expected %v 1024", qid, iounit, walked[1])
+	}
+
+	data, err := c.Read(newfid, 42, 8)
+	if err != nil {
+		t.Fatalf("read failed: %v", err)
+	}
+	if binary.LittleEndian.Uint64(data) != 42 {
+		t.Errorf("read: got %v, expected offset 42 echoed", data)
+	}
+
+	n, err := c.Write(newfid, 0, []byte("hello"))
+	if err != nil {
+		t.Fatalf("write failed: %v", err)
+	}
+	if n != 5 || !bytes.Equal(written, []byte("hello")) {
+		t.Errorf("write: got %d %q, expected 5 \"hello\"", n, written)
+	}
+
+	if _, err := c.Write(newfid, 0, make([]byte, 4096)); err != ErrMessageTooBig {
+		t.Errorf("write larger than msize: expected %v, got %v", ErrMessageTooBig, err)
+	}
+
+	if err := c.Clunk(newfid); err != nil {
+		t.Errorf("clunk failed: %v", err)
+	}
+}
+
+func TestClientConcurrent(t *testing.T) {
+	c := NewClient(serveFunc(func(req Message, tag Tag) Message {
+		r := req.(*ReadRequest)
+		// Delay responses in reverse order of their offsets, to ensure that
+		// responses arrive out of order.
+		time.Sleep(time.Duration(32-r.Offset) * time.Millisecond)
+		data := make([]byte, 8)
+		binary.LittleEndian.PutUint64(data, r.Offset)
+		return &ReadResponse{Tag: tag, Data: data}
+	}), NineP2000)
+	defer c.Close()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 32; i++ {
+		wg.Add(1)
+		go func(offset uint64) {
+			defer wg.Done()
+			data, err := c.Read(0, offset, 8)
+			if err != nil {
+				t.Errorf("read %d failed: %v", offset, err)
+				return
+			}
+			if got := binary.LittleEndian.Uint64(data); got != offset {
+				t.Errorf("read %d: got response for %d", offset, got)
+			}
+		}(uint64(i))
+	}
+	wg.Wait()
+}
+
+func TestClientClose(t *testing.T) {
+	// The server never answers.
+	c := NewClient(serveFunc(func(Message, Tag) Message { return nil }), NineP2000)
+
+	errch := make(chan error, 1)
+	go func() {
+		_, err := c.Read(0, 0, 8)
+		errch <- err
+	}()
+
+	// Give the read a chance to be sent.
+	time.Sleep(10 * time.Millisecond)
+	c.Close()
+
+	select {
+	case err := <-errch:
+		if err != ErrClientClosed {
+			t.Errorf("expected %v, got %v", ErrClientClosed, err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("pending request not woken by close")
+	}
+
+	if _, err := c.Read(0, 0, 8); err != ErrClientClosed {
+		t.Errorf("expected %v after close, got %v", ErrClientClosed, err)
+	}
+}
+
+func TestClientWalkPath(t *testing.T) {
+	var (
+		mu      sync.Mutex
+		clunked []Fid
+	)
+
+	c := NewClient(serveFunc(func(req Message, tag Tag) Message {
+		switch r := req.(type) {
+		case *WalkRequest:
+			if len(r.Names) > MAXWELEM {
+				return &ErrorResponse{Tag: tag, Error: "too many names"}
+			}
+			qids := make([]Qid, 0, len(r.Names))
+			for _, n := range r.Names {
+				if n == "missing" {
+					break
+				}
+				qids = append(qids, Qid{Path: uint64(len(qids))})
+			}
+			return &WalkResponse{Tag: tag, Qids: qids}
+		case *ClunkRequest:
+			mu.Lock()
+			clunked = append(clunked, r.Fid)
+			mu.Unlock()
+			return &ClunkResponse{Tag: tag}
+		}
+		return &ErrorResponse{Tag: tag, Error: "unsupported"}
+	}), NineP2000)
+	defer c.Close()
+
+	path := make([]string, 2*MAXWELEM+3)
+	for i := range path {
+		path[i] = "d"
+	}
+
+	fid, qids, err := c.WalkPath(0, path)
+	if err != nil {
+		t.Fatalf("walk failed: %v", err)
+	}
+	if len(qids) != len(path) {
+		t.Errorf("got %d qids, expected %d", len(qids), len(path))
+	}
+	if len(clunked) != 0 {
+		t.Errorf("successful walk clunked fids %v", clunked)
+	}
+
+	// An empty path clones the fid.
+	if _, qids, err := c.WalkPath(fid, nil); err != nil || len(qids) != 0 {
+		t.Errorf("clone walk: got %v, %v", qids, err)
+	}
+
+	// Failing in the second group clunks the new fid.
+	path[MAXWELEM+1] = "missing"
+	fid, qids, err = c.WalkPath(0, path)
+	if err != ErrIncompleteWalk {
+		t.Fatalf("expected %v, got %v", ErrIncompleteWalk, err)
+	}
+	if fid != NOFID {
+		t.Errorf("failed walk returned fid %d", fid)
+	}
+	if len(qids) != MAXWELEM+1 {
+		t.Errorf("got %d qids, expected %d", len(qids), MAXWELEM+1)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if len(clunked) != 1 {
+		t.Errorf("expected one fid to be clunked, got %v", clunked)
+	}
+}
+
+func TestClientReadAll(t *testing.T) {
+	payload := make([]byte, 10000)
+	for i := range payload {
+		payload[i] = byte(i)
+	}
+
+	var (
+		mu     sync.Mutex
+		counts []uint32
+	)
+	c := NewClient(serveFunc(func(req Message, tag Tag) Message {
+		switch r := req.(type) {
+		case *VersionRequest:
+			return &VersionResponse{Tag: tag, MessageSize: r.MessageSize, Version: r.Version}
+		case *OpenRequest:
+			return &OpenResponse{Tag: tag, IOUnit: 100}
+		case *ReadRequest:
+			mu.Lock()
+			counts = append(counts, r.Count)
+			mu.Unlock()
+			if r.Fid == 1 && r.Offset > 0 {
+				return &ErrorResponse{Tag: tag, Error: "i/o error"}
+			}
+			if r.Offset >= uint64(len(payload)) {
+				return &ReadResponse{Tag: tag}
+			}
+			// Return short reads, to be continued by the client.
+			end := r.Offset + uint64(r.Count)/2
+			if end > uint64(len(payload)) {
+				end = uint64(len(payload))
+			}
+			return &ReadResponse{Tag: tag, Data: payload[r.Offset:end]}
+		}
+		return &ErrorResponse{Tag: tag, Error: "unsupported"}
+	}), NineP2000)
+	defer c.Close()
+
+	if _, _, err := c.Version(1024, Version); err != nil {
+		t.Fatalf("version failed: %v", err)
+	}
+
+	data, err := c.ReadAll(0)
+	if err != nil {
+		t.Fatalf("read failed: %v", err)
+	}
+	if !bytes.Equal(data, payload) {
+		t.Errorf("read %d bytes not matching payload of %d bytes", len(data), len(payload))
+	}
+	for _, n := range counts {
+		if n != 1024-ReadOverhead {
+			t.Errorf("requested %d bytes, expected %d", n, 1024-ReadOverhead)
+		}
+	}
+
+	// The iounit bounds the request size.
+	counts = nil
+	if _, _, err := c.Open(2, OREAD); err != nil {
+		t.Fatalf("open failed: %v", err)
+	}
+	if _, err := c.ReadAll(2); err != nil {
+		t.Fatalf("read failed: %v", err)
+	}
+	for _, n := range counts {
+		if n != 100 {
+			t.Errorf("requested %d bytes, expected iounit 100", n)
+		}
+	}
+
+	if _, err := c.ReadAll(1); err == nil || err.Error() != "i/o error" {
+		t.Errorf("expected error \"i/o error\", got %v", err)
+	}
+}
+
+func TestClientWriteAll(t *testing.T) {
+	const chunk = 1024 - WriteOverhead
+
+	var (
+		mu     sync.Mutex
+		file   []byte
+		writes int
+	)
+	c := NewClient(serveFunc(func(req Message, tag Tag) Message {
+		switch r := req.(type) {
+		case *VersionRequest:
+			return &VersionResponse{Tag: tag, MessageSize: r.MessageSize, Version: r.Version}
+		case *WriteRequest:
+			mu.Lock()
+			defer mu.Unlock()
+			writes++
+			if len(r.Data) > chunk {
+				return &ErrorResponse{Tag: tag, Error: "message too large"}
+			}
+			if r.Offset != uint64(len(file)) {
+				return &ErrorResponse{Tag: tag, Error: "unexpected offset"}
+			}
+			data := r.Data
+			// Fid 1 is a device that accepts only 10 bytes per write.
+			if r.Fid == 1 && len(data) > 10 {
+				data = data[:10]
+			}
+			file = append(file, data...)
+			return &WriteResponse{Tag: tag, Count: uint32(len(data))}
+		}
+		return &ErrorResponse{Tag: tag, Error: "unsupported"}
+	}), NineP2000)
+	defer c.Close()
+
+	if _, _, err := c.Version(1024, Version); err != nil {
+		t.Fatalf("version failed: %v", err)
+	}
+
+	tests := []struct {
+		size   int
+		writes int
+	}{
+		{0, 0},
+		{chunk, 1},
+		{chunk + 1, 2},
+		{3*chunk + 5, 4},
+	}
+
+	for i, tt := range tests {
+		file, writes = nil, 0
+		data := bytes.Repeat([]byte{byte(i)}, tt.size)
+
+		n, err := c.WriteAll(0, 0, data)
+		if err != nil {
+			t.Fatalf("test %d: write failed: %v", i, err)
+		}
+		if n != uint64(tt.size) {
+			t.Errorf("test %d: wrote %d bytes, expected %d", i, n, tt.size)
+		}
+		if writes != tt.writes {
+			t.Errorf("test %d: used %d writes, expected %d", i, writes, tt.writes)
+		}
+		if !bytes.Equal(file, data) {
+			t.Errorf("test %d: written data did not match", i)
+		}
+	}
+
+	// A short write stops early.
+	file, writes = nil, 0
+	n, err := c.WriteAll(1, 0, make([]byte, 2*chunk))
+	if err != nil {
+		t.Fatalf("short write failed: %v", err)
+	}
+	if n != 10 || writes != 1 {
+		t.Errorf("short write: wrote %d bytes in %d writes, expected 10 in 1", n, writes)
+	}
+}
+
+func TestClientFlush(t *testing.T) {
+	var (
+		reads   = make(chan *ReadRequest, 1)
+		replies = make(chan Message)
+		flushes = make(chan *FlushRequest, 1)
+		answer  = make(chan Message)
+		opens   = make(chan Tag, 1)
+	)
+	c := NewClient(serveFunc(func(req Message, tag Tag) Message {
+		switch r := req.(type) {
+		case *ReadRequest:
+			reads <- r
+			return <-replies
+		case *FlushRequest:
+			flushes <- r
+			return <-answer
+		case *OpenRequest:
+			opens <- tag
+			return &ErrorResponse{Tag: tag, Error: "not implemented"}
+		}
+		return &ErrorResponse{Tag: tag, Error: "unsupported"}
+	}), NineP2000)
+	defer c.Close()
+
+	// A request that is never answered fails with ErrFlushed.
+	errch := make(chan error, 1)
+	go func() {
+		_, err := c.Read(0, 0, 8)
+		errch <- err
+	}()
+	r := <-reads
+
+	flushErr := make(chan error, 1)
+	go func() { flushErr <- c.Flush(r.Tag) }()
+	f := <-flushes
+	if f.OldTag != r.Tag {
+		t.Fatalf("flush of tag %d sent for tag %d", r.Tag, f.OldTag)
+	}
+	replies <- nil
+	answer <- &FlushResponse{Tag: f.Tag}
+
+	if err := <-flushErr; err != nil {
+		t.Fatalf("flush failed: %v", err)
+	}
+	if err := <-errch; err != ErrFlushed {
+		t.Errorf("expected %v, got %v", ErrFlushed, err)
+	}
+
+	// A request answered before the flush is handled completes normally,
+	// but its tag is held until the flush is confirmed.
+	go func() {
+		_, err := c.Read(0, 0, 8)
+		errch <- err
+	}()
+	r = <-reads
+
+	go func() { flushErr <- c.Flush(r.Tag) }()
+	f = <-flushes
+	replies <- &ReadResponse{Tag: r.Tag, Data: []byte("x")}
+	if err := <-errch; err != nil {
+		t.Errorf("flushed request answered before flush failed: %v", err)
+	}
+
+	c.Open(0, OREAD)
+	if tag := <-opens; tag == r.Tag {
+		t.Errorf("tag %d reused before flush was confirmed", tag)
+	}
+
+	answer <- &FlushResponse{Tag: f.Tag}
+	if err := <-flushErr; err != nil {
+		t.Fatalf("flush failed: %v", err)
+	}
+
+	// Once confirmed, the tag is released for reuse.
+	c.Open(0, OREAD)
+	if tag := <-opens; tag != r.Tag {
+		t.Errorf("expected tag %d to be reused after flush, got %d", r.Tag, tag)
+	}
+}
+
+func TestClientNegotiate(t *testing.T) {
+	var (
+		reads   = make(chan *ReadRequest, 1)
+		replies = make(chan Message)
+	)
+	c := NewClient(serveFunc(func(req Message, tag Tag) Message {
+		switch r := req.(type) {
+		case *VersionRequest:
+			if r.Version != Version {
+				return &VersionResponse{Tag: tag, MessageSize: r.MessageSize, Version: UnknownVersion}
+			}
+			return &VersionResponse{Tag: tag, MessageSize: 16384, Version: Version}
+		case *AttachRequest:
+			return &AttachResponse{Tag: tag}
+		case *ReadRequest:
+			reads <- r
+			return <-replies
+		}
+		return &ErrorResponse{Tag: tag, Error: "unsupported"}
+	}), NineP2000)
+	defer c.Close()
+
+	_, _, err := c.Negotiate(8192, "9P3000")
+	if !errors.Is(err, ErrVersionRejected) {
+		t.Errorf("expected %v, got %v", ErrVersionRejected, err)
+	}
+	if expected := `protocol version rejected: proposed "9P3000", server answered "unknown"`; err == nil || err.Error() != expected {
+		t.Errorf("got error %q, expected %q", err, expected)
+	}
+
+	msize, version, err := c.Negotiate(8192, Version)
+	if err != nil {
+		t.Fatalf("negotiate failed: %v", err)
+	}
+	if msize != 8192 || version != Version {
+		t.Errorf("got msize %d and version %q, expected 8192 and %q", msize, version, Version)
+	}
+
+	root, _, err := c.Attach(NOFID, "glenda", "")
+	if err != nil {
+		t.Fatalf("attach failed: %v", err)
+	}
+
+	// Renegotiating aborts outstanding requests and forgets all fids.
+	errch := make(chan error, 1)
+	go func() {
+		_, err := c.Read(root, 0, 8)
+		errch <- err
+	}()
+	<-reads
+
+	if _, _, err := c.Negotiate(8192, Version); err != nil {
+		t.Fatalf("renegotiate failed: %v", err)
+	}
+	if err := <-errch; err != ErrFlushed {
+		t.Errorf("expected %v for aborted request, got %v", ErrFlushed, err)
+	}
+	replies <- nil
+
+	fid, _, err := c.Attach(NOFID, "glenda", "")
+	if err != nil {
+		t.Fatalf("attach failed: %v", err)
+	}
+	if fid != root {
+		t.Errorf("got fid %d after renegotiation, expected %d to be reused", fid, root)
+	}
+}
+
+func TestClientNegotiateDowngrade(t *testing.T) {
+	c := NewClient(serveFunc(func(req Message, tag Tag) Message {
+		return &VersionResponse{Tag: tag, MessageSize: 4096, Version: Version}
+	}), NineP2000)
+	defer c.Close()
+
+	msize, version, err := c.Negotiate(8192, VersionDotu)
+	if err != nil {
+		t.Fatalf("downgrade rejected: %v", err)
+	}
+	if msize != 4096 || version != Version {
+		t.Errorf("got msize %d and version %q, expected 4096 and %q", msize, version, Version)
+	}
+}
+
+func TestChunkSize(t *testing.T) {
+	tests := []struct {
+		msize, iounit, expected uint32
+	}{
+		{8192, 0, 8192 - IOHeaderSize},
+		{8192, 4096, 4096},
+		{8192, 8192, 8192 - IOHeaderSize},
+		{IOHeaderSize + 1, 0, 1},
+		{IOHeaderSize, 0, 0},
+		{0, 4096, 0},
+	}
+	for _, tt := range tests {
+		if n := ChunkSize(tt.msize, tt.iounit); n != tt.expected {
+			t.Errorf("ChunkSize(%d, %d) = %d, expected %d", tt.msize, tt.iounit, n, tt.expected)
+		}
+	}
+}
+
+func TestChunkSizeFits(t *testing.T) {
+	// The largest payload fits in msize in both directions.
+	var buf bytes.Buffer
+	e := NewEncoder(NineP2000, &buf)
+	e.MessageSize = 8192
+	data := make([]byte, ChunkSize(8192, 0))
+	if err := e.WriteMessage(&WriteRequest{Tag: 1, Data: data}); err != nil {
+		t.Errorf("write request: %v", err)
+	}
+	if err := e.WriteMessage(&ReadResponse{Tag: 1, Data: data}); err != nil {
+		t.Errorf("read response: %v", err)
+	}
+	if err := e.WriteMessage(&WriteRequest{Tag: 1, Data: append(data, 0)}); err != ErrMessageTooBig {
+		t.Errorf("oversized write request: expected %v, got %v", ErrMessageTooBig, err)
+	}
+}
+
+func TestWalkSucceeded(t *testing.T) {
+	q := Qid{Type: QTDIR}
+	tests := []struct {
+		names []string
+		qids  []Qid
+		want  bool
+	}{
+		{nil, nil, true},
+		{[]string{"usr"}, []Qid{q}, true},
+		{[]string{"usr", "local"}, []Qid{q, q}, true},
+		{[]string{"usr", "local"}, []Qid{q}, false},
+		{[]string{"usr"}, nil, false},
+		{[]string{"usr"}, []Qid{q, q}, false},
+	}
+	for _, tt := range tests {
+		got := WalkSucceeded(&WalkRequest{Names: tt.names}, &WalkResponse{Qids: tt.qids})
+		if got != tt.want {
+			t.Errorf("%d names, %d qids: got %t, expected %t", len(tt.names), len(tt.qids), got, tt.want)
+		}
+	}
+}
+
+func TestClientAuth(t *testing.T) {
+	aqid := Qid{Type: QTAUTH, Path: 7}
+	var attachAfid Fid
+	c := NewClient(serveFunc(func(req Message, tag Tag) Message {
+		switch r := req.(type) {
+		case *AuthRequest:
+			if r.Username != "glenda" {
+				return &ErrorResponse{Tag: tag, Error: "authentication not required"}
+			}
+			return &AuthResponse{Tag: tag, AuthQid: aqid}
+		case *AttachRequest:
+			attachAfid = r.AuthFid
+			return &AttachResponse{Tag: tag, Qid: Qid{Type: QTDIR}}
+		}
+		return &ErrorResponse{Tag: tag, Error: "unsupported"}
+	}), NineP2000)
+	defer c.Close()
+
+	afid, qid, err := c.Auth("glenda", "")
+	if err != nil {
+		t.Fatalf("auth failed: %v", err)
+	}
+	if afid == NOFID || qid != aqid {
+		t.Errorf("auth: got fid %d and qid %v, expected a fid and %v", afid, qid, aqid)
+	}
+	fid, _, err := c.Attach(afid, "glenda", "")
+	if err != nil {
+		t.Fatalf("attach failed: %v", err)
+	}
+	if attachAfid != afid || fid == afid {
+		t.Errorf("attach: server got afid %d and returned fid %d, expected afid %d", attachAfid, fid, afid)
+	}
+
+	var ne *NineError
+	if _, _, err := c.Auth("none", ""); !errors.As(err, &ne) {
+		t.Errorf("auth without authentication: expected *NineError, got %v", err)
+	}
+}
+
+func TestClientRemove(t *testing.T) {
+	c := NewClient(serveFunc(func(req Message, tag Tag) Message {
+		switch r := req.(type) {
+		case *AttachRequest:
+			return &AttachResponse{Tag: tag}
+		case *RemoveRequest:
+			if r.Fid != 0 {
+				return &ErrorResponse{Tag: tag, Error: "permission denied"}
+			}
+			return &RemoveResponse{Tag: tag}
+		}
+		return &ErrorResponse{Tag: tag, Error: "unsupported"}
+	}), NineP2000)
+	defer c.Close()
+
+	fid, _, err := c.Attach(NOFID, "glenda", "")
+	if err != nil {
+		t.Fatalf("attach failed: %v", err)
+	}
+	other, _, err := c.Attach(NOFID, "glenda", "")
+	if err != nil {
+		t.Fatalf("attach failed: %v", err)
+	}
+
+	if err := c.Remove(fid); err != nil {
+		t.Errorf("remove failed: %v", err)
+	}
+	if err := c.Remove(other); err == nil || err.Error() != "permission denied" {
+		t.Errorf("failed remove: expected error \"permission denied\", got %v", err)
+	}
+
+	// Both fids are released, even though the second remove failed.
+	for i := 0; i < 2; i++ {
+		f, _, err := c.Attach(NOFID, "glenda", "")
+		if err != nil {
+			t.Fatalf("attach failed: %v", err)
+		}
+		if f != fid && f != other {
+			t.Errorf("got fid %d, expected %d or %d to be reused", f, fid, other)
+		}
+	}
+}
+
+func TestClientStat(t *testing.T) {
+	// The stat is preceded by both the byte count of the response and its own
+	// size field, which is two less.
+	const rstat = "4e000000 7d 0000 4500 " +
+		"4300 0000 00000000 00 03000000 2a00000000000000 a4010000 00ca9a3b 01ca9a3b 0c00000000000000 " +
+		"0500 68656c6c6f 0600 676c656e6461 0300 737973 0600 676c656e6461"
+	wire, err := hex.DecodeString(strings.Replace(rstat, " ", "", -1))
+	if err != nil {
+		t.Fatalf("invalid response: %v", err)
+	}
+
+	cc, sc := net.Pipe()
+	go func() {
+		m, err := NewDecoder(NineP2000, sc).ReadMessage()
+		if err != nil {
+			return
+		}
+		binary.LittleEndian.PutUint16(wire[HeaderSize:], uint16(m.GetTag()))
+		sc.Write(wire)
+	}()
+
+	c := NewClient(cc, NineP2000)
+	defer c.Close()
+
+	st, err := c.Stat(1)
+	if err != nil {
+		t.Fatalf("stat failed: %v", err)
+	}
+	expected := Stat{
+		Qid:    Qid{Type: QTFILE, Version: 3, Path: 0x2a},
+		Mode:   0644,
+		Atime:  1000000000,
+		Mtime:  1000000001,
+		Length: 12,
+		Name:   "hello",
+		UID:    "glenda",
+		GID:    "sys",
+		MUID:   "glenda",
+	}
+	if st != expected {
+		t.Errorf("got %v, expected %v", st, expected)
+	}
+}
+
+func TestClientResponseType(t *testing.T) {
+	c := NewClient(serveFunc(func(req Message, tag Tag) Message {
+		r := req.(*OpenRequest)
+		if r.Fid == 1 {
+			return &ErrorResponse{Tag: tag, Error: "permission denied"}
+		}
+		return &ReadResponse{Tag: tag}
+	}), NineP2000)
+	defer c.Close()
+
+	// Any request may be answered with an error response.
+	var ne *NineError
+	if _, _, err := c.Open(1, OREAD); !errors.As(err, &ne) || ne.Ename != "permission denied" {
+		t.Errorf("expected NineError \"permission denied\", got %v", err)
+	}
+
+	if _, _, err := c.Open(2, OREAD); !errors.Is(err, ErrUnexpectedResponse) {
+		t.Errorf("expected %v, got %v", ErrUnexpectedResponse, err)
+	}
+
+	// The client remains usable after an unexpected response.
+	if _, _, err := c.Open(1, OREAD); !errors.As(err, &ne) {
+		t.Errorf("expected NineError, got %v", err)
+	}
+}
+
+func TestClientCloseClunks(t *testing.T) {
+	var (
+		mu      sync.Mutex
+		clunked []Fid
+	)
+	c := NewClient(serveFunc(func(req Message, tag Tag) Message {
+		switch r := req.(type) {
+		case *AttachRequest:
+			return &AttachResponse{Tag: tag}
+		case *ClunkRequest:
+			mu.Lock()
+			clunked = append(clunked, r.Fid)
+			mu.Unlock()
+			return &ClunkResponse{Tag: tag}
+		}
+		return &ErrorResponse{Tag: tag, Error: "unsupported"}
+	}), NineP2000)
+
+	for i := 0; i < 3; i++ {
+		if _, _, err := c.Attach(NOFID, "glenda", ""); err != nil {
+			t.Fatalf("attach failed: %v", err)
+		}
+	}
+	if err := c.Clunk(1); err != nil {
+		t.Fatalf("clunk failed: %v", err)
+	}
+	clunked = nil
+
+	c.Close()
+	mu.Lock()
+	defer mu.Unlock()
+	sort.Slice(clunked, func(i, j int) bool { return clunked[i] < clunked[j] })
+	if expected := []Fid{0, 2}; !reflect.DeepEqual(clunked, expected) {
+		t.Errorf("close clunked %v, expected %v", clunked, expected)
+	}
+}
+
+func TestClientCloseBroken(t *testing.T) {
+	cc, sc := net.Pipe()
+	c := NewClient(cc, NineP2000)
+	go func() {
+		m, err := NewDecoder(NineP2000, sc).ReadMessage()
+		if err == nil {
+			NewEncoder(NineP2000, sc).WriteMessage(&AttachResponse{Tag: m.GetTag()})
+		}
+	}()
+	if _, _, err := c.Attach(NOFID, "glenda", ""); err != nil {
+		t.Fatalf("attach failed: %v", err)
+	}
+
+	// With the connection gone, Close must not wait for clunks.
+	sc.Close()
+	if _, err := c.Read(0, 0, 1); err == nil {
+		t.Fatalf("read on broken connection succeeded")
+	}
+	start := time.Now()
+	c.Close()
+	if d := time.Since(start); d >= closeTimeout {
+		t.Errorf("close of broken connection took %v", d)
+	}
+}
+
+func TestClientClone(t *testing.T) {
+	cc, sc := net.Pipe()
+	c := NewClient(cc, NineP2000)
+	defer c.Close()
+
+	errch := make(chan error, 1)
+	go func() {
+		var b [17]byte
+		if _, err := io.ReadFull(sc, b[:]); err != nil {
+			errch <- err
+			return
+		}
+		// size[4] Twalk tag[2] fid[4] newfid[4] nwname[2]
+		if size := binary.LittleEndian.Uint32(b[0:4]); size != 17 || MessageType(b[4]) != Twalk {
+			errch <- fmt.Errorf("got %d byte %v, expected 17 byte Twalk", size, MessageType(b[4]))
+			return
+		}
+		if n := binary.LittleEndian.Uint16(b[15:17]); n != 0 {
+			errch <- fmt.Errorf("got nwname %d, expected 0", n)
+			return
+		}
+		tag := Tag(binary.LittleEndian.Uint16(b[5:7]))
+		errch <- NewEncoder(NineP2000, sc).WriteMessage(&WalkResponse{Tag: tag})
+	}()
+
+	newfid, err := c.Clone(5)
+	if err != nil {
+		t.Fatalf("clone failed: %v", err)
+	}
+	if newfid == 5 || newfid == NOFID {
+		t.Errorf("got fid %d, expected a new fid", newfid)
+	}
+	if err := <-errch; err != nil {
+		t.Errorf("server: %v", err)
+	}
+	sc.Close()
+}
+
+func TestClientMaxInflight(t *testing.T) {
+	var (
+		mu            sync.Mutex
+		current, peak int
+	)
+	c := NewClient(serveFunc(func(req Message, tag Tag) Message {
+		mu.Lock()
+		current++
+		if current > peak {
+			peak = current
+		}
+		mu.Unlock()
+
+		time.Sleep(5 * time.Millisecond)
+
+		mu.Lock()
+		current--
+		mu.Unlock()
+		return &ReadResponse{Tag: tag}
+	}), NineP2000)
+	defer c.Close()
+
+	c.SetMaxInflight(2, true)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := c.Read(0, 0, 1); err != nil {
+				t.Errorf("read failed: %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	mu.Lock()
+	defer mu.Unlock()
+	if peak != 2 {
+		t.Errorf("got up to %d requests in flight, expected 2", peak)
+	}
+}
+
+func TestClientMaxInflightBusy(t *testing.T) {
+	started := make(chan struct{})
+	release := make(chan struct{})
+	c := NewClient(serveFunc(func(req Message, tag Tag) Message {
+		switch req.(type) {
+		case *FlushRequest:
+			return &FlushResponse{Tag: tag}
+		case *ReadRequest:
+			started <- struct{}{}
+			<-release
+			return &ReadResponse{Tag: tag}
+		}
+		return &ErrorResponse{Tag: tag, Error: "unsupported"}
+	}), NineP2000)
+	defer c.Close()
+
+	c.SetMaxInflight(1, false)
+
+	errch := make(chan error, 1)
+	go func() {
+		_, err := c.Read(0, 0, 1)
+		errch <- err
+	}()
+
+	// Once the server holds the first read, it holds the only slot.
+	<-started
+	if _, err := c.Read(0, 0, 1); err != ErrBusy {
+		t.Errorf("read at limit: expected %v, got %v", ErrBusy, err)
+	}
+
+	// Flushes are exempt from the limit.
+	if err := c.Flush(1000); err != nil {
+		t.Errorf("flush at limit failed: %v", err)
+	}
+
+	close(release)
+	if err := <-errch; err != nil {
+		t.Errorf("first read failed: %v", err)
+	}
+	go func() { <-started }()
+	if _, err := c.Read(0, 0, 1); err != nil {
+		t.Errorf("read after slot was released failed: %v", err)
+	}
+}
+
+func TestClientCloseMaxInflight(t *testing.T) {
+	var (
+		mu      sync.Mutex
+		clunked int
+	)
+	c := NewClient(serveFunc(func(req Message, tag Tag) Message {
+		switch req.(type) {
+		case *AttachRequest:
+			return &AttachResponse{Tag: tag}
+		case *ClunkRequest:
+			mu.Lock()
+			clunked++
+			mu.Unlock()
+			return &ClunkResponse{Tag: tag}
+		}
+		return &ErrorResponse{Tag: tag, Error: "unsupported"}
+	}), NineP2000)
+
+	for i := 0; i < 5; i++ {
+		if _, _, err := c.Attach(NOFID, "glenda", ""); err != nil {
+			t.Fatalf("attach failed: %v", err)
+		}
+	}
+
+	// The clunks of Close are exempt from the limit.
+	c.SetMaxInflight(2, false)
+	c.Close()
+
+	mu.Lock()
+	defer mu.Unlock()
+	if clunked != 5 {
+		t.Errorf("close clunked %d fids, expected 5", clunked)
+	}
+}
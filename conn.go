@@ -0,0 +1,86 @@
+package qp
+
+import (
+	"bufio"
+	"io"
+	"net"
+)
+
+// Conn binds a Protocol to a connection, reading and writing messages through
+// buffered I/O. Every message written is flushed to the connection before
+// WriteMessage returns, so messages never linger in the buffer. WriteMessage
+// may be called in parallel from arbitrary goroutines, but only one goroutine
+// may call ReadMessage at a time.
+type Conn struct {
+	rwc io.ReadWriteCloser
+	e   *Encoder
+	d   *Decoder
+}
+
+// NewConn returns a Conn speaking protocol p over rwc.
+func NewConn(rwc io.ReadWriteCloser, p Protocol) *Conn {
+	return &Conn{
+		rwc: rwc,
+		e:   NewEncoder(p, bufio.NewWriter(rwc)),
+		d:   NewDecoder(p, bufio.NewReader(rwc)),
+	}
+}
+
+// ReadMessage reads the next message from the connection.
+func (c *Conn) ReadMessage() (Message, error) {
+	return c.d.ReadMessage()
+}
+
+// WriteMessage writes a message to the connection and flushes it.
+func (c *Conn) WriteMessage(m Message) error {
+	if err := c.e.WriteMessage(m); err != nil {
+		return err
+	}
+	return c.e.Flush()
+}
+
+// SetMessageSize limits the messages read and written to msize bytes,
+// including their header, as negotiated by a version request. Larger messages
+// are rejected with ErrMessageTooBig. Zero means no limit. It must not be
+// called in parallel with ReadMessage or WriteMessage.
+func (c *Conn) SetMessageSize(msize uint32) {
+	c.e.MessageSize = msize
+	c.d.MessageSize = msize
+}
+
+// Reset clears the negotiated message size and the decoding state, returning
+// the Conn to its initial state for a new session, such as after a
+// renegotiation or when the connection is reused from a pool. The buffers of
+// a Conn keep their default sizes whatever the message size, so there are no
+// grown buffers to drop. Buffered data is kept, as it belongs to the next
+// session. It must not be called in parallel with ReadMessage or
+// WriteMessage.
+func (c *Conn) Reset() {
+	c.SetMessageSize(0)
+
+	// The decoder is not greedy, so it never holds buffered data, and Reset
+	// cannot fail.
+	c.d.Reset()
+}
+
+// Close flushes any buffered data and closes the connection. The connection
+// is closed even if flushing fails, in which case the flush error is
+// returned.
+func (c *Conn) Close() error {
+	ferr := c.e.Flush()
+	cerr := c.rwc.Close()
+	if ferr != nil {
+		return ferr
+	}
+	return cerr
+}
+
+// Loopback returns two connected Conns speaking protocol p, backed by an
+// in-process pipe, for running a Server against a client without a socket.
+// Messages written to one end are read from the other. Once either end is
+// closed, reads on the other end return io.EOF, and reads and writes on the
+// closed end return io.ErrClosedPipe.
+func Loopback(p Protocol) (client, server *Conn) {
+	a, b := net.Pipe()
+	return NewConn(a, p), NewConn(b, p)
+}
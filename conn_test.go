@@ -0,0 +1,122 @@
+package qp
+
+import (
+	"io"
+	"net"
+	"testing"
+)
+
+func TestConn(t *testing.T) {
+	a, b := net.Pipe()
+	ca := NewConn(a, NineP2000)
+	cb := NewConn(b, NineP2000)
+
+	go func() {
+		for _, tt := range MessageTestData {
+			if err := ca.WriteMessage(tt.input); err != nil {
+				t.Errorf("write failed: %v", err)
+				return
+			}
+		}
+		ca.Close()
+	}()
+
+	for i, tt := range MessageTestData {
+		m, err := cb.ReadMessage()
+		if err != nil {
+			t.Fatalf("test %d: read failed: %v", i, err)
+		}
+		if !MessagesEqual(tt.input, m) {
+			t.Errorf("test %d: got %v, expected %v", i, m, tt.input)
+		}
+	}
+
+	if _, err := cb.ReadMessage(); err != io.EOF {
+		t.Errorf("expected %v after close, got %v", io.EOF, err)
+	}
+	cb.Close()
+}
+
+func TestLoopback(t *testing.T) {
+	c, sc := Loopback(NineP2000)
+	s := &Server{Handler: &memFS{
+		files: map[string][]byte{"hello": []byte("hello, world")},
+		fids:  make(map[Fid]string),
+	}}
+	errch := make(chan error, 1)
+	go func() {
+		errch <- s.ServeConn(sc)
+	}()
+
+	reqs := []Message{
+		&VersionRequest{Tag: NOTAG, MessageSize: 8192, Version: Version},
+		&AttachRequest{Tag: 1, Fid: 1, AuthFid: NOFID, Username: "glenda"},
+		&WalkRequest{Tag: 2, Fid: 1, NewFid: 2, Names: []string{"hello"}},
+		&ReadRequest{Tag: 3, Fid: 2, Count: 5},
+	}
+	for _, req := range reqs {
+		if err := c.WriteMessage(req); err != nil {
+			t.Fatalf("%T: write failed: %v", req, err)
+		}
+		m, err := c.ReadMessage()
+		if err != nil {
+			t.Fatalf("%T: read failed: %v", req, err)
+		}
+		if err := AsError(m); err != nil {
+			t.Fatalf("%T: got error response: %v", req, err)
+		}
+		if m.GetTag() != req.GetTag() {
+			t.Errorf("%T: got tag %d, expected %d", req, m.GetTag(), req.GetTag())
+		}
+		if r, ok := m.(*ReadResponse); ok && string(r.Data) != "hello" {
+			t.Errorf("read: got %q, expected %q", r.Data, "hello")
+		}
+	}
+
+	// Closing the client end shuts the server down gracefully.
+	c.Close()
+	if err := <-errch; err != nil {
+		t.Errorf("serve returned error on disconnect: %v", err)
+	}
+	if err := c.WriteMessage(&ClunkRequest{Tag: 4, Fid: 2}); err != io.ErrClosedPipe {
+		t.Errorf("write after close: expected %v, got %v", io.ErrClosedPipe, err)
+	}
+	sc.Close()
+}
+
+func TestLoopbackServerClose(t *testing.T) {
+	c, sc := Loopback(NineP2000)
+	sc.Close()
+	if _, err := c.ReadMessage(); err != io.EOF {
+		t.Errorf("read after server close: expected %v, got %v", io.EOF, err)
+	}
+	c.Close()
+}
+
+func TestConnReset(t *testing.T) {
+	c, sc := Loopback(NineP2000)
+	defer c.Close()
+	defer sc.Close()
+
+	big := &WriteRequest{Tag: 1, Fid: 2, Data: make([]byte, 128)}
+	c.SetMessageSize(64)
+	sc.SetMessageSize(64)
+	if err := c.WriteMessage(big); err != ErrMessageTooBig {
+		t.Errorf("write before reset: expected %v, got %v", ErrMessageTooBig, err)
+	}
+
+	c.Reset()
+	sc.Reset()
+	go func() {
+		if err := c.WriteMessage(big); err != nil {
+			t.Errorf("write after reset failed: %v", err)
+		}
+	}()
+	m, err := sc.ReadMessage()
+	if err != nil {
+		t.Fatalf("read after reset failed: %v", err)
+	}
+	if !MessagesEqual(m, big) {
+		t.Errorf("got %v, expected %v", m, big)
+	}
+}
@@ -1,9 +1,12 @@
 package qp
 
 import (
+	"context"
 	"encoding/binary"
 	"errors"
+	"fmt"
 	"io"
+	"math"
 	"sync"
 )
 
@@ -14,6 +17,22 @@ var (
 	// ErrMessageTooBig indicates that the message, when encoded and wrapped in
 	// container, does not fit in the configured message size.
 	ErrMessageTooBig = errors.New("message size larger than buffer")
+
+	// ErrTrailingData indicates that a message body held more data than the
+	// message it contained.
+	ErrTrailingData = errors.New("trailing data after message")
+
+	// ErrInvalidSize indicates that the size field of a message is smaller
+	// than the message header.
+	ErrInvalidSize = errors.New("invalid message size")
+
+	// ErrInvalidMessage indicates that the body of a complete message is
+	// malformed, such as by a string running past the end of the message.
+	ErrInvalidMessage = errors.New("malformed message")
+
+	// ErrBodySkipped indicates that a RawMessage or StreamingReadResponse
+	// cannot be encoded, as its body was not kept.
+	ErrBodySkipped = errors.New("message body skipped")
 )
 
 // Protocol defines a protocol message encoder/decoder
@@ -25,22 +44,148 @@ type Protocol interface {
 // Default is the protocol used by the raw Encode and Decode functions.
 var Default = NineP2000
 
+// Encode encodes a message using the Default protocol and writes it to w.
+func Encode(w io.Writer, m Message) error {
+	e := Encoder{Protocol: Default, Writer: w}
+	return e.WriteMessage(m)
+}
+
+// AppendEncode encodes a message using the Default protocol and appends it to
+// dst, returning the extended slice.
+func AppendEncode(dst []byte, m Message) ([]byte, error) {
+	e := Encoder{Protocol: Default}
+	return e.AppendMessage(dst, m)
+}
+
+// EncodeContext is like Encode, but aborts the write when ctx is done.
+func EncodeContext(ctx context.Context, w io.Writer, m Message) error {
+	e := Encoder{Protocol: Default, Writer: w}
+	return e.WriteMessageContext(ctx, m)
+}
+
+// Decode reads and decodes a single message from r using the Default
+// protocol.
+func Decode(r io.Reader) (Message, error) {
+	d := Decoder{Protocol: Default, Reader: r}
+	return d.ReadMessage()
+}
+
+// DecodeContext is like Decode, but aborts the read when ctx is done.
+func DecodeContext(ctx context.Context, r io.Reader) (Message, error) {
+	d := Decoder{Protocol: Default, Reader: r}
+	return d.ReadMessageContext(ctx)
+}
+
+// TryDecode decodes a single message from the start of b using the Default
+// protocol. See Decoder.TryDecode.
+func TryDecode(b []byte) (Message, int, error) {
+	d := Decoder{Protocol: Default}
+	return d.TryDecode(b)
+}
+
+// DecodeAt decodes a single message at offset off of r using the Default
+// protocol. See Decoder.DecodeAt.
+func DecodeAt(r io.ReaderAt, off int64) (Message, int, error) {
+	d := Decoder{Protocol: Default}
+	return d.DecodeAt(r, off)
+}
+
 // MessageType is the type of the contained message.
 type MessageType byte
 
+// IsValid reports whether mt is a message type of one of the protocols of
+// this package. Terror and Tlerror are not valid, as errors are only
+// responses.
+func (mt MessageType) IsValid() bool {
+	if mt == Terror || mt == Tlerror {
+		return false
+	}
+	_, ok := messageTypeNames[mt]
+	return ok
+}
+
+// IsRequest reports whether mt is a valid request type. Requests have even
+// types, and their responses the following odd types.
+func (mt MessageType) IsRequest() bool {
+	return mt.IsValid() && mt%2 == 0
+}
+
 // Message is an interface describing an item that can encode itself to a
-// writer, decode itself from a reader. It is also capable of getting the
-// message tag, which is merely a convenience feature to save a type assert
-// for access to the tag.
+// buffer, decode itself from a buffer, and inform how large the encoded form
+// would be at the current time. It is also capable of getting and setting the
+// message tag, which is merely a convenience feature to save a type assert for
+// access to the tag. Messages get both tag methods by embedding Tag.
 type Message interface {
+	// Marshal encodes the message body into b, which must be at least
+	// EncodedSize bytes long. Encoders pass a zeroed b, so bytes that are
+	// not written are sent as zero.
 	Marshal(b []byte) error
+
+	// Unmarshal decodes the message body from b. Greedy decoders and
+	// decoders with PoolBuffers set reuse b, so messages decoded by them
+	// must copy any part of it that they retain, as the messages of this
+	// package do.
 	Unmarshal(b []byte) error
+
+	// EncodedSize returns the size of the encoded message body, excluding the
+	// HeaderSize bytes of the message header. It does not marshal the
+	// message, so it can be used to check whether a message fits within a
+	// negotiated message size up front.
 	EncodedSize() int
+
 	GetTag() Tag
+	SetTag(Tag)
+}
+
+// RawMessage stands in for a message whose body was skipped by a Decoder, as
+// requested by its Skip option. Only the header and the tag are decoded, so
+// RawMessage cannot be encoded again.
+type RawMessage struct {
+	Tag
+
+	// Type is the type of the skipped message.
+	Type MessageType
+
+	// Size is the size of the skipped message, including its header.
+	Size uint32
+}
+
+// Marshal fails with ErrBodySkipped, as the body of the message is unknown.
+func (rm *RawMessage) Marshal(b []byte) error { return ErrBodySkipped }
+
+// Unmarshal decodes the tag of the message body, ignoring the rest.
+func (rm *RawMessage) Unmarshal(b []byte) error {
+	if len(b) < 2 {
+		return ErrPayloadTooShort
+	}
+	rm.Tag = Tag(binary.LittleEndian.Uint16(b[0:2]))
+	return nil
+}
+
+// EncodedSize returns the size of the skipped body.
+func (rm *RawMessage) EncodedSize() int { return int(rm.Size) - HeaderSize }
+
+// MessageReader is the interface implemented by types that read messages,
+// such as Decoder and Conn.
+type MessageReader interface {
+	ReadMessage() (Message, error)
+}
+
+// MessageWriter is the interface implemented by types that write messages,
+// such as Encoder and Conn.
+type MessageWriter interface {
+	WriteMessage(Message) error
+}
+
+// MessageReadWriter groups the ReadMessage and WriteMessage methods.
+type MessageReadWriter interface {
+	MessageReader
+	MessageWriter
 }
 
 // Encoder handles writes encoded messages to an io.Writer. Encoder is thread
-// safe, and may be called in parallel from arbitrary goroutines.
+// safe, and may be called in parallel from arbitrary goroutines. Each message
+// is written whole while holding a lock, so messages are never interleaved.
 type Encoder struct {
 	// Protocol is the protocol codec used for encoding messages.
 	Protocol Protocol
@@ -48,45 +193,201 @@ type Encoder struct {
 	// Writer is the writer to encode messages to.
 	Writer io.Writer
 
-	// MessageSize is the maximum message size negotiated for the protocol. It
-	// is used to enforce a limit on writes.
+	// MessageSize is the maximum message size negotiated for the protocol.
+	// Messages larger than MessageSize, including their header, are rejected
+	// with ErrMessageTooBig. Zero means no limit. It must not be changed while
+	// messages are being written.
 	MessageSize uint32
 
+	// ValidateUTF8 enables checking that the string fields of messages hold
+	// valid UTF-8 before they are written, rejecting them with an error
+	// wrapping ErrInvalidUTF8 and naming the field otherwise.
+	ValidateUTF8 bool
+
 	// writeLock is used to synchronize writes. Without it, messages would end
 	// up interleaved and incomprehensible.
 	writeLock sync.Mutex
 }
 
+// NewEncoder returns an Encoder writing messages of protocol p to w. To batch
+// writes, w may be a *bufio.Writer, in which case Flush must be called to
+// send buffered messages.
+func NewEncoder(p Protocol, w io.Writer) *Encoder {
+	return &Encoder{Protocol: p, Writer: w}
+}
+
 // WriteMessage encodes a message and writes it to the Encoders associated
-// io.Writer.
+// io.Writer. The Data of a large WriteRequest is written directly from its
+// slice, which may be part of a caller-owned buffer such as a memory-mapped
+// file, after a separate write of the fixed fields. Such data must not be
+// modified until WriteMessage returns.
 func (e *Encoder) WriteMessage(m Message) error {
-	var (
-		mt  MessageType
-		err error
-	)
+	return e.writeMessage(nil, m)
+}
 
-	if mt, err = e.Protocol.MessageType(m); err != nil {
+// WriteMessageContext is like WriteMessage, but stops writing when ctx is
+// done, returning ctx.Err(). The context is checked between writes, so a write
+// that is already blocked in the underlying writer cannot be pre-empted. A
+// message that was only partially written leaves the stream in an undefined
+// state.
+func (e *Encoder) WriteMessageContext(ctx context.Context, m Message) error {
+	if err := ctx.Err(); err != nil {
 		return err
 	}
+	return e.writeMessage(ctx, m)
+}
+
+// AppendMessage encodes a message and appends it, including its header, to
+// dst, growing it as needed. It returns the extended slice, and dst unchanged
+// on error. The Encoders io.Writer is not used, so AppendMessage allows
+// encoding into preallocated buffers without allocating.
+func (e *Encoder) AppendMessage(dst []byte, m Message) ([]byte, error) {
+	mt, size, err := e.prepare(m)
+	if err != nil {
+		return dst, err
+	}
 
-	buf := make([]byte, m.EncodedSize()+HeaderSize)
+	n := len(dst)
+	dst = append(dst, make([]byte, size)...)
+	if err := encodeMessage(dst[n:], mt, m); err != nil {
+		return dst[:n], err
+	}
+	return dst, nil
+}
+
+// prepare looks up the type of a message, validates its strings if enabled,
+// and checks its encoded size, header included, against the MessageSize limit.
+func (e *Encoder) prepare(m Message) (MessageType, int, error) {
+	mt, err := e.Protocol.MessageType(m)
+	if err != nil {
+		return 0, 0, err
+	}
+	if e.ValidateUTF8 {
+		if err := validateUTF8(m); err != nil {
+			return 0, 0, err
+		}
+	}
+
+	size := m.EncodedSize() + HeaderSize
+	if e.MessageSize > 0 && uint64(size) > uint64(e.MessageSize) {
+		return 0, 0, ErrMessageTooBig
+	}
+	return mt, size, nil
+}
+
+// encodeMessage writes the header and body of a message of type mt into buf,
+// which must be exactly as long as the encoded message.
+func encodeMessage(buf []byte, mt MessageType, m Message) error {
 	binary.LittleEndian.PutUint32(buf[0:4], uint32(len(buf)))
 	buf[4] = byte(mt)
+	return m.Marshal(buf[5:])
+}
 
-	if err := m.Marshal(buf[5:]); err != nil {
+// writeMessage encodes a message and writes it to the Writer, stopping once
+// ctx is done if ctx is not nil.
+func (e *Encoder) writeMessage(ctx context.Context, m Message) error {
+	mt, size, err := e.prepare(m)
+	if err != nil {
+		return err
+	}
+	if wr, ok := m.(*WriteRequest); ok && len(wr.Data) >= zeroCopySize {
+		return e.writeZeroCopy(ctx, mt, wr)
+	}
+
+	bp := getBuffer(size)
+	defer putBuffer(bp)
+
+	// The pooled buffer holds an earlier message, and Marshal need not write
+	// every byte.
+	buf := *bp
+	for i := range buf {
+		buf[i] = 0
+	}
+	if err := encodeMessage(buf, mt, m); err != nil {
 		return err
 	}
 
 	e.writeLock.Lock()
 	defer e.writeLock.Unlock()
 
-	_, err = e.Writer.Write(buf)
-	return err
+	return write(e.writer(ctx), buf)
+}
+
+// writer returns the Writer, wrapped to stop writing once ctx is done if ctx
+// is not nil. The Writer is only read with writeLock held, so that
+// Client.SetWriteBuffer can replace it while other goroutines write.
+func (e *Encoder) writer(ctx context.Context) io.Writer {
+	if ctx == nil {
+		return e.Writer
+	}
+	return ctxWriter{ctx: ctx, w: e.Writer}
+}
+
+// maxPooledBuffer is the largest buffer kept in bufferPool. Larger buffers
+// are left to the garbage collector, so that a single huge message does not
+// pin its memory forever.
+const maxPooledBuffer = 1 << 20
+
+// bufferPool holds encoding and decoding buffers for reuse across messages.
+var bufferPool = sync.Pool{
+	New: func() interface{} { return new([]byte) },
+}
+
+// getBuffer returns a pooled buffer of length n.
+func getBuffer(n int) *[]byte {
+	bp := bufferPool.Get().(*[]byte)
+	if cap(*bp) < n {
+		*bp = make([]byte, n)
+	}
+	*bp = (*bp)[:n]
+	return bp
+}
+
+// putBuffer returns a buffer obtained from getBuffer to the pool.
+func putBuffer(bp *[]byte) {
+	if cap(*bp) > maxPooledBuffer {
+		return
+	}
+	bufferPool.Put(bp)
+}
+
+// Flush flushes the associated io.Writer if it buffers writes, such as a
+// *bufio.Writer. It is a no-op otherwise.
+func (e *Encoder) Flush() error {
+	e.writeLock.Lock()
+	defer e.writeLock.Unlock()
+
+	return e.flush()
+}
+
+// flush is Flush with writeLock held.
+func (e *Encoder) flush() error {
+	if f, ok := e.Writer.(interface{ Flush() error }); ok {
+		return f.Flush()
+	}
+	return nil
+}
+
+// write writes the full buffer to the writer, retrying on short writes.
+func write(w io.Writer, b []byte) error {
+	var written int
+	for written < len(b) {
+		n, err := w.Write(b[written:])
+		written += n
+		if err != nil {
+			return err
+		}
+		if n == 0 {
+			return io.ErrShortWrite
+		}
+	}
+	return nil
 }
 
 // Decoder reads messages from an io.Reader. It exposes buffered reading through
 // ReadMessage. A Decoder is not thread safe. Only one goroutine may call
-// ReadMessage at a time.
+// ReadMessage at a time, so a connection shared between goroutines needs a
+// single reader dispatching the decoded messages, as done by Client.
 type Decoder struct {
 	// Protocol is the protocol codec used for decoding messages.
 	Protocol Protocol
@@ -103,9 +404,56 @@ type Decoder struct {
 	Greedy bool
 
 	// MessageSize is the maximum message size negotiated for the protocol. It
-	// is used to allocate the decoding buffer.
+	// is used to allocate the decoding buffer, and messages declaring a larger
+	// size are rejected with ErrMessageTooBig before their body is read. Zero
+	// means no limit when Greedy is not set.
 	MessageSize uint32
 
+	// Strict enables strict decoding, rejecting messages whose body holds
+	// more data than the decoded message with ErrTrailingData. By default,
+	// such trailing data is ignored.
+	Strict bool
+
+	// PoolBuffers enables reading message bodies into buffers shared with
+	// other decoders and reused once each message is decoded, saving an
+	// allocation per message. It must only be set if every message type of
+	// the protocol copies what it retains from Unmarshal, as the messages of
+	// this package do. Custom messages keeping a slice of their body would
+	// otherwise be silently corrupted by later reads. PoolBuffers is ignored
+	// when Greedy is set, as greedy decoders reuse their own buffer.
+	PoolBuffers bool
+
+	// Skip, if set, is called with the type of every message read. If it
+	// returns true, the message body is discarded without being decoded, and
+	// a RawMessage holding the type, tag and size is returned instead. This
+	// saves decoding large payloads that are of no interest.
+	Skip func(MessageType) bool
+
+	// ValidateUTF8 enables checking that the string fields of decoded
+	// messages hold valid UTF-8, rejecting them with an error wrapping
+	// ErrInvalidUTF8 and naming the field otherwise.
+	ValidateUTF8 bool
+
+	// StreamReads enables streaming the data of read responses read by
+	// ReadMessage. Instead of a ReadResponse, a StreamingReadResponse is
+	// returned, whose DataReader reads the data directly from the Reader. The
+	// data must be consumed before the next message is read, as the next
+	// read discards whatever is left of it. StreamReads is ignored when
+	// Greedy is set.
+	StreamReads bool
+
+	// hooks holds the functions registered with OnDecode, by message type.
+	hooks map[MessageType][]func(Message)
+
+	// keepRaw is set while ReadRawMessage is in progress, and raw holds the
+	// frame it has kept.
+	keepRaw bool
+	raw     []byte
+
+	// stream is the last streamed read response, whose remainder must be
+	// discarded before the next message can be read.
+	stream *StreamingReadResponse
+
 	// total is the count of bytes in the buffer. It is used to keep track
 	// of buffer usage (read offset and cleanup), and is not used by the
 	// actual decoding loop.
@@ -141,6 +489,11 @@ type Decoder struct {
 	buffer []byte
 }
 
+// NewDecoder returns a Decoder reading messages of protocol p from r.
+func NewDecoder(p Protocol, r io.Reader) *Decoder {
+	return &Decoder{Protocol: p, Reader: r}
+}
+
 // Reset resets the decoding state machine and reallocates the buffer to the
 // current MessageSize. Reset will return an error if the buffer isn't empty,
 // which may be the case if Greedy decoding has already been used.
@@ -157,34 +510,195 @@ func (d *Decoder) Reset() error {
 	return nil
 }
 
+// readHeader reads a message header from r, returning the size and type
+// fields. If r fails before any of the header is read, its error, such as
+// io.EOF at a message boundary, is returned as is. If it fails in the middle
+// of the header, the error is wrapped by shortHeader.
+func readHeader(r io.Reader) (uint32, MessageType, error) {
+	var b [HeaderSize]byte
+	n, err := io.ReadFull(r, b[:])
+	if err != nil {
+		if n > 0 {
+			return 0, 0, shortHeader(n, err)
+		}
+		return 0, 0, err
+	}
+	return binary.LittleEndian.Uint32(b[0:4]), MessageType(b[4]), nil
+}
+
+// shortHeader wraps the error causing a header read to stop after n bytes.
+func shortHeader(n int, err error) error {
+	return &shortHeaderError{n: n, err: err}
+}
+
+// shortHeaderError is a header read that stopped after n bytes. If the stream
+// ended, it matches ErrPayloadTooShort as well as io.ErrUnexpectedEOF, like a
+// truncated body.
+type shortHeaderError struct {
+	n   int
+	err error
+}
+
+func (e *shortHeaderError) Error() string {
+	return fmt.Sprintf("short header read (%d/%d bytes): %v", e.n, HeaderSize, e.err)
+}
+
+func (e *shortHeaderError) Unwrap() error { return e.err }
+
+func (e *shortHeaderError) Is(target error) bool {
+	return target == ErrPayloadTooShort && e.err == io.ErrUnexpectedEOF
+}
+
+// errTruncated is returned when the stream ends in the middle of a message
+// body.
+var errTruncated error = truncatedError{}
+
+// truncatedError matches both ErrPayloadTooShort, as the message is
+// incomplete, and io.ErrUnexpectedEOF, as the stream ended.
+type truncatedError struct{}
+
+func (truncatedError) Error() string { return "payload too short: unexpected EOF" }
+
+func (truncatedError) Is(target error) bool {
+	return target == ErrPayloadTooShort || target == io.ErrUnexpectedEOF
+}
+
 // simpleRead is an inefficient but safe and stateless decoding mechanism.
-func (d *Decoder) simpleRead() (Message, error) {
-	b := make([]byte, 5)
-	_, err := io.ReadFull(d.Reader, b)
+// If buf is not nil, the body is read into it, and the data of a
+// ReadResponse is left referencing buf rather than copied.
+func (d *Decoder) simpleRead(r io.Reader, buf []byte) (Message, error) {
+	size, m, err := d.readFrame(r)
 	if err != nil {
 		return nil, err
 	}
+	return d.readBody(r, size, m, buf)
+}
 
-	s := binary.LittleEndian.Uint32(b[0:4]) - HeaderSize
-	mt := MessageType(b[4])
-	m, err := d.Protocol.Message(mt)
+// readFrame reads and checks a message header from r, returning the message
+// size and an empty message to decode the body into.
+func (d *Decoder) readFrame(r io.Reader) (uint32, Message, error) {
+	size, mt, err := readHeader(r)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	if size < HeaderSize {
+		// The size includes the header, so this cannot be a valid message.
+		return 0, nil, ErrPayloadTooShort
+	}
+	if d.MessageSize > 0 && size > d.MessageSize {
+		return 0, nil, ErrMessageTooBig
+	}
+
+	m, err := d.message(mt, size)
+	if err != nil {
+		return 0, nil, err
+	}
+	return size, m, nil
+}
+
+// readBody reads the body of m, of a message of size bytes, from r. See
+// simpleRead for the use of buf.
+func (d *Decoder) readBody(r io.Reader, size uint32, m Message, buf []byte) (Message, error) {
+	if rm, ok := m.(*RawMessage); ok {
+		if err := skipBody(r, rm); err != nil {
+			return nil, err
+		}
+		return rm, nil
+	}
+
+	var b []byte
+	if buf != nil {
+		if int64(size-HeaderSize) > int64(len(buf)) {
+			return nil, ErrMessageTooBig
+		}
+		b = buf[:size-HeaderSize]
+	} else if d.PoolBuffers {
+		bp := getBuffer(int(size - HeaderSize))
+		defer putBuffer(bp)
+		b = *bp
+	} else {
+		b = make([]byte, size-HeaderSize)
+	}
+
+	_, err := io.ReadFull(r, b)
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		// The header has been read, so the message is incomplete.
+		return nil, errTruncated
+	}
 	if err != nil {
 		return nil, err
 	}
 
-	b = make([]byte, s)
-	_, err = io.ReadFull(d.Reader, b)
+	if rr, ok := m.(*ReadResponse); ok && buf != nil {
+		err = rr.unmarshalShared(b)
+		if err == nil && d.Strict && rr.EncodedSize() != len(b) {
+			err = ErrTrailingData
+		}
+		if err == nil {
+			d.keep(m, b)
+		}
+	} else {
+		err = d.unmarshal(m, b)
+	}
 	if err != nil {
 		return nil, err
 	}
+	return m, nil
+}
+
+// message returns an empty message of type mt to decode a message of size
+// bytes into, or a RawMessage if the type is to be skipped.
+func (d *Decoder) message(mt MessageType, size uint32) (Message, error) {
+	if d.Skip != nil && d.Skip(mt) {
+		return &RawMessage{Type: mt, Size: size}, nil
+	}
+	return d.Protocol.Message(mt)
+}
 
-	err = m.Unmarshal(b)
-	return m, err
+// skipBody reads the tag of rm from r, and discards the rest of its body.
+func skipBody(r io.Reader, rm *RawMessage) error {
+	var b [2]byte
+	if rm.Size < HeaderSize+2 {
+		return ErrPayloadTooShort
+	}
+	if _, err := io.ReadFull(r, b[:]); err != nil {
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			err = errTruncated
+		}
+		return err
+	}
+	rm.Unmarshal(b[:])
+
+	_, err := io.CopyN(io.Discard, r, int64(rm.Size)-HeaderSize-2)
+	if err == io.EOF {
+		err = errTruncated
+	}
+	return err
+}
+
+// unmarshal decodes the message body b into m, checking for trailing data if
+// the decoder is strict, and the strings if ValidateUTF8 is set. The frame is
+// kept for ReadRawMessage.
+func (d *Decoder) unmarshal(m Message, b []byte) error {
+	if err := m.Unmarshal(b); err != nil {
+		return err
+	}
+	if d.Strict && m.EncodedSize() != len(b) {
+		return ErrTrailingData
+	}
+	if d.ValidateUTF8 {
+		if err := validateUTF8(m); err != nil {
+			return err
+		}
+	}
+	d.keep(m, b)
+	return nil
 }
 
 // greedyRead is complicated and unsafe (parameters cannot be changed). The
 // upside is that it can save a considerable amount of syscalls.
-func (d *Decoder) greedyRead() (Message, error) {
+func (d *Decoder) greedyRead(r io.Reader) (Message, error) {
 	if d.buffer == nil {
 		// Let's initialize.
 		d.Reset()
@@ -199,6 +713,9 @@ func (d *Decoder) greedyRead() (Message, error) {
 		for d.needed <= 0 {
 			if d.m == nil { // Read a header if no message has been prepared.
 				s := binary.LittleEndian.Uint32(d.buffer[d.ptr : d.ptr+4])
+				if s < HeaderSize {
+					return nil, ErrPayloadTooShort
+				}
 				if s > uint32(len(d.buffer)) {
 					return nil, ErrMessageTooBig
 				}
@@ -212,12 +729,12 @@ func (d *Decoder) greedyRead() (Message, error) {
 
 				// We try to fetch the message struct immediately - better to fail
 				// early rather than late.
-				if d.m, err = d.Protocol.Message(mt); err != nil {
+				if d.m, err = d.message(mt, s); err != nil {
 					return nil, err
 				}
 
 			} else { // Otherwise, read a body for the message.
-				if err = d.m.Unmarshal(d.buffer[d.ptr : d.ptr+d.size]); err != nil {
+				if err = d.unmarshal(d.m, d.buffer[d.ptr:d.ptr+d.size]); err != nil {
 					return nil, err
 				}
 
@@ -233,6 +750,16 @@ func (d *Decoder) greedyRead() (Message, error) {
 
 		// Let's see if any readerr was present from last iteration...
 		if readerr != nil {
+			if readerr == io.EOF && (d.m != nil || d.total != d.ptr) {
+				// We stopped in the middle of a message.
+				readerr = io.ErrUnexpectedEOF
+			}
+			if d.m == nil && d.total != d.ptr {
+				return nil, shortHeader(int(d.total-d.ptr), readerr)
+			}
+			if d.m != nil && readerr == io.ErrUnexpectedEOF {
+				return nil, errTruncated
+			}
 			return nil, readerr
 		}
 
@@ -251,7 +778,7 @@ func (d *Decoder) greedyRead() (Message, error) {
 		}
 
 		// We need more data!
-		n, readerr = d.Reader.Read(d.buffer[d.total:limit])
+		n, readerr = r.Read(d.buffer[d.total:limit])
 		d.total += uint32(n)
 		d.needed -= n
 	}
@@ -259,11 +786,147 @@ func (d *Decoder) greedyRead() (Message, error) {
 
 // ReadMessage executes the decoder loop, returning the next message. It will
 // continue reading from the configured reader until a message is found or an
-// error occurs. NextMessage calls Reset if the internal buffer is nil for
-// initialization.
+// error occurs. ReadMessage calls Reset if the internal buffer is nil for
+// initialization. If the reader ends at a message boundary, io.EOF is
+// returned as is. If it ends in the middle of a header or a message body, the
+// error matches both ErrPayloadTooShort and io.ErrUnexpectedEOF with
+// errors.Is, and a short header error also holds the amount of bytes read.
+// If StreamReads is set, any data left of the last StreamingReadResponse is
+// discarded first.
 func (d *Decoder) ReadMessage() (Message, error) {
+	return d.hook(d.readMessage())
+}
+
+// readMessage is ReadMessage without running the OnDecode hooks.
+func (d *Decoder) readMessage() (Message, error) {
 	if d.Greedy {
-		return d.greedyRead()
+		return d.greedyRead(d.Reader)
+	}
+	if err := d.discardStream(); err != nil {
+		return nil, err
+	}
+	if d.StreamReads {
+		return d.streamRead(d.Reader)
+	}
+	return d.simpleRead(d.Reader, nil)
+}
+
+// TryDecode decodes a single message from the start of b, for decoding from
+// bytes accumulated by a non-blocking reader. It returns the message and the
+// amount of bytes it occupied. If b does not hold a whole message yet, it
+// returns exactly ErrPayloadTooShort, and more bytes should be accumulated.
+// No other error matches ErrPayloadTooShort, and none is recoverable by
+// waiting: a size field smaller than the header is rejected with
+// ErrInvalidSize, and a whole message whose body is too short for its fields
+// with an error wrapping ErrInvalidMessage. The Reader and Greedy fields are
+// not used.
+func (d *Decoder) TryDecode(b []byte) (Message, int, error) {
+	if len(b) < HeaderSize {
+		return nil, 0, ErrPayloadTooShort
+	}
+
+	size := binary.LittleEndian.Uint32(b[0:4])
+	if size < HeaderSize {
+		return nil, 0, fmt.Errorf("%w %d", ErrInvalidSize, size)
+	}
+	if d.MessageSize > 0 && size > d.MessageSize {
+		return nil, 0, ErrMessageTooBig
+	}
+	if uint64(len(b)) < uint64(size) {
+		return nil, 0, ErrPayloadTooShort
+	}
+
+	mt := MessageType(b[4])
+	m, err := d.message(mt, size)
+	if err != nil {
+		return nil, 0, err
+	}
+	if err := d.unmarshal(m, b[HeaderSize:size]); err != nil {
+		// The whole message is there, so waiting will not help.
+		if errors.Is(err, ErrPayloadTooShort) {
+			err = fmt.Errorf("%w %v: body too short", ErrInvalidMessage, mt)
+		}
+		return nil, 0, err
+	}
+	d.hook(m, nil)
+	return m, int(size), nil
+}
+
+// DecodeAt decodes a single message at offset off of r, such as a file holding
+// a recorded session. It returns the message and the amount of bytes it
+// occupied, which is the offset of the next message relative to off. io.EOF
+// is returned if off is at the end of r. The Reader and Greedy fields are not
+// used.
+func (d *Decoder) DecodeAt(r io.ReaderAt, off int64) (Message, int, error) {
+	if off < 0 {
+		return nil, 0, fmt.Errorf("negative offset %d", off)
+	}
+
+	sr := io.NewSectionReader(r, off, math.MaxInt64-off)
+	m, err := d.simpleRead(sr, nil)
+	if err != nil {
+		return nil, 0, err
+	}
+	d.hook(m, nil)
+	n, _ := sr.Seek(0, io.SeekCurrent)
+	return m, int(n), nil
+}
+
+// ReadMessageInto is like ReadMessage, but reads the message body into buf,
+// which must be at least MessageSize bytes long. Bodies larger than buf are
+// rejected with ErrMessageTooBig, leaving the stream in the middle of the
+// message. The Data of a returned ReadResponse references buf rather than a
+// copy, so it is only valid until buf is reused, allowing reads to be
+// streamed without allocating. ReadMessageInto is not supported for greedy
+// decoding, and does not apply StreamReads.
+func (d *Decoder) ReadMessageInto(buf []byte) (Message, error) {
+	if d.Greedy {
+		return nil, errors.New("ReadMessageInto is not supported by greedy decoders")
+	}
+	if err := d.discardStream(); err != nil {
+		return nil, err
+	}
+	return d.hook(d.simpleRead(d.Reader, buf))
+}
+
+// ReadMessageContext is like ReadMessage, but stops reading when ctx is done,
+// returning ctx.Err(). As an io.Reader cannot be cancelled, the context is
+// checked between the reads of a message, and a single read that is already
+// blocked in the underlying reader cannot be pre-empted. StreamReads is not
+// applied, as the streamed data would outlive ctx.
+func (d *Decoder) ReadMessageContext(ctx context.Context) (Message, error) {
+	r := ctxReader{ctx: ctx, r: d.Reader}
+	if d.Greedy {
+		return d.hook(d.greedyRead(r))
+	}
+	if err := d.discardStream(); err != nil {
+		return nil, err
+	}
+	return d.hook(d.simpleRead(r, nil))
+}
+
+// ctxReader is a reader that fails once its context is done.
+type ctxReader struct {
+	ctx context.Context
+	r   io.Reader
+}
+
+func (cr ctxReader) Read(p []byte) (int, error) {
+	if err := cr.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return cr.r.Read(p)
+}
+
+// ctxWriter is a writer that fails once its context is done.
+type ctxWriter struct {
+	ctx context.Context
+	w   io.Writer
+}
+
+func (cw ctxWriter) Write(p []byte) (int, error) {
+	if err := cw.ctx.Err(); err != nil {
+		return 0, err
 	}
-	return d.simpleRead()
+	return cw.w.Write(p)
 }
@@ -1,8 +1,16 @@
 package qp
 
 import (
+	"bufio"
 	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
 	"io"
+	"io/ioutil"
+	"net"
+	"reflect"
+	"sync"
 	"testing"
 	"time"
 )
@@ -21,6 +29,18 @@ func (b *ByteReader) Read(p []byte) (int, error) {
 	return b.Reader.Read(p[0:1])
 }
 
+// ByteWriter is a writer that only writes a single byte at a time.
+type ByteWriter struct {
+	io.Writer
+}
+
+func (b *ByteWriter) Write(p []byte) (int, error) {
+	if len(p) == 0 {
+		return 0, nil
+	}
+	return b.Writer.Write(p[0:1])
+}
+
 func TestDecoder(t *testing.T) {
 	// Prepare the input
 
@@ -168,3 +188,801 @@ func TestEncoder(t *testing.T) {
 		}
 	}
 }
+
+func TestEncoderShortWrites(t *testing.T) {
+	buf := new(bytes.Buffer)
+	e := Encoder{
+		Protocol:    NineP2000,
+		Writer:      &ByteWriter{Writer: buf},
+		MessageSize: 1024,
+	}
+
+	for _, tt := range MessageTestData {
+		if err := e.WriteMessage(tt.input); err != nil {
+			t.Fatalf("unable to write to buffer: %v", err)
+		}
+	}
+
+	x := buf.Bytes()
+	for i, v := range MessageTestData {
+		length := len(v.container)
+		if len(x) < length {
+			t.Fatalf("test %d: not enough data written to read %T: Expected %d, got %d", i, v.input, length, len(x))
+		}
+
+		segment := x[:length]
+		x = x[length:]
+
+		if bytes.Compare(segment, v.container) != 0 {
+			t.Errorf("test %d: encoded message did not match reference.\nExpected: %#v\n\tGot:      %#v", i, v.container, segment)
+		}
+	}
+
+	if len(x) != 0 {
+		t.Errorf("%d bytes of trailing data written", len(x))
+	}
+}
+
+// sparseMessage is a custom message leaving all but its tag unwritten.
+type sparseMessage struct {
+	Tag
+}
+
+func (sm *sparseMessage) EncodedSize() int { return 2 + 8 }
+
+func (sm *sparseMessage) Marshal(b []byte) error {
+	binary.LittleEndian.PutUint16(b[0:2], uint16(sm.Tag))
+	return nil
+}
+
+func (sm *sparseMessage) Unmarshal(b []byte) error {
+	if len(b) < 2+8 {
+		return ErrPayloadTooShort
+	}
+	sm.Tag = Tag(binary.LittleEndian.Uint16(b[0:2]))
+	return nil
+}
+
+func TestEncoderZeroesBuffer(t *testing.T) {
+	p := Extend(NineP2000, map[MessageType]func() Message{
+		200: func() Message { return &sparseMessage{} },
+	})
+	buf := new(bytes.Buffer)
+	e := NewEncoder(p, buf)
+
+	// Leave a message in the pooled buffer for the sparse message to reuse.
+	if err := e.WriteMessage(&WriteRequest{Tag: 1, Fid: NOFID, Offset: 1<<64 - 1, Data: bytes.Repeat([]byte{0xFF}, 64)}); err != nil {
+		t.Fatalf("write failed: %v", err)
+	}
+	buf.Reset()
+	if err := e.WriteMessage(&sparseMessage{Tag: 2}); err != nil {
+		t.Fatalf("write failed: %v", err)
+	}
+
+	expected := []byte{HeaderSize + 10, 0, 0, 0, 200, 2, 0, 0, 0, 0, 0, 0, 0, 0, 0}
+	if !bytes.Equal(buf.Bytes(), expected) {
+		t.Errorf("got %x, expected unwritten bytes to be zero: %x", buf.Bytes(), expected)
+	}
+}
+
+// CancelReader is a reader that calls cancel after the first read.
+type CancelReader struct {
+	io.Reader
+	cancel func()
+}
+
+func (c *CancelReader) Read(p []byte) (int, error) {
+	n, err := c.Reader.Read(p)
+	c.cancel()
+	return n, err
+}
+
+func TestDecodeContext(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	buf := bytes.NewBuffer(MessageTestData[0].container)
+	if _, err := DecodeContext(ctx, buf); err != context.Canceled {
+		t.Errorf("expected %v from cancelled context, got %v", context.Canceled, err)
+	}
+
+	// Cancel after the first byte has been read.
+	ctx, cancel = context.WithCancel(context.Background())
+	r := &ByteReader{Reader: bytes.NewBuffer(MessageTestData[0].container)}
+	if _, err := DecodeContext(ctx, &CancelReader{Reader: r, cancel: cancel}); !errors.Is(err, context.Canceled) {
+		t.Errorf("expected %v from context cancelled mid-message, got %v", context.Canceled, err)
+	}
+
+	m, err := DecodeContext(context.Background(), bytes.NewBuffer(MessageTestData[0].container))
+	if err != nil {
+		t.Fatalf("decode failed: %v", err)
+	}
+	if !CompareMarshallables(MessageTestData[0].input, m) {
+		t.Errorf("decoded message did not match reference\n\tExpected: %#v\n\tGot:      %#v", MessageTestData[0].input, m)
+	}
+}
+
+func TestEncodeContext(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	buf := new(bytes.Buffer)
+	if err := EncodeContext(ctx, buf, MessageTestData[0].input); err != context.Canceled {
+		t.Errorf("expected %v from cancelled context, got %v", context.Canceled, err)
+	}
+	if buf.Len() != 0 {
+		t.Errorf("%d bytes written with cancelled context", buf.Len())
+	}
+
+	if err := EncodeContext(context.Background(), buf, MessageTestData[0].input); err != nil {
+		t.Fatalf("encode failed: %v", err)
+	}
+	if bytes.Compare(buf.Bytes(), MessageTestData[0].container) != 0 {
+		t.Errorf("encoded message did not match reference.\nExpected: %#v\n\tGot:      %#v", MessageTestData[0].container, buf.Bytes())
+	}
+}
+
+func TestDecoderMessageTooBig(t *testing.T) {
+	for _, greedy := range []bool{false, true} {
+		// Only the header is provided, so an attempt to read the body would
+		// fail with a different error.
+		buf := bytes.NewBuffer([]byte{0xFF, 0xFF, 0xFF, 0xFF, byte(Rread)})
+		d := Decoder{
+			Protocol:    NineP2000,
+			Reader:      buf,
+			MessageSize: 1024,
+			Greedy:      greedy,
+		}
+		d.Reset()
+
+		if _, err := d.ReadMessage(); err != ErrMessageTooBig {
+			t.Errorf("greedy %v: expected %v, got %v", greedy, ErrMessageTooBig, err)
+		}
+	}
+}
+
+func TestDecoderEOF(t *testing.T) {
+	container := MessageTestData[0].container
+	for _, greedy := range []bool{false, true} {
+		// A stream ending at a message boundary yields io.EOF.
+		d := NewDecoder(NineP2000, bytes.NewReader(container))
+		d.MessageSize = 1024
+		d.Greedy = greedy
+
+		if _, err := d.ReadMessage(); err != nil {
+			t.Fatalf("greedy %v: first read failed: %v", greedy, err)
+		}
+		if _, err := d.ReadMessage(); err != io.EOF {
+			t.Errorf("greedy %v: expected %v at boundary, got %v", greedy, io.EOF, err)
+		}
+
+		// A stream ending in the header or body yields io.ErrUnexpectedEOF.
+		for _, n := range []int{2, HeaderSize, len(container) - 1} {
+			d := NewDecoder(NineP2000, &ByteReader{Reader: bytes.NewReader(container[:n])})
+			d.MessageSize = 1024
+			d.Greedy = greedy
+
+			if _, err := d.ReadMessage(); !errors.Is(err, io.ErrUnexpectedEOF) {
+				t.Errorf("greedy %v: expected %v after %d bytes, got %v", greedy, io.ErrUnexpectedEOF, n, err)
+			}
+		}
+	}
+}
+
+func TestDecoderPipeClosed(t *testing.T) {
+	var buf bytes.Buffer
+	if err := NewEncoder(NineP2000, &buf).WriteMessage(&ReadResponse{Tag: 1, Data: []byte("hello, world")}); err != nil {
+		t.Fatalf("write failed: %v", err)
+	}
+	frame := buf.Bytes()
+
+	for _, greedy := range []bool{false, true} {
+		for _, n := range []int{0, 3, len(frame) / 2} {
+			cr, cw := net.Pipe()
+			go func() {
+				cw.Write(frame[:n])
+				cw.Close()
+			}()
+
+			d := NewDecoder(NineP2000, cr)
+			d.MessageSize = 1024
+			d.Greedy = greedy
+			_, err := d.ReadMessage()
+			cr.Close()
+
+			if n == 0 {
+				if err != io.EOF {
+					t.Errorf("greedy %v: closed at boundary: expected bare %v, got %#v", greedy, io.EOF, err)
+				}
+				continue
+			}
+			if !errors.Is(err, ErrPayloadTooShort) || !errors.Is(err, io.ErrUnexpectedEOF) {
+				t.Errorf("greedy %v: closed after %d bytes: expected %v and %v, got %v", greedy, n, ErrPayloadTooShort, io.ErrUnexpectedEOF, err)
+			}
+		}
+	}
+}
+
+func TestEncoderFlush(t *testing.T) {
+	buf := new(bytes.Buffer)
+	bw := bufio.NewWriter(buf)
+	e := NewEncoder(NineP2000, bw)
+
+	for _, tt := range MessageTestData {
+		if err := e.WriteMessage(tt.input); err != nil {
+			t.Fatalf("write failed: %v", err)
+		}
+	}
+	if buf.Len() != 0 {
+		t.Errorf("expected writes to be buffered, got %d bytes", buf.Len())
+	}
+
+	if err := e.Flush(); err != nil {
+		t.Fatalf("flush failed: %v", err)
+	}
+
+	var expected []byte
+	for _, tt := range MessageTestData {
+		expected = append(expected, tt.container...)
+	}
+	if !bytes.Equal(buf.Bytes(), expected) {
+		t.Errorf("flushed data did not match reference")
+	}
+
+	// Flush is a no-op on unbuffered writers.
+	if err := NewEncoder(NineP2000, new(bytes.Buffer)).Flush(); err != nil {
+		t.Errorf("flush on unbuffered writer failed: %v", err)
+	}
+}
+
+func BenchmarkEncoderWrite(b *testing.B) {
+	m := &WriteRequest{Tag: 1, Fid: 2, Offset: 0, Data: make([]byte, 8192)}
+	e := NewEncoder(NineP2000, ioutil.Discard)
+
+	b.ReportAllocs()
+	b.SetBytes(int64(m.EncodedSize() + HeaderSize))
+	for i := 0; i < b.N; i++ {
+		if err := e.WriteMessage(m); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// benchmarkMessages are representative messages for the codec benchmarks.
+var benchmarkMessages = []struct {
+	name string
+	m    Message
+}{
+	{"Tread", &ReadRequest{Tag: 1, Fid: 2, Offset: 8192, Count: 8192}},
+	{"Rread", &ReadResponse{Tag: 1, Data: make([]byte, 8192-ReadOverhead)}},
+	{"Rstat", &StatResponse{Tag: 1, Stat: *PrimitiveTestData[1].input.(*Stat)}},
+}
+
+func BenchmarkEncode(b *testing.B) {
+	for _, bm := range benchmarkMessages {
+		b.Run(bm.name, func(b *testing.B) {
+			e := NewEncoder(NineP2000, ioutil.Discard)
+
+			b.ReportAllocs()
+			b.SetBytes(int64(bm.m.EncodedSize() + HeaderSize))
+			for i := 0; i < b.N; i++ {
+				if err := e.WriteMessage(bm.m); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+func BenchmarkDecode(b *testing.B) {
+	for _, bm := range benchmarkMessages {
+		buf := new(bytes.Buffer)
+		if err := NewEncoder(NineP2000, buf).WriteMessage(bm.m); err != nil {
+			b.Fatal(err)
+		}
+		msg := buf.Bytes()
+
+		for _, pool := range []bool{false, true} {
+			name := bm.name
+			if pool {
+				name += "/Pooled"
+			}
+			b.Run(name, func(b *testing.B) {
+				r := bytes.NewReader(msg)
+				d := NewDecoder(NineP2000, r)
+				d.PoolBuffers = pool
+
+				b.ReportAllocs()
+				b.SetBytes(int64(len(msg)))
+				for i := 0; i < b.N; i++ {
+					r.Reset(msg)
+					if _, err := d.ReadMessage(); err != nil {
+						b.Fatal(err)
+					}
+				}
+			})
+		}
+	}
+}
+
+func BenchmarkDecodeSkip(b *testing.B) {
+	m := &WriteRequest{Tag: 1, Fid: 2, Offset: 0, Data: make([]byte, 8192)}
+	buf := new(bytes.Buffer)
+	if err := NewEncoder(NineP2000, buf).WriteMessage(m); err != nil {
+		b.Fatal(err)
+	}
+	msg := buf.Bytes()
+
+	for _, skip := range []bool{false, true} {
+		name := "Full"
+		if skip {
+			name = "Skipped"
+		}
+		b.Run(name, func(b *testing.B) {
+			r := bytes.NewReader(msg)
+			d := NewDecoder(NineP2000, r)
+			d.Skip = func(MessageType) bool { return skip }
+
+			b.ReportAllocs()
+			b.SetBytes(int64(len(msg)))
+			for i := 0; i < b.N; i++ {
+				r.Reset(msg)
+				if _, err := d.ReadMessage(); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+func BenchmarkEncoderAppend(b *testing.B) {
+	m := &WriteRequest{Tag: 1, Fid: 2, Offset: 0, Data: make([]byte, 8192)}
+	e := NewEncoder(NineP2000, nil)
+	buf := make([]byte, 0, m.EncodedSize()+HeaderSize)
+
+	b.ReportAllocs()
+	b.SetBytes(int64(m.EncodedSize() + HeaderSize))
+	for i := 0; i < b.N; i++ {
+		var err error
+		if buf, err = e.AppendMessage(buf[:0], m); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func TestAppendEncode(t *testing.T) {
+	for _, tt := range MessageTestData {
+		prefix := []byte("prefix")
+		b, err := AppendEncode(prefix, tt.input)
+		if err != nil {
+			t.Errorf("append failed for %T: %v", tt.input, err)
+			continue
+		}
+		if !bytes.Equal(b[:len(prefix)], []byte("prefix")) {
+			t.Errorf("append clobbered prefix for %T: %q", tt.input, b[:len(prefix)])
+		}
+		if !bytes.Equal(b[len(prefix):], tt.container) {
+			t.Errorf("append output for %T did not match\nexpected: %#v\ngot:      %#v", tt.input, tt.container, b[len(prefix):])
+		}
+	}
+
+	e := NewEncoder(NineP2000, nil)
+	e.MessageSize = 16
+	dst := []byte("x")
+	b, err := e.AppendMessage(dst, &WriteRequest{Data: make([]byte, 16)})
+	if err != ErrMessageTooBig {
+		t.Errorf("expected %v, got %v", ErrMessageTooBig, err)
+	}
+	if !bytes.Equal(b, dst) {
+		t.Errorf("failed append modified dst: %q", b)
+	}
+}
+
+func TestEncoderMessageTooBig(t *testing.T) {
+	buf := new(bytes.Buffer)
+	e := NewEncoder(NineP2000, buf)
+	e.MessageSize = 64
+
+	m := &WriteRequest{Data: make([]byte, 64-HeaderSize-(2+4+8+4))}
+	if err := e.WriteMessage(m); err != nil {
+		t.Fatalf("message of exactly MessageSize failed: %v", err)
+	}
+	if buf.Len() != 64 {
+		t.Fatalf("expected 64 bytes written, got %d", buf.Len())
+	}
+
+	buf.Reset()
+	m.Data = append(m.Data, 0)
+	if err := e.WriteMessage(m); err != ErrMessageTooBig {
+		t.Errorf("expected %v, got %v", ErrMessageTooBig, err)
+	}
+	if buf.Len() != 0 {
+		t.Errorf("oversized message wrote %d bytes", buf.Len())
+	}
+}
+
+func TestDecoderSizeTooSmall(t *testing.T) {
+	// Sizes smaller than the header itself must not wrap around when the
+	// header size is subtracted.
+	for _, size := range []byte{0, 3, HeaderSize - 1} {
+		frame := []byte{size, 0x0, 0x0, 0x0, byte(Rclunk), 0x0, 0x0}
+
+		for _, greedy := range []bool{false, true} {
+			d := Decoder{
+				Protocol:    NineP2000,
+				Reader:      bytes.NewBuffer(frame),
+				MessageSize: 1024,
+				Greedy:      greedy,
+			}
+			d.Reset()
+
+			if _, err := d.ReadMessage(); err != ErrPayloadTooShort {
+				t.Errorf("size %d, greedy %v: expected %v, got %v", size, greedy, ErrPayloadTooShort, err)
+			}
+		}
+
+		d := Decoder{Protocol: NineP2000, Reader: bytes.NewBuffer(frame), StreamReads: true}
+		if _, err := d.ReadMessage(); err != ErrPayloadTooShort {
+			t.Errorf("size %d, streaming: expected %v, got %v", size, ErrPayloadTooShort, err)
+		}
+		if _, _, err := DecodeAt(bytes.NewReader(frame), 0); err != ErrPayloadTooShort {
+			t.Errorf("size %d, DecodeAt: expected %v, got %v", size, ErrPayloadTooShort, err)
+		}
+	}
+}
+
+func TestDecoderStrict(t *testing.T) {
+	tables := []struct {
+		p    Protocol
+		data []MessageTestEntry
+	}{
+		{NineP2000, MessageTestData},
+		{NineP2000Dotu, MessageTestDataDotu},
+		{NineP2000Dote, MessageTestDataDote},
+		{NineP2000Dotl, MessageTestDataDotl},
+	}
+
+	for _, table := range tables {
+		for i, tt := range table.data {
+			// Pad the body with a byte, updating the size field.
+			padded := append(append([]byte{}, tt.container...), 0xFF)
+			binary.LittleEndian.PutUint32(padded[0:4], uint32(len(padded)))
+
+			for _, greedy := range []bool{false, true} {
+				d := NewDecoder(table.p, bytes.NewReader(tt.container))
+				d.MessageSize = 1024
+				d.Greedy = greedy
+				d.Strict = true
+				if _, err := d.ReadMessage(); err != nil {
+					t.Errorf("test %d: greedy %v: strict decode of %T failed: %v", i, greedy, tt.input, err)
+				}
+
+				d = NewDecoder(table.p, bytes.NewReader(padded))
+				d.MessageSize = 1024
+				d.Greedy = greedy
+				d.Strict = true
+				if _, err := d.ReadMessage(); err != ErrTrailingData {
+					t.Errorf("test %d: greedy %v: padded %T: expected %v, got %v", i, greedy, tt.input, ErrTrailingData, err)
+				}
+
+				d = NewDecoder(table.p, bytes.NewReader(padded))
+				d.MessageSize = 1024
+				d.Greedy = greedy
+				if _, err := d.ReadMessage(); err != nil {
+					t.Errorf("test %d: greedy %v: lenient decode of padded %T failed: %v", i, greedy, tt.input, err)
+				}
+			}
+		}
+	}
+}
+
+func TestDecoderShortHeader(t *testing.T) {
+	container := MessageTestData[0].container
+	tests := []struct {
+		n   int
+		err string
+	}{
+		{0, "EOF"},
+		{2, "short header read (2/5 bytes): unexpected EOF"},
+		{HeaderSize, "payload too short: unexpected EOF"},
+	}
+
+	for _, greedy := range []bool{false, true} {
+		for _, tt := range tests {
+			d := NewDecoder(NineP2000, bytes.NewReader(container[:tt.n]))
+			d.MessageSize = 1024
+			d.Greedy = greedy
+
+			_, err := d.ReadMessage()
+			if err == nil || err.Error() != tt.err {
+				t.Errorf("greedy %v: %d bytes: expected %q, got %v", greedy, tt.n, tt.err, err)
+			}
+			// A clean end of stream must not be wrapped.
+			if tt.n == 0 && err != io.EOF {
+				t.Errorf("greedy %v: expected bare io.EOF, got %#v", greedy, err)
+			}
+		}
+	}
+}
+
+func TestDecoderTruncatedBody(t *testing.T) {
+	// The header promises more bytes than the reader provides.
+	c := MessageTestData[0].container
+	for n := HeaderSize; n < len(c); n++ {
+		for _, greedy := range []bool{false, true} {
+			d := NewDecoder(NineP2000, bytes.NewReader(c[:n]))
+			d.MessageSize = 1024
+			d.Greedy = greedy
+			_, err := d.ReadMessage()
+			if !errors.Is(err, ErrPayloadTooShort) || !errors.Is(err, io.ErrUnexpectedEOF) {
+				t.Errorf("greedy %v: %d bytes: expected %v and %v, got %v", greedy, n, ErrPayloadTooShort, io.ErrUnexpectedEOF, err)
+			}
+		}
+	}
+}
+
+func TestEncoderConcurrent(t *testing.T) {
+	const writers, count = 8, 100
+
+	pr, pw := io.Pipe()
+	e := NewEncoder(NineP2000, pw)
+
+	// Each writer writes messages of its own size, so interleaving would
+	// corrupt the stream.
+	go func() {
+		var wg sync.WaitGroup
+		for w := 0; w < writers; w++ {
+			wg.Add(1)
+			go func(w int) {
+				defer wg.Done()
+				m := &WriteRequest{Tag: Tag(w), Data: bytes.Repeat([]byte{byte(w)}, 100*w)}
+				for i := 0; i < count; i++ {
+					if err := e.WriteMessage(m); err != nil {
+						t.Errorf("writer %d: write failed: %v", w, err)
+						return
+					}
+				}
+			}(w)
+		}
+		wg.Wait()
+		pw.Close()
+	}()
+
+	d := NewDecoder(NineP2000, pr)
+	d.Strict = true
+	seen := make(map[Tag]int)
+	for {
+		m, err := d.ReadMessage()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("read failed: %v", err)
+		}
+		wr, ok := m.(*WriteRequest)
+		if !ok || !bytes.Equal(wr.Data, bytes.Repeat([]byte{byte(wr.Tag)}, 100*int(wr.Tag))) {
+			t.Fatalf("read malformed message %v", m)
+		}
+		seen[wr.Tag]++
+	}
+	for w := 0; w < writers; w++ {
+		if seen[Tag(w)] != count {
+			t.Errorf("writer %d: read %d messages, expected %d", w, seen[Tag(w)], count)
+		}
+	}
+}
+
+func TestDecoderReadMessageInto(t *testing.T) {
+	buf := new(bytes.Buffer)
+	e := NewEncoder(NineP2000, buf)
+	e.WriteMessage(&ReadResponse{Tag: 1, Data: []byte("hello")})
+	e.WriteMessage(&ClunkRequest{Tag: 2, Fid: 3})
+	e.WriteMessage(&ReadResponse{Tag: 3, Data: []byte("world")})
+
+	d := NewDecoder(NineP2000, buf)
+	body := make([]byte, 64)
+
+	m, err := d.ReadMessageInto(body)
+	if err != nil {
+		t.Fatalf("read failed: %v", err)
+	}
+	rr := m.(*ReadResponse)
+	if string(rr.Data) != "hello" {
+		t.Errorf("got data %q, expected %q", rr.Data, "hello")
+	}
+	if &rr.Data[0] != &body[6] {
+		t.Errorf("data does not reference the provided buffer")
+	}
+
+	// Other messages are decoded as usual.
+	if m, err := d.ReadMessageInto(body); err != nil || !MessagesEqual(m, &ClunkRequest{Tag: 2, Fid: 3}) {
+		t.Errorf("got %v, %v, expected clunk", m, err)
+	}
+
+	// The buffer is reused by the next read.
+	if _, err := d.ReadMessageInto(body); err != nil {
+		t.Fatalf("read failed: %v", err)
+	}
+	if string(rr.Data) != "world" {
+		t.Errorf("got data %q after buffer reuse, expected %q", rr.Data, "world")
+	}
+
+	e.WriteMessage(&ReadResponse{Tag: 4, Data: make([]byte, 64)})
+	if _, err := d.ReadMessageInto(body); err != ErrMessageTooBig {
+		t.Errorf("expected %v for body larger than buffer, got %v", ErrMessageTooBig, err)
+	}
+}
+
+func BenchmarkDecodeInto(b *testing.B) {
+	m := &ReadResponse{Tag: 1, Data: make([]byte, 8192-ReadOverhead)}
+	buf := new(bytes.Buffer)
+	NewEncoder(NineP2000, buf).WriteMessage(m)
+	msg := buf.Bytes()
+
+	r := bytes.NewReader(msg)
+	d := NewDecoder(NineP2000, r)
+	body := make([]byte, 8192)
+
+	b.ReportAllocs()
+	b.SetBytes(int64(len(msg)))
+	for i := 0; i < b.N; i++ {
+		r.Reset(msg)
+		if _, err := d.ReadMessageInto(body); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func TestTryDecode(t *testing.T) {
+	first, second := MessageTestData[0], MessageTestData[1]
+
+	// One and a half messages.
+	b := append(append([]byte{}, first.container...), second.container[:len(second.container)/2]...)
+
+	m, n, err := TryDecode(b)
+	if err != nil {
+		t.Fatalf("decode failed: %v", err)
+	}
+	if n != len(first.container) || !MessagesEqual(m, first.input) {
+		t.Errorf("got %v occupying %d bytes, expected %v occupying %d", m, n, first.input, len(first.container))
+	}
+	b = b[n:]
+
+	for l := 0; l < len(b); l++ {
+		if m, n, err := TryDecode(b[:l]); m != nil || n != 0 || err != ErrPayloadTooShort {
+			t.Errorf("%d bytes: got %v, %d, %v, expected %v", l, m, n, err, ErrPayloadTooShort)
+		}
+	}
+
+	b = append(b, second.container[len(second.container)/2:]...)
+	m, n, err = TryDecode(b)
+	if err != nil {
+		t.Fatalf("decode failed: %v", err)
+	}
+	if n != len(b) || !MessagesEqual(m, second.input) {
+		t.Errorf("got %v occupying %d bytes, expected %v occupying %d", m, n, second.input, len(b))
+	}
+
+	// A malformed size cannot be fixed by waiting for more data.
+	_, _, err = TryDecode([]byte{3, 0, 0, 0, byte(Tclunk), 0, 0})
+	if errors.Is(err, ErrPayloadTooShort) || !errors.Is(err, ErrInvalidSize) {
+		t.Errorf("malformed size: expected %v, got %v", ErrInvalidSize, err)
+	}
+
+	// Neither can a whole message whose version string overruns it.
+	_, _, err = TryDecode(truncatedBody)
+	if errors.Is(err, ErrPayloadTooShort) || !errors.Is(err, ErrInvalidMessage) {
+		t.Errorf("truncated body: expected %v, got %v", ErrInvalidMessage, err)
+	}
+}
+
+// truncatedBody is a whole Tversion frame whose version string declares
+// five bytes that are not there.
+var truncatedBody = []byte{13, 0, 0, 0, byte(Tversion), 0xFF, 0xFF, 0x00, 0x20, 0x00, 0x00, 5, 0}
+
+func TestDecodeAt(t *testing.T) {
+	var (
+		recording []byte
+		offsets   []int64
+	)
+	for _, tt := range MessageTestData {
+		offsets = append(offsets, int64(len(recording)))
+		recording = append(recording, tt.container...)
+	}
+	r := bytes.NewReader(recording)
+
+	// Build an index by walking the recording, then decode it backwards.
+	var index []int64
+	for off := int64(0); ; {
+		_, n, err := DecodeAt(r, off)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("offset %d: decode failed: %v", off, err)
+		}
+		index = append(index, off)
+		off += int64(n)
+	}
+	if !reflect.DeepEqual(index, offsets) {
+		t.Fatalf("got offsets %v, expected %v", index, offsets)
+	}
+
+	for i := len(index) - 1; i >= 0; i-- {
+		m, n, err := DecodeAt(r, index[i])
+		if err != nil {
+			t.Fatalf("test %d: decode failed: %v", i, err)
+		}
+		if n != len(MessageTestData[i].container) || !MessagesEqual(m, MessageTestData[i].input) {
+			t.Errorf("test %d: got %v occupying %d bytes, expected %v", i, m, n, MessageTestData[i].input)
+		}
+	}
+
+	if _, _, err := DecodeAt(r, int64(len(recording))-1); err == nil {
+		t.Errorf("decoding a truncated message succeeded")
+	}
+}
+
+func TestDecoderSkip(t *testing.T) {
+	var stream []byte
+	for _, tt := range MessageTestData {
+		stream = append(stream, tt.container...)
+	}
+	skip := func(mt MessageType) bool { return mt == Twrite || mt == Rread }
+
+	for _, greedy := range []bool{false, true} {
+		d := &Decoder{
+			Protocol:    NineP2000,
+			Reader:      bytes.NewReader(stream),
+			Greedy:      greedy,
+			MessageSize: 8192,
+			Strict:      true,
+			Skip:        skip,
+		}
+
+		var skipped int
+		for i, tt := range MessageTestData {
+			m, err := d.ReadMessage()
+			if err != nil {
+				t.Fatalf("greedy %t, test %d: read failed: %v", greedy, i, err)
+			}
+			mt := MessageType(tt.container[4])
+			if !skip(mt) {
+				if !MessagesEqual(m, tt.input) {
+					t.Errorf("greedy %t, test %d: got %v, expected %v", greedy, i, m, tt.input)
+				}
+				continue
+			}
+
+			skipped++
+			expected := &RawMessage{Tag: tt.input.GetTag(), Type: mt, Size: uint32(len(tt.container))}
+			if rm, ok := m.(*RawMessage); !ok || *rm != *expected {
+				t.Errorf("greedy %t, test %d: got %v, expected %v", greedy, i, m, expected)
+			}
+		}
+		if skipped == 0 {
+			t.Fatalf("greedy %t: no messages skipped", greedy)
+		}
+		if _, err := d.ReadMessage(); err != io.EOF {
+			t.Errorf("greedy %t: expected %v, got %v", greedy, io.EOF, err)
+		}
+	}
+
+	if err := (&RawMessage{}).Marshal(nil); err != ErrBodySkipped {
+		t.Errorf("marshal: expected %v, got %v", ErrBodySkipped, err)
+	}
+
+	// A skipped body must still be complete.
+	d := &Decoder{Protocol: NineP2000, Skip: skip}
+	w := MessageTestData[0].container
+	for _, tt := range MessageTestData {
+		if skip(MessageType(tt.container[4])) {
+			w = tt.container
+			break
+		}
+	}
+	d.Reader = bytes.NewReader(w[:len(w)-1])
+	if _, err := d.ReadMessage(); !errors.Is(err, ErrPayloadTooShort) {
+		t.Errorf("truncated: expected %v, got %v", ErrPayloadTooShort, err)
+	}
+}
@@ -0,0 +1,156 @@
+package qp
+
+import (
+	"fmt"
+	"io"
+	"strings"
+)
+
+// DialOption configures Dial.
+type DialOption func(*dialConfig)
+
+type dialConfig struct {
+	protocol Protocol
+	msize    uint32
+	version  string
+	uidno    uint32
+}
+
+// WithProtocol sets the protocol spoken by Dial, which is the Default
+// protocol if not set.
+func WithProtocol(p Protocol) DialOption {
+	return func(dc *dialConfig) { dc.protocol = p }
+}
+
+// WithMessageSize sets the message size proposed by Dial, which is 8192 bytes
+// if not set.
+func WithMessageSize(msize uint32) DialOption {
+	return func(dc *dialConfig) { dc.msize = msize }
+}
+
+// WithVersion sets the protocol version proposed by Dial, which is Version if
+// not set.
+func WithVersion(version string) DialOption {
+	return func(dc *dialConfig) { dc.version = version }
+}
+
+// WithUIDno sets the numeric user ID Dial attaches as when speaking
+// 9P2000.u or 9P2000.L, which is NONUNAME if not set. See Client.SetUIDno.
+func WithUIDno(uid uint32) DialOption {
+	return func(dc *dialConfig) { dc.uidno = uid }
+}
+
+// Dial starts a session over rwc, returning a Client and the fid of the root
+// of the file tree aname, attached to as user uname without authentication.
+// The message size and version are negotiated with Negotiate. If any step
+// fails, rwc is closed and the error is returned.
+func Dial(rwc io.ReadWriteCloser, uname, aname string, opts ...DialOption) (*Client, Fid, error) {
+	dc := dialConfig{
+		protocol: Default,
+		msize:    defaultMessageSize,
+		version:  Version,
+		uidno:    NONUNAME,
+	}
+	for _, opt := range opts {
+		opt(&dc)
+	}
+
+	c := NewClient(rwc, dc.protocol)
+	c.SetUIDno(dc.uidno)
+	if _, _, err := c.Negotiate(dc.msize, dc.version); err != nil {
+		c.Close()
+		return nil, NOFID, err
+	}
+	root, _, err := c.Attach(NOFID, uname, aname)
+	if err != nil {
+		c.Close()
+		return nil, NOFID, err
+	}
+	return c, root, nil
+}
+
+// versionProtocols maps the version strings known by this package to their
+// protocols.
+var versionProtocols = map[string]Protocol{
+	Version:     NineP2000,
+	VersionDotu: NineP2000Dotu,
+	VersionDote: NineP2000Dote,
+	VersionDotl: NineP2000Dotl,
+}
+
+// DialBest negotiates the first of versions the server over rwc supports,
+// trying them in order, so the richest version should be listed first, and
+// returns a Client speaking the protocol of the selected version together
+// with that version. A server answering with another listed version instead,
+// as servers downgrading a version do, has that version selected without a
+// retry. The message size proposed is set by WithMessageSize, and the
+// negotiated size is set on the Client. The user ID later sent by Auth and
+// Attach is set by WithUIDno. Other options do not apply, and are ignored.
+//
+// ErrVersionRejected is returned if none of versions are supported, and an
+// error if one is not known by this package. If negotiation fails, rwc is
+// closed and the error is returned. Unlike Dial, DialBest does not attach,
+// leaving authentication to the caller.
+func DialBest(rwc io.ReadWriteCloser, versions []string, opts ...DialOption) (*Client, string, error) {
+	dc := dialConfig{
+		msize: defaultMessageSize,
+		uidno: NONUNAME,
+	}
+	for _, opt := range opts {
+		opt(&dc)
+	}
+
+	p, version, msize, err := negotiateBest(rwc, versions, dc.msize)
+	if err != nil {
+		rwc.Close()
+		return nil, "", err
+	}
+	c := NewClient(rwc, p)
+	c.e.MessageSize = msize
+	c.SetUIDno(dc.uidno)
+	return c, version, nil
+}
+
+// negotiateBest runs the version negotiation of DialBest, proposing msize,
+// and returns the protocol, version and message size selected.
+func negotiateBest(rw io.ReadWriter, versions []string, msize uint32) (Protocol, string, uint32, error) {
+	for _, v := range versions {
+		if _, ok := versionProtocols[v]; !ok {
+			return nil, "", 0, fmt.Errorf("unsupported version %q", v)
+		}
+	}
+
+	// Version messages are the same in every protocol.
+	e := NewEncoder(NineP2000, rw)
+	d := NewDecoder(NineP2000, rw)
+	d.MessageSize = msize
+
+	for _, v := range versions {
+		if err := e.WriteMessage(&VersionRequest{Tag: NOTAG, MessageSize: msize, Version: v}); err != nil {
+			return nil, "", 0, err
+		}
+		m, err := d.ReadMessage()
+		if err != nil {
+			return nil, "", 0, err
+		}
+		if err := AsError(m); err != nil {
+			return nil, "", 0, err
+		}
+		r, ok := m.(*VersionResponse)
+		if !ok {
+			return nil, "", 0, unexpected(m)
+		}
+
+		for _, accepted := range versions {
+			if r.Version != accepted {
+				continue
+			}
+			rmsize := r.MessageSize
+			if rmsize > msize {
+				rmsize = msize
+			}
+			return versionProtocols[accepted], accepted, rmsize, nil
+		}
+	}
+	return nil, "", 0, fmt.Errorf("%w: proposed %s", ErrVersionRejected, strings.Join(versions, ", "))
+}
@@ -0,0 +1,204 @@
+package qp
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"testing"
+)
+
+func TestDial(t *testing.T) {
+	fs := &memFS{
+		files: map[string][]byte{"hello": []byte("hello, world")},
+		fids:  make(map[Fid]string),
+	}
+	cc, sc := net.Pipe()
+	go (&Server{Protocol: NineP2000, Handler: fs}).Serve(sc)
+
+	c, root, err := Dial(cc, "glenda", "", WithMessageSize(4096))
+	if err != nil {
+		t.Fatalf("dial failed: %v", err)
+	}
+	defer c.Close()
+
+	if _, ok := fs.fids[root]; !ok {
+		t.Errorf("root fid %d not attached on server", root)
+	}
+	if msize := c.e.MessageSize; msize != 4096 {
+		t.Errorf("got message size %d, expected 4096", msize)
+	}
+	fid, _, err := c.Walk(root, []string{"hello"})
+	if err != nil {
+		t.Fatalf("walk failed: %v", err)
+	}
+	c.Clunk(fid)
+}
+
+func TestDialFailure(t *testing.T) {
+	cc := serveFunc(func(req Message, tag Tag) Message {
+		return &VersionResponse{Tag: tag, MessageSize: 8192, Version: UnknownVersion}
+	})
+
+	if _, _, err := Dial(cc, "glenda", "", WithVersion("9P3000")); !errors.Is(err, ErrVersionRejected) {
+		t.Errorf("expected %v, got %v", ErrVersionRejected, err)
+	}
+	if _, err := cc.Write([]byte{0}); err == nil {
+		t.Errorf("connection not closed after failed dial")
+	}
+}
+
+func TestDialNumericUsers(t *testing.T) {
+	for _, tc := range []struct {
+		name     string
+		protocol Protocol
+		version  string
+	}{
+		{"9P2000.u", NineP2000Dotu, VersionDotu},
+		{"9P2000.L", NineP2000Dotl, VersionDotl},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			cc, sc := net.Pipe()
+			frames := make(chan []byte)
+			go func() {
+				defer sc.Close()
+				e := NewEncoder(tc.protocol, sc)
+				for {
+					var size [4]byte
+					if _, err := io.ReadFull(sc, size[:]); err != nil {
+						return
+					}
+					frame := make([]byte, binary.LittleEndian.Uint32(size[:]))
+					copy(frame, size[:])
+					if _, err := io.ReadFull(sc, frame[4:]); err != nil {
+						return
+					}
+					tag := Tag(binary.LittleEndian.Uint16(frame[5:7]))
+					switch MessageType(frame[4]) {
+					case Tversion:
+						e.WriteMessage(&VersionResponse{Tag: NOTAG, MessageSize: 8192, Version: tc.version})
+						continue
+					case Tauth:
+						e.WriteMessage(&AuthResponse{Tag: tag})
+					case Tattach:
+						e.WriteMessage(&AttachResponse{Tag: tag})
+					default:
+						e.WriteMessage(&ErrorResponse{Tag: tag, Error: "unexpected request"})
+					}
+					frames <- frame
+				}
+			}()
+
+			c, _, err := Dial(cc, "glenda", "", WithProtocol(tc.protocol), WithVersion(tc.version), WithUIDno(1000))
+			if err != nil {
+				t.Fatalf("dial failed: %v", err)
+			}
+			defer c.Close()
+			checkFrame(t, tc.protocol, <-frames, Tattach, "glenda", 1000)
+
+			c.SetUIDno(NONUNAME)
+			if _, _, err := c.Auth("glenda", ""); err != nil {
+				t.Fatalf("auth failed: %v", err)
+			}
+			checkFrame(t, tc.protocol, <-frames, Tauth, "glenda", NONUNAME)
+		})
+	}
+}
+
+// checkFrame checks that frame holds a request of type mt carrying n_uname.
+func checkFrame(t *testing.T, p Protocol, frame []byte, mt MessageType, uname string, uid uint32) {
+	t.Helper()
+	if MessageType(frame[4]) != mt {
+		t.Fatalf("got %v frame, expected %v", MessageType(frame[4]), mt)
+	}
+	m, err := NewDecoder(p, bytes.NewReader(frame)).ReadMessage()
+	if err != nil {
+		t.Fatalf("decoding frame failed: %v", err)
+	}
+	expected := 4 + 1 + 2 + 4 + 2 + len(uname) + 2 + 4
+	var got uint32
+	switch r := m.(type) {
+	case *AttachRequestDotu:
+		expected += 4
+		got = r.UIDno
+	case *AuthRequestDotu:
+		got = r.UIDno
+	}
+	if len(frame) != expected {
+		t.Errorf("got %d byte frame, expected %d with n_uname", len(frame), expected)
+	}
+	if got != uid {
+		t.Errorf("got n_uname %d, expected %d", got, uid)
+	}
+}
+
+func TestDialBest(t *testing.T) {
+	var proposed []string
+	handle := func(req Message, tag Tag) Message {
+		switch r := req.(type) {
+		case *VersionRequest:
+			proposed = append(proposed, r.Version)
+			if r.Version != Version {
+				return &VersionResponse{Tag: tag, MessageSize: r.MessageSize, Version: UnknownVersion}
+			}
+			return &VersionResponse{Tag: tag, MessageSize: 4096, Version: Version}
+		case *AttachRequest:
+			return &AttachResponse{Tag: tag}
+		}
+		return &ErrorResponse{Tag: tag, Error: "unexpected request"}
+	}
+
+	c, version, err := DialBest(serveFunc(handle), []string{VersionDotl, VersionDotu, Version})
+	if err != nil {
+		t.Fatalf("negotiation failed: %v", err)
+	}
+	defer c.Close()
+	if version != Version || c.e.Protocol != NineP2000 || c.e.MessageSize != 4096 {
+		t.Errorf("got %s (%v) with message size %d, expected 9P2000 with 4096", version, c.e.Protocol, c.e.MessageSize)
+	}
+	if len(proposed) != 3 {
+		t.Errorf("proposed %v, expected all three versions", proposed)
+	}
+	if _, _, err := c.Attach(NOFID, "glenda", ""); err != nil {
+		t.Errorf("attach failed: %v", err)
+	}
+
+	cc := serveFunc(handle)
+	if _, _, err := DialBest(cc, []string{VersionDotl, VersionDotu}); !errors.Is(err, ErrVersionRejected) {
+		t.Errorf("expected %v, got %v", ErrVersionRejected, err)
+	}
+	if _, err := cc.Write([]byte{0}); err == nil {
+		t.Errorf("connection not closed after failed negotiation")
+	}
+
+	cc = serveFunc(handle)
+	if _, _, err := DialBest(cc, []string{"9P3000"}); err == nil {
+		t.Error("unsupported version accepted")
+	}
+	if _, err := cc.Write([]byte{0}); err == nil {
+		t.Errorf("connection not closed after rejecting an unsupported version")
+	}
+}
+
+func TestDialBestDowngrade(t *testing.T) {
+	var n int
+	var msizes []uint32
+	cc := serveFunc(func(req Message, tag Tag) Message {
+		n++
+		msizes = append(msizes, req.(*VersionRequest).MessageSize)
+		return &VersionResponse{Tag: tag, MessageSize: 65536, Version: Version}
+	})
+
+	c, version, err := DialBest(cc, []string{VersionDotu, Version}, WithMessageSize(16384))
+	if err != nil {
+		t.Fatalf("negotiation failed: %v", err)
+	}
+	defer c.Close()
+	if version != Version || c.e.MessageSize != 16384 {
+		t.Errorf("got %s with message size %d, expected 9P2000 with 16384", version, c.e.MessageSize)
+	}
+	if n != 1 || msizes[0] != 16384 {
+		t.Errorf("sent %d version requests proposing %v, expected 1 proposing 16384", n, msizes)
+	}
+}
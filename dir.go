@@ -0,0 +1,225 @@
+package qp
+
+import (
+	"encoding/binary"
+	"io"
+)
+
+// A stat is encoded as size[2] followed by the size bytes of its fields, as
+// done by MarshalStat, and directory reads hold such stats back to back. In
+// StatResponse and WriteStatRequest, the stat is nested in a further count
+// field, n[2] stat[n], so it is prefixed by two sizes, the outer being two
+// larger than the inner.
+
+// MarshalStat encodes s with its leading size field.
+func MarshalStat(s Stat) ([]byte, error) {
+	b := make([]byte, s.EncodedSize())
+	if err := s.Marshal(b); err != nil {
+		return nil, err
+	}
+	return b, nil
+}
+
+// UnmarshalStat decodes a stat, with its leading size field, from the start
+// of b, returning it and the amount of bytes it occupied. ErrPayloadTooShort
+// is returned if b holds less than the size field declares.
+func UnmarshalStat(b []byte) (Stat, int, error) {
+	if len(b) < 2 {
+		return Stat{}, 0, ErrPayloadTooShort
+	}
+	l := 2 + int(binary.LittleEndian.Uint16(b[0:2]))
+	if len(b) < l {
+		return Stat{}, 0, ErrPayloadTooShort
+	}
+
+	var s Stat
+	if err := s.Unmarshal(b[:l]); err != nil {
+		return Stat{}, 0, err
+	}
+	return s, l, nil
+}
+
+// UnmarshalDir decodes the consecutive Stat entries of a directory read, as
+// returned in ReadResponse.Data. ErrPayloadTooShort is returned if the final
+// entry is truncated.
+func UnmarshalDir(b []byte) ([]Stat, error) {
+	var stats []Stat
+	for len(b) > 0 {
+		s, l, err := UnmarshalStat(b)
+		if err != nil {
+			return stats, err
+		}
+		stats = append(stats, s)
+		b = b[l:]
+	}
+	return stats, nil
+}
+
+// DirEntry is the part of a Stat most directory listings need.
+type DirEntry struct {
+	// Name is the name of the file.
+	Name string
+
+	// Qid is the Qid of the file, whose type tells directories apart.
+	Qid Qid
+
+	// Mode is the permissions and mode of the file.
+	Mode FileMode
+
+	// Mtime is the last modification time of the file.
+	Mtime uint32
+}
+
+// UnmarshalDirEntries is like UnmarshalDir, but decodes the entries into
+// DirEntry values. Only the name is copied out of b, and the owners are not
+// decoded, which makes it cheaper than UnmarshalDir for listing large
+// directories. ErrPayloadTooShort is returned if an entry is truncated.
+func UnmarshalDirEntries(b []byte) ([]DirEntry, error) {
+	// Count the entries first, so the slice is allocated once.
+	var n int
+	for rest := b; len(rest) >= 2; n++ {
+		l := 2 + int(binary.LittleEndian.Uint16(rest[0:2]))
+		if len(rest) < l {
+			break
+		}
+		rest = rest[l:]
+	}
+
+	entries := make([]DirEntry, 0, n)
+	for len(b) > 0 {
+		if len(b) < 2 {
+			return entries, ErrPayloadTooShort
+		}
+		l := 2 + int(binary.LittleEndian.Uint16(b[0:2]))
+		if len(b) < l || l < statFixedSize {
+			return entries, ErrPayloadTooShort
+		}
+
+		e := DirEntry{
+			Qid: Qid{
+				Type:    QidType(b[8]),
+				Version: binary.LittleEndian.Uint32(b[9:13]),
+				Path:    binary.LittleEndian.Uint64(b[13:21]),
+			},
+			Mode:  FileMode(binary.LittleEndian.Uint32(b[21:25])),
+			Mtime: binary.LittleEndian.Uint32(b[29:33]),
+		}
+		nl := int(binary.LittleEndian.Uint16(b[41:43]))
+		if l < statFixedSize+nl {
+			return entries, ErrPayloadTooShort
+		}
+		e.Name = string(b[43 : 43+nl])
+
+		entries = append(entries, e)
+		b = b[l:]
+	}
+	return entries, nil
+}
+
+// statFixedSize is the size of a stat, with its size field, whose strings
+// are all empty.
+const statFixedSize = 2 + 2 + 4 + 13 + 4 + 4 + 4 + 8 + 2 + 2 + 2 + 2
+
+// MarshalDir encodes the Stat entries as consecutive entries of a directory
+// read, suitable for ReadResponse.Data.
+func MarshalDir(stats []Stat) ([]byte, error) {
+	var l int
+	for i := range stats {
+		l += stats[i].EncodedSize()
+	}
+
+	b := make([]byte, l)
+	idx := 0
+	for i := range stats {
+		l := stats[i].EncodedSize()
+		if err := stats[i].Marshal(b[idx : idx+l]); err != nil {
+			return nil, err
+		}
+		idx += l
+	}
+	return b, nil
+}
+
+// DirReader decodes the Stat entries of a directory one at a time, fetching
+// the directory contents as needed. Entries may straddle the boundaries of
+// the fetched chunks.
+type DirReader struct {
+	read   func(offset uint64) ([]byte, error)
+	offset uint64
+	buf    []byte
+	err    error
+}
+
+// NewDirReader returns a DirReader that fetches directory contents by calling
+// read with the offset following the previously returned data. A read
+// returning no data marks the end of the directory.
+func NewDirReader(read func(offset uint64) ([]byte, error)) *DirReader {
+	return &DirReader{read: read}
+}
+
+// DirReader returns a DirReader for the opened directory fid, reading as much
+// as fits in a single response at a time.
+func (c *Client) DirReader(fid Fid) *DirReader {
+	count := c.chunkSize(fid, ReadOverhead)
+	return NewDirReader(func(offset uint64) ([]byte, error) {
+		return c.Read(fid, offset, count)
+	})
+}
+
+// ReadDir returns all entries of the directory fid, opening it for reading
+// first unless it was opened by this client. The whole directory is read
+// before being decoded, so entries may straddle the boundaries of the reads.
+func (c *Client) ReadDir(fid Fid) ([]Stat, error) {
+	c.mu.Lock()
+	_, opened := c.iounits[fid]
+	c.mu.Unlock()
+
+	if !opened {
+		if _, _, err := c.Open(fid, OREAD); err != nil {
+			return nil, err
+		}
+	}
+
+	b, err := c.ReadAll(fid)
+	if err != nil {
+		return nil, err
+	}
+	return UnmarshalDir(b)
+}
+
+// Next returns the next entry of the directory. It returns io.EOF at the end
+// of the directory, and ErrPayloadTooShort if the directory ends in the middle
+// of an entry. Once an error has been returned, Next keeps returning it.
+func (dr *DirReader) Next() (Stat, error) {
+	for dr.err == nil {
+		if len(dr.buf) >= 2 {
+			l := 2 + int(binary.LittleEndian.Uint16(dr.buf[0:2]))
+			if len(dr.buf) >= l {
+				var s Stat
+				if dr.err = s.Unmarshal(dr.buf[:l]); dr.err != nil {
+					break
+				}
+				dr.buf = dr.buf[l:]
+				return s, nil
+			}
+		}
+		dr.fill()
+	}
+	return Stat{}, dr.err
+}
+
+// fill appends the next chunk of the directory to the buffer.
+func (dr *DirReader) fill() {
+	b, err := dr.read(dr.offset)
+	switch {
+	case err != nil:
+		dr.err = err
+	case len(b) == 0 && len(dr.buf) > 0:
+		dr.err = ErrPayloadTooShort
+	case len(b) == 0:
+		dr.err = io.EOF
+	default:
+		dr.offset += uint64(len(b))
+		dr.buf = append(dr.buf, b...)
+	}
+}
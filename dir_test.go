@@ -0,0 +1,329 @@
+package qp
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"reflect"
+	"strconv"
+	"sync"
+	"testing"
+)
+
+func TestDir(t *testing.T) {
+	stats := []Stat{
+		*PrimitiveTestData[1].input.(*Stat),
+		{
+			Qid:  Qid{Type: QTDIR, Path: 2},
+			Mode: DMDIR | 0755,
+			Name: "usr",
+			UID:  "glenda",
+		},
+	}
+
+	b, err := MarshalDir(stats)
+	if err != nil {
+		t.Fatalf("marshal failed: %v", err)
+	}
+	if ref := PrimitiveTestData[1].reference; !bytes.Equal(b[:len(ref)], ref) {
+		t.Errorf("first entry did not match reference.\n\tExpected: %#v\n\tGot:      %#v", ref, b[:len(ref)])
+	}
+
+	got, err := UnmarshalDir(b)
+	if err != nil {
+		t.Fatalf("unmarshal failed: %v", err)
+	}
+	if len(got) != len(stats) {
+		t.Fatalf("got %d entries, expected %d", len(got), len(stats))
+	}
+	for i := range stats {
+		if got[i] != stats[i] {
+			t.Errorf("entry %d:\n\tExpected: %#v\n\tGot:      %#v", i, stats[i], got[i])
+		}
+	}
+
+	for n := len(b) - 1; n > len(b)-stats[1].EncodedSize(); n-- {
+		got, err := UnmarshalDir(b[:n])
+		if err != ErrPayloadTooShort {
+			t.Errorf("truncated to %d bytes: expected %v, got %v", n, ErrPayloadTooShort, err)
+		}
+		if len(got) != 1 {
+			t.Errorf("truncated to %d bytes: got %d complete entries, expected 1", n, len(got))
+		}
+	}
+
+	if got, err := UnmarshalDir(nil); err != nil || len(got) != 0 {
+		t.Errorf("empty directory: got %v, %v", got, err)
+	}
+}
+
+func TestDirReader(t *testing.T) {
+	var stats []Stat
+	for _, name := range []string{"a", "bb", "ccc", "dddd", "eeeee"} {
+		stats = append(stats, Stat{Qid: Qid{Path: uint64(len(name))}, Name: name, UID: "glenda"})
+	}
+	b, err := MarshalDir(stats)
+	if err != nil {
+		t.Fatalf("marshal failed: %v", err)
+	}
+
+	// Chunk sizes that split entries at arbitrary points.
+	for _, chunk := range []int{1, 7, 50, len(b)} {
+		dr := NewDirReader(func(offset uint64) ([]byte, error) {
+			if offset >= uint64(len(b)) {
+				return nil, nil
+			}
+			end := offset + uint64(chunk)
+			if end > uint64(len(b)) {
+				end = uint64(len(b))
+			}
+			return b[offset:end], nil
+		})
+
+		for i := range stats {
+			s, err := dr.Next()
+			if err != nil {
+				t.Fatalf("chunk %d: entry %d: %v", chunk, i, err)
+			}
+			if s != stats[i] {
+				t.Errorf("chunk %d: entry %d:\n\tExpected: %#v\n\tGot:      %#v", chunk, i, stats[i], s)
+			}
+		}
+		if _, err := dr.Next(); err != io.EOF {
+			t.Errorf("chunk %d: expected %v, got %v", chunk, io.EOF, err)
+		}
+	}
+
+	dr := NewDirReader(func(offset uint64) ([]byte, error) {
+		if offset > 0 {
+			return nil, nil
+		}
+		return b[:len(b)-1], nil
+	})
+	for range stats[1:] {
+		dr.Next()
+	}
+	if _, err := dr.Next(); err != ErrPayloadTooShort {
+		t.Errorf("truncated directory: expected %v, got %v", ErrPayloadTooShort, err)
+	}
+}
+
+func TestClientReadDir(t *testing.T) {
+	stats := make([]Stat, 1000)
+	for i := range stats {
+		stats[i] = Stat{
+			Qid:  Qid{Type: QTFILE, Path: uint64(i)},
+			Mode: 0644,
+			Name: "file" + strconv.Itoa(i),
+			UID:  "glenda",
+			GID:  "sys",
+			MUID: "glenda",
+		}
+	}
+	dir, err := MarshalDir(stats)
+	if err != nil {
+		t.Fatalf("marshal failed: %v", err)
+	}
+
+	var (
+		mu    sync.Mutex
+		opens int
+		reads int
+	)
+	c := NewClient(serveFunc(func(req Message, tag Tag) Message {
+		mu.Lock()
+		defer mu.Unlock()
+		switch r := req.(type) {
+		case *VersionRequest:
+			return &VersionResponse{Tag: tag, MessageSize: 4096, Version: Version}
+		case *OpenRequest:
+			opens++
+			return &OpenResponse{Tag: tag, Qid: Qid{Type: QTDIR}}
+		case *ReadRequest:
+			reads++
+			// Cut the data at arbitrary offsets, splitting entries.
+			if r.Offset >= uint64(len(dir)) {
+				return &ReadResponse{Tag: tag}
+			}
+			b := dir[r.Offset:]
+			if n := int(r.Count) - 3; len(b) > n {
+				b = b[:n]
+			}
+			return &ReadResponse{Tag: tag, Data: b}
+		}
+		return &ErrorResponse{Tag: tag, Error: "unsupported"}
+	}), NineP2000)
+	defer c.Close()
+
+	if _, _, err := c.Version(4096, Version); err != nil {
+		t.Fatalf("version failed: %v", err)
+	}
+
+	got, err := c.ReadDir(1)
+	if err != nil {
+		t.Fatalf("read dir failed: %v", err)
+	}
+	if !reflect.DeepEqual(got, stats) {
+		t.Errorf("got %d entries, expected %d", len(got), len(stats))
+	}
+
+	// The fid is now open, so it is not opened again.
+	if _, err := c.ReadDir(1); err != nil {
+		t.Fatalf("second read dir failed: %v", err)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if opens != 1 {
+		t.Errorf("fid opened %d times, expected once", opens)
+	}
+	if reads < 2*(len(dir)/4096) {
+		t.Errorf("directory of %d bytes read in %d reads", len(dir), reads)
+	}
+}
+
+func TestStatNesting(t *testing.T) {
+	st := *PrimitiveTestData[1].input.(*Stat)
+
+	// The bare form has a single size field.
+	b, err := MarshalStat(st)
+	if err != nil {
+		t.Fatalf("marshal failed: %v", err)
+	}
+	if l := int(binary.LittleEndian.Uint16(b[0:2])); l != len(b)-2 {
+		t.Errorf("size field %d, expected %d", l, len(b)-2)
+	}
+	got, n, err := UnmarshalStat(append(b, 0xff))
+	if err != nil {
+		t.Fatalf("unmarshal failed: %v", err)
+	}
+	if n != len(b) || got != st {
+		t.Errorf("got %v occupying %d bytes, expected %v occupying %d", got, n, st, len(b))
+	}
+	if _, _, err := UnmarshalStat(b[:len(b)-1]); err != ErrPayloadTooShort {
+		t.Errorf("truncated: expected %v, got %v", ErrPayloadTooShort, err)
+	}
+
+	// The nested form adds a count two larger than the size field.
+	r := &StatResponse{Tag: 1, Stat: st}
+	body := make([]byte, r.EncodedSize())
+	if err := r.Marshal(body); err != nil {
+		t.Fatalf("marshal failed: %v", err)
+	}
+	if n := int(binary.LittleEndian.Uint16(body[2:4])); n != len(b) || !bytes.Equal(body[4:], b) {
+		t.Errorf("got count %d and stat %x, expected %d and %x", n, body[4:], len(b), b)
+	}
+	var rs StatResponse
+	if err := rs.Unmarshal(body); err != nil || rs.Stat != st {
+		t.Errorf("got %v, %v, expected %v", rs.Stat, err, st)
+	}
+
+	// A count too small for the stat it holds is rejected.
+	binary.LittleEndian.PutUint16(body[2:4], uint16(len(b)-1))
+	if err := rs.Unmarshal(body); err != ErrPayloadTooShort {
+		t.Errorf("short count: expected %v, got %v", ErrPayloadTooShort, err)
+	}
+	binary.LittleEndian.PutUint16(body[2:4], uint16(len(b)+1))
+	if err := rs.Unmarshal(body); err != ErrPayloadTooShort {
+		t.Errorf("long count: expected %v, got %v", ErrPayloadTooShort, err)
+	}
+
+	w := &WriteStatRequest{Tag: 1, Fid: 2, Stat: st}
+	body = make([]byte, w.EncodedSize())
+	if err := w.Marshal(body); err != nil {
+		t.Fatalf("marshal failed: %v", err)
+	}
+	if n := int(binary.LittleEndian.Uint16(body[6:8])); n != len(b) || !bytes.Equal(body[8:], b) {
+		t.Errorf("got count %d and stat %x, expected %d and %x", n, body[8:], len(b), b)
+	}
+}
+
+func TestUnmarshalDirEntries(t *testing.T) {
+	stats := []Stat{
+		*PrimitiveTestData[1].input.(*Stat),
+		{
+			Qid:   Qid{Type: QTDIR, Path: 2},
+			Mode:  DMDIR | 0755,
+			Mtime: 1000000000,
+			Name:  "usr",
+			UID:   "glenda",
+		},
+	}
+	b, err := MarshalDir(stats)
+	if err != nil {
+		t.Fatalf("marshal failed: %v", err)
+	}
+
+	entries, err := UnmarshalDirEntries(b)
+	if err != nil {
+		t.Fatalf("unmarshal failed: %v", err)
+	}
+	if len(entries) != len(stats) {
+		t.Fatalf("got %d entries, expected %d", len(entries), len(stats))
+	}
+	for i, s := range stats {
+		expected := DirEntry{Name: s.Name, Qid: s.Qid, Mode: s.Mode, Mtime: s.Mtime}
+		if entries[i] != expected {
+			t.Errorf("entry %d:\n\tExpected: %#v\n\tGot:      %#v", i, expected, entries[i])
+		}
+	}
+
+	for n := len(b) - 1; n > len(b)-stats[1].EncodedSize(); n-- {
+		entries, err := UnmarshalDirEntries(b[:n])
+		if err != ErrPayloadTooShort {
+			t.Errorf("truncated to %d bytes: expected %v, got %v", n, ErrPayloadTooShort, err)
+		}
+		if len(entries) != 1 {
+			t.Errorf("truncated to %d bytes: got %d complete entries, expected 1", n, len(entries))
+		}
+	}
+
+	// An entry whose name overruns it is rejected.
+	bad := append([]byte{}, b[:stats[0].EncodedSize()]...)
+	bad[41] = 0xFF
+	if _, err := UnmarshalDirEntries(bad); err != ErrPayloadTooShort {
+		t.Errorf("overlong name: expected %v, got %v", ErrPayloadTooShort, err)
+	}
+}
+
+// largeDir returns the encoding of a directory of 1000 entries.
+func largeDir(b *testing.B) []byte {
+	stats := make([]Stat, 1000)
+	for i := range stats {
+		stats[i] = Stat{
+			Qid:  Qid{Path: uint64(i)},
+			Mode: 0644,
+			Name: fmt.Sprintf("file%04d", i),
+			UID:  "glenda",
+			GID:  "sys",
+			MUID: "glenda",
+		}
+	}
+	dir, err := MarshalDir(stats)
+	if err != nil {
+		b.Fatalf("marshal failed: %v", err)
+	}
+	return dir
+}
+
+func BenchmarkUnmarshalDir(b *testing.B) {
+	dir := largeDir(b)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := UnmarshalDir(dir); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkUnmarshalDirEntries(b *testing.B) {
+	dir := largeDir(b)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := UnmarshalDirEntries(dir); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
@@ -0,0 +1,59 @@
+package qp
+
+import (
+	"bytes"
+	"reflect"
+)
+
+// MessagesEqual reports whether a and b are messages of the same type with
+// equal contents. Messages are compared by their encoded form, so slice
+// contents are compared rather than their identity, and a nil slice is equal
+// to an empty one.
+func MessagesEqual(a, b Message) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	if reflect.TypeOf(a) != reflect.TypeOf(b) {
+		return false
+	}
+
+	ab, err := marshalMessage(a)
+	if err != nil {
+		return false
+	}
+	bb, err := marshalMessage(b)
+	if err != nil {
+		return false
+	}
+	return bytes.Equal(ab, bb)
+}
+
+// CloneMessage returns a deep copy of m, sharing no memory with the original.
+// It returns nil if m cannot be encoded.
+func CloneMessage(m Message) Message {
+	if m == nil {
+		return nil
+	}
+
+	b, err := marshalMessage(m)
+	if err != nil {
+		return nil
+	}
+
+	// Unmarshal copies all variable length fields out of the buffer, leaving
+	// no references to it in the clone.
+	c := reflect.New(reflect.TypeOf(m).Elem()).Interface().(Message)
+	if err := c.Unmarshal(b); err != nil {
+		return nil
+	}
+	return c
+}
+
+// marshalMessage returns the encoded body of m.
+func marshalMessage(m Message) ([]byte, error) {
+	b := make([]byte, m.EncodedSize())
+	if err := m.Marshal(b); err != nil {
+		return nil, err
+	}
+	return b, nil
+}
@@ -0,0 +1,52 @@
+package qp
+
+import "testing"
+
+func TestMessagesEqual(t *testing.T) {
+	tables := [][]MessageTestEntry{MessageTestData, MessageTestDataDotu, MessageTestDataDote, MessageTestDataDotl}
+	for _, table := range tables {
+		for i, tt := range table {
+			c := CloneMessage(tt.input)
+			if c == nil {
+				t.Fatalf("test %d: clone of %T failed", i, tt.input)
+			}
+			if c == tt.input {
+				t.Errorf("test %d: clone of %T is the original", i, tt.input)
+			}
+			if !MessagesEqual(tt.input, c) {
+				t.Errorf("test %d: clone of %T not equal.\n\tExpected: %#v\n\tGot:      %#v", i, tt.input, tt.input, c)
+			}
+		}
+	}
+
+	a := &WriteRequest{Tag: 1, Fid: 2, Data: []byte("hello")}
+	b := &WriteRequest{Tag: 1, Fid: 2, Data: []byte("hellp")}
+	if MessagesEqual(a, b) {
+		t.Errorf("messages with different data compared equal")
+	}
+	if MessagesEqual(&ReadResponse{Tag: 1}, &WriteResponse{Tag: 1}) {
+		t.Errorf("messages of different types compared equal")
+	}
+	if !MessagesEqual(&ReadResponse{Tag: 1, Data: []byte{}}, &ReadResponse{Tag: 1}) {
+		t.Errorf("empty and nil data compared unequal")
+	}
+	if !MessagesEqual(nil, nil) || MessagesEqual(a, nil) {
+		t.Errorf("nil messages compared incorrectly")
+	}
+}
+
+func TestCloneMessageIndependent(t *testing.T) {
+	m := &ReadResponse{Tag: 1, Data: []byte("hello")}
+	c := CloneMessage(m).(*ReadResponse)
+	c.Data[0] = 'j'
+	if string(m.Data) != "hello" {
+		t.Errorf("mutating clone changed original to %q", m.Data)
+	}
+
+	w := &WalkRequest{Tag: 1, Names: []string{"usr", "local"}}
+	cw := CloneMessage(w).(*WalkRequest)
+	cw.Names[0] = "tmp"
+	if w.Names[0] != "usr" {
+		t.Errorf("mutating clone changed original to %v", w.Names)
+	}
+}
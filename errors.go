@@ -0,0 +1,181 @@
+package qp
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"unicode/utf8"
+)
+
+// NineError is an error response converted to a Go error.
+type NineError struct {
+	// Tag is the tag of the error response.
+	Tag Tag
+
+	// Ename is the error string. It is empty for 9P2000.L errors, which only
+	// carry an error number.
+	Ename string
+
+	// Errno is the error number of 9P2000.u and 9P2000.L error responses, or
+	// zero if none was provided.
+	Errno uint32
+}
+
+func (e *NineError) Error() string {
+	if e.Ename == "" {
+		return fmt.Sprintf("errno %d", e.Errno)
+	}
+	return e.Ename
+}
+
+// Is reports whether the error corresponds to target, which is one of the os
+// package errors, such as os.ErrNotExist. The error string is looked up among
+// those registered with RegisterErrorString, and the error number, if any, is
+// mapped as the inverse of ErrorNumber. This allows errors.Is(err,
+// os.ErrNotExist) to be used on errors returned by the client.
+func (e *NineError) Is(target error) bool {
+	if e.Ename != "" {
+		errorStringsMu.RLock()
+		err, ok := errorStrings[e.Ename]
+		errorStringsMu.RUnlock()
+		if ok && err == target {
+			return true
+		}
+	}
+
+	switch e.Errno {
+	case errnoENOENT:
+		return target == os.ErrNotExist
+	case errnoEACCES:
+		return target == os.ErrPermission
+	case errnoEEXIST:
+		return target == os.ErrExist
+	case errnoEINVAL:
+		return target == os.ErrInvalid
+	case errnoEBADF:
+		return target == os.ErrClosed
+	}
+	return false
+}
+
+var (
+	errorStringsMu sync.RWMutex
+
+	// errorStrings maps well-known error strings to the errors they are
+	// classified as by NineError.Is.
+	errorStrings = map[string]error{
+		"file not found":            os.ErrNotExist,
+		"file does not exist":       os.ErrNotExist,
+		"no such file or directory": os.ErrNotExist,
+		"permission denied":         os.ErrPermission,
+		"file exists":               os.ErrExist,
+		"file already exists":       os.ErrExist,
+	}
+)
+
+// RegisterErrorString classifies error responses carrying ename as target,
+// such as os.ErrNotExist, for server-specific error strings. It may be called
+// in parallel with the classification of errors.
+func RegisterErrorString(ename string, target error) {
+	errorStringsMu.Lock()
+	defer errorStringsMu.Unlock()
+
+	errorStrings[ename] = target
+}
+
+// ClassifyError returns the error response r as a *NineError, which keeps the
+// original error string, and which matches the os package error it is
+// classified as with errors.Is. See NineError.Is.
+func ClassifyError(r *ErrorResponse) error {
+	return AsError(r)
+}
+
+// AsError returns a *NineError if m is an error response, and nil otherwise.
+func AsError(m Message) error {
+	switch r := m.(type) {
+	case *ErrorResponse:
+		return &NineError{Tag: r.Tag, Ename: r.Error}
+	case *ErrorResponseDotu:
+		return &NineError{Tag: r.Tag, Ename: r.Error, Errno: r.Errno}
+	case *ErrorResponseDotl:
+		return &NineError{Tag: r.Tag, Errno: r.Errno}
+	}
+	return nil
+}
+
+// POSIX error numbers used by ErrorNumber. The values are shared by Linux and
+// the BSDs.
+const (
+	errnoENOENT = 2
+	errnoEIO    = 5
+	errnoEBADF  = 9
+	errnoEACCES = 13
+	errnoEEXIST = 17
+	errnoEINVAL = 22
+)
+
+// ErrorNumber returns the POSIX error number for err, for use in 9P2000.u and
+// 9P2000.L error responses. The error number of a *NineError is passed
+// through, and the os package errors, such as os.ErrNotExist, are mapped to
+// their counterparts. Zero is returned for other errors.
+func ErrorNumber(err error) uint32 {
+	var ne *NineError
+	if errors.As(err, &ne) && ne.Errno != 0 {
+		return ne.Errno
+	}
+
+	switch {
+	case errors.Is(err, os.ErrNotExist):
+		return errnoENOENT
+	case errors.Is(err, os.ErrPermission):
+		return errnoEACCES
+	case errors.Is(err, os.ErrExist):
+		return errnoEEXIST
+	case errors.Is(err, os.ErrInvalid):
+		return errnoEINVAL
+	case errors.Is(err, os.ErrClosed):
+		return errnoEBADF
+	}
+	return 0
+}
+
+// errorString returns the error string of err, truncated to fit in a string
+// field without splitting a UTF-8 sequence.
+func errorString(err error) string {
+	s := err.Error()
+	if len(s) <= maxStringSize {
+		return s
+	}
+
+	// Cut before the sequence straddling the limit, if any.
+	n := maxStringSize
+	for i := n; i > n-utf8.UTFMax; i-- {
+		if utf8.RuneStart(s[i]) {
+			return s[:i]
+		}
+	}
+	return s[:n]
+}
+
+// NewErrorResponse returns an ErrorResponse with tag t describing err.
+func NewErrorResponse(t Tag, err error) *ErrorResponse {
+	return &ErrorResponse{Tag: t, Error: errorString(err)}
+}
+
+// NewErrorResponseDotu returns an ErrorResponseDotu with tag t describing
+// err, with the error number set by ErrorNumber.
+func NewErrorResponseDotu(t Tag, err error) *ErrorResponseDotu {
+	return &ErrorResponseDotu{Tag: t, Error: errorString(err), Errno: ErrorNumber(err)}
+}
+
+// NewErrorResponseDotl returns an ErrorResponseDotl with tag t describing
+// err. As 9P2000.L errors carry no string, errors without an error number
+// from ErrorNumber are reported as EIO.
+func NewErrorResponseDotl(t Tag, err error) *ErrorResponseDotl {
+	errno := ErrorNumber(err)
+	if errno == 0 {
+		errno = errnoEIO
+	}
+	return &ErrorResponseDotl{Tag: t, Errno: errno}
+}
@@ -0,0 +1,127 @@
+package qp
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+func TestAsError(t *testing.T) {
+	tests := []struct {
+		m   Message
+		err *NineError
+		s   string
+	}{
+		{&ErrorResponse{Tag: 1, Error: "file not found"}, &NineError{Tag: 1, Ename: "file not found"}, "file not found"},
+		{&ErrorResponseDotu{Tag: 2, Error: "permission denied", Errno: 13}, &NineError{Tag: 2, Ename: "permission denied", Errno: 13}, "permission denied"},
+		{&ErrorResponseDotl{Tag: 3, Errno: 2}, &NineError{Tag: 3, Errno: 2}, "errno 2"},
+	}
+
+	for i, tt := range tests {
+		err := AsError(tt.m)
+		ne, ok := err.(*NineError)
+		if !ok {
+			t.Fatalf("test %d: expected *NineError, got %T", i, err)
+		}
+		if *ne != *tt.err {
+			t.Errorf("test %d: got %#v, expected %#v", i, ne, tt.err)
+		}
+		if s := ne.Error(); s != tt.s {
+			t.Errorf("test %d: got error string %q, expected %q", i, s, tt.s)
+		}
+	}
+
+	if err := AsError(&ReadResponse{}); err != nil {
+		t.Errorf("expected nil for non-error message, got %v", err)
+	}
+}
+
+func TestNewErrorResponse(t *testing.T) {
+	tests := []struct {
+		err   error
+		errno uint32
+	}{
+		{errors.New("something broke"), 0},
+		{&os.PathError{Op: "open", Path: "/x", Err: os.ErrNotExist}, 2},
+		{os.ErrPermission, 13},
+		{os.ErrExist, 17},
+		{fmt.Errorf("walk: %w", &NineError{Ename: "busy", Errno: 16}), 16},
+	}
+
+	for i, tt := range tests {
+		if r := NewErrorResponse(7, tt.err); r.Tag != 7 || r.Error != tt.err.Error() {
+			t.Errorf("test %d: got %v", i, r)
+		}
+		if r := NewErrorResponseDotu(7, tt.err); r.Tag != 7 || r.Error != tt.err.Error() || r.Errno != tt.errno {
+			t.Errorf("test %d: got %v, expected errno %d", i, r, tt.errno)
+		}
+		expected := tt.errno
+		if expected == 0 {
+			expected = 5
+		}
+		if r := NewErrorResponseDotl(7, tt.err); r.Tag != 7 || r.Errno != expected {
+			t.Errorf("test %d: got %v, expected errno %d", i, r, expected)
+		}
+	}
+
+	// Long errors are truncated to fit, without splitting characters.
+	long := errors.New(strings.Repeat("a", maxStringSize-1) + "ø")
+	r := NewErrorResponse(1, long)
+	if len(r.Error) != maxStringSize-1 || !utf8.ValidString(r.Error) {
+		t.Errorf("truncated error has length %d, expected %d", len(r.Error), maxStringSize-1)
+	}
+	b := make([]byte, r.EncodedSize())
+	if err := r.Marshal(b); err != nil {
+		t.Errorf("marshal of truncated error failed: %v", err)
+	}
+}
+
+func TestClassifyError(t *testing.T) {
+	tests := []struct {
+		ename  string
+		target error
+	}{
+		{"file not found", os.ErrNotExist},
+		{"no such file or directory", os.ErrNotExist},
+		{"permission denied", os.ErrPermission},
+		{"file exists", os.ErrExist},
+	}
+	for _, tt := range tests {
+		err := ClassifyError(&ErrorResponse{Tag: 1, Error: tt.ename})
+		if !errors.Is(err, tt.target) {
+			t.Errorf("%q: expected to match %v", tt.ename, tt.target)
+		}
+		if err.Error() != tt.ename {
+			t.Errorf("%q: got error string %q", tt.ename, err.Error())
+		}
+		if errors.Is(err, os.ErrClosed) {
+			t.Errorf("%q: unexpectedly matched %v", tt.ename, os.ErrClosed)
+		}
+	}
+
+	err := ClassifyError(&ErrorResponse{Tag: 1, Error: "'foo' does not exist"})
+	if errors.Is(err, os.ErrNotExist) {
+		t.Errorf("unregistered string matched %v", os.ErrNotExist)
+	}
+	RegisterErrorString("'foo' does not exist", os.ErrNotExist)
+	t.Cleanup(func() {
+		errorStringsMu.Lock()
+		defer errorStringsMu.Unlock()
+		delete(errorStrings, "'foo' does not exist")
+	})
+	if !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("registered string did not match %v", os.ErrNotExist)
+	}
+
+	// Error numbers are classified as well, also when wrapped.
+	err = fmt.Errorf("open: %w", AsError(&ErrorResponseDotl{Tag: 1, Errno: errnoENOENT}))
+	if !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("ENOENT did not match %v", os.ErrNotExist)
+	}
+	if n := ErrorNumber(os.ErrPermission); !errors.Is(AsError(&ErrorResponseDotu{Errno: n}), os.ErrPermission) {
+		t.Errorf("errno %d did not map back to %v", n, os.ErrPermission)
+	}
+}
@@ -0,0 +1,154 @@
+package qp
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"io"
+)
+
+// ErrSizeMismatch indicates that a frame holds more bytes than its size field
+// declares.
+var ErrSizeMismatch = errors.New("frame longer than declared size")
+
+// Framer reads raw messages from an io.Reader without decoding them, for
+// inspecting or forwarding messages blindly. A frame can be decoded later by
+// unmarshalling its body, following the header, into the message returned by
+// Protocol.Message for its type.
+type Framer struct {
+	// MessageSize is the maximum size of a frame, including the header.
+	// Larger frames are rejected with ErrMessageTooBig. Zero means no limit.
+	MessageSize uint32
+
+	r *bufio.Reader
+}
+
+// NewFramer returns a Framer reading from r. If r is already a *bufio.Reader,
+// it is used directly.
+func NewFramer(r io.Reader) *Framer {
+	br, ok := r.(*bufio.Reader)
+	if !ok {
+		br = bufio.NewReader(r)
+	}
+	return &Framer{r: br}
+}
+
+// PeekHeader returns the size and type of the next frame without consuming
+// it. io.EOF is returned if the reader is exhausted at a frame boundary.
+func (f *Framer) PeekHeader() (uint32, MessageType, error) {
+	b, err := f.r.Peek(HeaderSize)
+	if err != nil {
+		if len(b) > 0 {
+			if err == io.EOF {
+				err = io.ErrUnexpectedEOF
+			}
+			return 0, 0, shortHeader(len(b), err)
+		}
+		return 0, 0, err
+	}
+
+	size := binary.LittleEndian.Uint32(b[0:4])
+	if size < HeaderSize {
+		// The size includes the header, so this cannot be a valid message.
+		return 0, 0, ErrPayloadTooShort
+	}
+	if f.MessageSize > 0 && size > f.MessageSize {
+		return 0, 0, ErrMessageTooBig
+	}
+	return size, MessageType(b[4]), nil
+}
+
+// ReadFrame reads the next frame, returning the raw message including its
+// header, as well as its type.
+func (f *Framer) ReadFrame() ([]byte, MessageType, error) {
+	size, mt, err := f.PeekHeader()
+	if err != nil {
+		return nil, 0, err
+	}
+
+	b := make([]byte, size)
+	if _, err := io.ReadFull(f.r, b); err != nil {
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			// The header has been peeked, so the message is incomplete.
+			err = errTruncated
+		}
+		return nil, 0, err
+	}
+	return b, mt, nil
+}
+
+// CopyFrame copies a single message from src to dst without decoding it,
+// returning the type and tag of the message. Messages too short to hold a tag
+// are rejected with ErrPayloadTooShort before anything is written. io.EOF is
+// returned if src is exhausted at a message boundary.
+func CopyFrame(dst io.Writer, src io.Reader) (MessageType, Tag, error) {
+	size, mt, err := readHeader(src)
+	if err != nil {
+		return 0, 0, err
+	}
+	if size < HeaderSize+2 {
+		return 0, 0, ErrPayloadTooShort
+	}
+
+	var b [HeaderSize + 2]byte
+	binary.LittleEndian.PutUint32(b[0:4], size)
+	b[4] = byte(mt)
+	if _, err := io.ReadFull(src, b[HeaderSize:]); err != nil {
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			err = errTruncated
+		}
+		return 0, 0, err
+	}
+	t := Tag(binary.LittleEndian.Uint16(b[HeaderSize:]))
+
+	if err := write(dst, b[:]); err != nil {
+		return 0, 0, err
+	}
+	if _, err := io.CopyN(dst, src, int64(size)-int64(len(b))); err != nil {
+		if err == io.EOF {
+			// The message has been partially copied, so it is incomplete.
+			err = errTruncated
+		}
+		return 0, 0, err
+	}
+	return mt, t, nil
+}
+
+// ValidateFrame checks that the size field of the self-contained frame b
+// matches the length of b. ErrPayloadTooShort is returned if b is shorter than
+// its declared size or the header, or if the declared size is smaller than the
+// header, and ErrSizeMismatch if b is longer.
+func ValidateFrame(b []byte) error {
+	if len(b) < HeaderSize {
+		return ErrPayloadTooShort
+	}
+	size := uint64(binary.LittleEndian.Uint32(b[0:4]))
+	switch {
+	case size < HeaderSize, uint64(len(b)) < size:
+		return ErrPayloadTooShort
+	case uint64(len(b)) > size:
+		return ErrSizeMismatch
+	}
+	return nil
+}
+
+// DecodeFrame decodes the self-contained frame b using the Default protocol.
+// See Decoder.DecodeFrame.
+func DecodeFrame(b []byte) (Message, error) {
+	d := Decoder{Protocol: Default}
+	return d.DecodeFrame(b)
+}
+
+// DecodeFrame decodes b as exactly one framed message, for transports that
+// deliver each message as a whole, such as a message-oriented pipe. The frame
+// is checked by ValidateFrame before being decoded, so ErrPayloadTooShort
+// only reports a frame shorter than its size field. A frame whose body is too
+// short for its fields is rejected with an error wrapping ErrInvalidMessage.
+// The Reader and Greedy fields are not used.
+func (d *Decoder) DecodeFrame(b []byte) (Message, error) {
+	if err := ValidateFrame(b); err != nil {
+		return nil, err
+	}
+	m, _, err := d.TryDecode(b)
+	return m, err
+}
@@ -0,0 +1,171 @@
+package qp
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"io/ioutil"
+	"testing"
+)
+
+func TestFramer(t *testing.T) {
+	var stream []byte
+	for _, tt := range MessageTestData {
+		stream = append(stream, tt.container...)
+	}
+
+	f := NewFramer(bytes.NewReader(stream))
+	for i, tt := range MessageTestData {
+		size, mt, err := f.PeekHeader()
+		if err != nil {
+			t.Fatalf("test %d: peek failed: %v", i, err)
+		}
+		if size != uint32(len(tt.container)) || mt != MessageType(tt.container[4]) {
+			t.Errorf("test %d: peeked size %d and type %v, expected %d and %v", i, size, mt, len(tt.container), MessageType(tt.container[4]))
+		}
+
+		// Peeking does not consume the frame.
+		if _, mt2, _ := f.PeekHeader(); mt2 != mt {
+			t.Errorf("test %d: second peek returned %v, expected %v", i, mt2, mt)
+		}
+
+		frame, mt, err := f.ReadFrame()
+		if err != nil {
+			t.Fatalf("test %d: read failed: %v", i, err)
+		}
+		if !bytes.Equal(frame, tt.container) || mt != MessageType(tt.container[4]) {
+			t.Errorf("test %d: got frame %#v of type %v, expected %#v", i, frame, mt, tt.container)
+		}
+	}
+
+	if _, _, err := f.PeekHeader(); err != io.EOF {
+		t.Errorf("expected %v at end of stream, got %v", io.EOF, err)
+	}
+	if _, _, err := f.ReadFrame(); err != io.EOF {
+		t.Errorf("expected %v at end of stream, got %v", io.EOF, err)
+	}
+}
+
+func TestFramerErrors(t *testing.T) {
+	c := MessageTestData[0].container
+
+	f := NewFramer(bytes.NewReader(c[:3]))
+	if _, _, err := f.PeekHeader(); !errors.Is(err, io.ErrUnexpectedEOF) {
+		t.Errorf("short header: expected %v, got %v", io.ErrUnexpectedEOF, err)
+	}
+
+	f = NewFramer(bytes.NewReader(c[:len(c)-1]))
+	if _, _, err := f.ReadFrame(); !errors.Is(err, ErrPayloadTooShort) || !errors.Is(err, io.ErrUnexpectedEOF) {
+		t.Errorf("short body: expected %v and %v, got %v", ErrPayloadTooShort, io.ErrUnexpectedEOF, err)
+	}
+
+	f = NewFramer(bytes.NewReader(c))
+	f.MessageSize = uint32(len(c)) - 1
+	if _, _, err := f.ReadFrame(); err != ErrMessageTooBig {
+		t.Errorf("expected %v, got %v", ErrMessageTooBig, err)
+	}
+
+	f = NewFramer(bytes.NewReader([]byte{4, 0, 0, 0, byte(Tclunk)}))
+	if _, _, err := f.PeekHeader(); err != ErrPayloadTooShort {
+		t.Errorf("expected %v, got %v", ErrPayloadTooShort, err)
+	}
+}
+
+func TestCopyFrame(t *testing.T) {
+	var stream []byte
+	for _, tt := range MessageTestData {
+		stream = append(stream, tt.container...)
+	}
+
+	src := bytes.NewReader(stream)
+	for i, tt := range MessageTestData {
+		dst := new(bytes.Buffer)
+		mt, tag, err := CopyFrame(dst, src)
+		if err != nil {
+			t.Fatalf("test %d: copy failed: %v", i, err)
+		}
+		if mt != MessageType(tt.container[4]) || tag != tt.input.GetTag() {
+			t.Errorf("test %d: got type %v and tag %d, expected %v and %d", i, mt, tag, MessageType(tt.container[4]), tt.input.GetTag())
+		}
+		if !bytes.Equal(dst.Bytes(), tt.container) {
+			t.Errorf("test %d: copied %#v, expected %#v", i, dst.Bytes(), tt.container)
+		}
+	}
+	if _, _, err := CopyFrame(ioutil.Discard, src); err != io.EOF {
+		t.Errorf("expected %v at end of stream, got %v", io.EOF, err)
+	}
+
+	// Malformed sizes are rejected without writing anything.
+	for _, size := range []byte{0, 4, 6} {
+		dst := new(bytes.Buffer)
+		_, _, err := CopyFrame(dst, bytes.NewReader([]byte{size, 0, 0, 0, byte(Tclunk), 1, 0, 0, 0}))
+		if err != ErrPayloadTooShort {
+			t.Errorf("size %d: expected %v, got %v", size, ErrPayloadTooShort, err)
+		}
+		if dst.Len() != 0 {
+			t.Errorf("size %d: wrote %d bytes", size, dst.Len())
+		}
+	}
+
+	c := MessageTestData[0].container
+	if _, _, err := CopyFrame(ioutil.Discard, bytes.NewReader(c[:len(c)-1])); !errors.Is(err, ErrPayloadTooShort) || !errors.Is(err, io.ErrUnexpectedEOF) {
+		t.Errorf("short body: expected %v and %v, got %v", ErrPayloadTooShort, io.ErrUnexpectedEOF, err)
+	}
+}
+
+func TestValidateFrame(t *testing.T) {
+	frame := MessageTestData[0].container
+	tests := []struct {
+		name     string
+		b        []byte
+		expected error
+	}{
+		{"exact", frame, nil},
+		{"too short", frame[:len(frame)-1], ErrPayloadTooShort},
+		{"short header", frame[:HeaderSize-1], ErrPayloadTooShort},
+		{"too long", append(append([]byte{}, frame...), 0), ErrSizeMismatch},
+		{"size below header", []byte{4, 0, 0, 0, byte(Tversion)}, ErrPayloadTooShort},
+	}
+	for _, tt := range tests {
+		if err := ValidateFrame(tt.b); err != tt.expected {
+			t.Errorf("%s: expected %v, got %v", tt.name, tt.expected, err)
+		}
+	}
+}
+
+func TestDecodeFrame(t *testing.T) {
+	rstat := &StatResponse{Tag: 2, Stat: Stat{
+		Qid:    Qid{Type: QTFILE, Version: 3, Path: 0x2a},
+		Mode:   0644,
+		Length: 12,
+		Name:   "hello",
+		UID:    "glenda",
+		GID:    "sys",
+		MUID:   "glenda",
+	}}
+	var buf bytes.Buffer
+	if err := NewEncoder(NineP2000, &buf).WriteMessage(rstat); err != nil {
+		t.Fatalf("write failed: %v", err)
+	}
+	frame := buf.Bytes()
+
+	m, err := DecodeFrame(frame)
+	if err != nil {
+		t.Fatalf("decode failed: %v", err)
+	}
+	if !MessagesEqual(m, rstat) {
+		t.Errorf("decoded %v, expected %v", m, rstat)
+	}
+
+	if _, err := DecodeFrame(append(append([]byte{}, frame...), 0)); err != ErrSizeMismatch {
+		t.Errorf("frame with trailing byte: expected %v, got %v", ErrSizeMismatch, err)
+	}
+	if _, err := DecodeFrame(frame[:len(frame)-1]); err != ErrPayloadTooShort {
+		t.Errorf("truncated frame: expected %v, got %v", ErrPayloadTooShort, err)
+	}
+
+	// A whole frame never asks for more bytes.
+	if _, err := DecodeFrame(truncatedBody); errors.Is(err, ErrPayloadTooShort) || !errors.Is(err, ErrInvalidMessage) {
+		t.Errorf("truncated body: expected %v, got %v", ErrInvalidMessage, err)
+	}
+}
@@ -0,0 +1,193 @@
+package qp
+
+import (
+	"errors"
+	"io"
+	"io/fs"
+	"path"
+	"sort"
+	"strings"
+)
+
+// clientFS is an fs.FS for the file tree of a Client.
+type clientFS struct {
+	c    *Client
+	root Fid
+}
+
+// NewFS returns an fs.FS for the file tree rooted at root, for use with the
+// io/fs based packages of the standard library. The returned value also
+// implements fs.ReadDirFS and fs.StatFS. Every call walks from root, which
+// remains owned by the caller and must not be clunked while the FS is in use.
+// Files are opened for reading, and are clunked by Close. Errors are
+// *fs.PathError values, matching fs.ErrNotExist if the file does not exist.
+func NewFS(c *Client, root Fid) fs.FS {
+	return &clientFS{c: c, root: root}
+}
+
+// walk walks to name, returning a new fid that must be clunked.
+func (cfs *clientFS) walk(op, name string) (Fid, error) {
+	if !fs.ValidPath(name) {
+		return NOFID, &fs.PathError{Op: op, Path: name, Err: fs.ErrInvalid}
+	}
+	var names []string
+	if name != "." {
+		names = strings.Split(name, "/")
+	}
+
+	fid, _, err := cfs.c.WalkPath(cfs.root, names)
+	if errors.Is(err, ErrIncompleteWalk) {
+		err = fs.ErrNotExist
+	}
+	if err != nil {
+		return NOFID, &fs.PathError{Op: op, Path: name, Err: err}
+	}
+	return fid, nil
+}
+
+// stat returns the stat of fid, named by the base of name as fs requires.
+func (cfs *clientFS) stat(op, name string, fid Fid) (Stat, error) {
+	s, err := cfs.c.Stat(fid)
+	if err != nil {
+		return Stat{}, &fs.PathError{Op: op, Path: name, Err: err}
+	}
+	s.Name = path.Base(name)
+	return s, nil
+}
+
+// Open opens the file name for reading.
+func (cfs *clientFS) Open(name string) (fs.File, error) {
+	fid, err := cfs.walk("open", name)
+	if err != nil {
+		return nil, err
+	}
+	s, err := cfs.stat("open", name, fid)
+	if err != nil {
+		cfs.c.Clunk(fid)
+		return nil, err
+	}
+	if _, _, err := cfs.c.Open(fid, OREAD); err != nil {
+		cfs.c.Clunk(fid)
+		return nil, &fs.PathError{Op: "open", Path: name, Err: err}
+	}
+	return &file{c: cfs.c, fid: fid, name: name, stat: s}, nil
+}
+
+// Stat returns a fs.FileInfo describing the file name, without opening it.
+func (cfs *clientFS) Stat(name string) (fs.FileInfo, error) {
+	fid, err := cfs.walk("stat", name)
+	if err != nil {
+		return nil, err
+	}
+	defer cfs.c.Clunk(fid)
+
+	s, err := cfs.stat("stat", name, fid)
+	if err != nil {
+		return nil, err
+	}
+	return s.FileInfo(), nil
+}
+
+// ReadDir reads the directory name, returning its entries sorted by name.
+func (cfs *clientFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	f, err := cfs.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	entries, err := f.(*file).ReadDir(-1)
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Name() < entries[j].Name() })
+	return entries, nil
+}
+
+// file is an open fs.File of a clientFS. Directories implement
+// fs.ReadDirFile.
+type file struct {
+	c      *Client
+	fid    Fid
+	name   string
+	stat   Stat
+	offset uint64
+	dir    *DirReader
+	closed bool
+}
+
+// Stat returns the stat of the file as it was opened.
+func (f *file) Stat() (fs.FileInfo, error) {
+	if f.closed {
+		return nil, &fs.PathError{Op: "stat", Path: f.name, Err: fs.ErrClosed}
+	}
+	return f.stat.FileInfo(), nil
+}
+
+// Read reads the file from where the last read ended, issuing a single read
+// request of at most len(p) bytes.
+func (f *file) Read(p []byte) (int, error) {
+	switch {
+	case f.closed:
+		return 0, &fs.PathError{Op: "read", Path: f.name, Err: fs.ErrClosed}
+	case f.stat.IsDir():
+		return 0, &fs.PathError{Op: "read", Path: f.name, Err: errors.New("is a directory")}
+	case len(p) == 0:
+		return 0, nil
+	}
+
+	count := f.c.chunkSize(f.fid, ReadOverhead)
+	if uint64(len(p)) < uint64(count) {
+		count = uint32(len(p))
+	}
+	b, err := f.c.Read(f.fid, f.offset, count)
+	if err != nil {
+		return 0, &fs.PathError{Op: "read", Path: f.name, Err: err}
+	}
+	if len(b) == 0 {
+		return 0, io.EOF
+	}
+	f.offset += uint64(len(b))
+	return copy(p, b), nil
+}
+
+// ReadDir reads the directory as described by fs.ReadDirFile.
+func (f *file) ReadDir(n int) ([]fs.DirEntry, error) {
+	switch {
+	case f.closed:
+		return nil, &fs.PathError{Op: "readdir", Path: f.name, Err: fs.ErrClosed}
+	case !f.stat.IsDir():
+		return nil, &fs.PathError{Op: "readdir", Path: f.name, Err: errors.New("not a directory")}
+	}
+	if f.dir == nil {
+		f.dir = f.c.DirReader(f.fid)
+	}
+
+	var entries []fs.DirEntry
+	for n <= 0 || len(entries) < n {
+		s, err := f.dir.Next()
+		if err == io.EOF {
+			if n > 0 && len(entries) == 0 {
+				return nil, io.EOF
+			}
+			break
+		}
+		if err != nil {
+			return entries, &fs.PathError{Op: "readdir", Path: f.name, Err: err}
+		}
+		entries = append(entries, fs.FileInfoToDirEntry(s.FileInfo()))
+	}
+	return entries, nil
+}
+
+// Close clunks the file.
+func (f *file) Close() error {
+	if f.closed {
+		return &fs.PathError{Op: "close", Path: f.name, Err: fs.ErrClosed}
+	}
+	f.closed = true
+	if err := f.c.Clunk(f.fid); err != nil {
+		return &fs.PathError{Op: "close", Path: f.name, Err: err}
+	}
+	return nil
+}
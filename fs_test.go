@@ -0,0 +1,100 @@
+package qp
+
+import (
+	"errors"
+	"io/fs"
+	"io/ioutil"
+	"net"
+	"sort"
+	"testing"
+	"testing/fstest"
+)
+
+// dirFS is a memFS whose root can be listed.
+type dirFS struct {
+	*memFS
+}
+
+func (fs dirFS) stat(name string) Stat {
+	s := Stat{Qid: fs.qid(name), Mode: 0444, Name: name, Length: uint64(len(fs.files[name]))}
+	if name == "" {
+		s.Mode, s.Name, s.Length = DMDIR|0555, "/", 0
+	}
+	return s
+}
+
+func (fs dirFS) Stat(r *StatRequest) (*StatResponse, error) {
+	return &StatResponse{Stat: fs.stat(fs.fids[r.Fid])}, nil
+}
+
+func (fs dirFS) Read(r *ReadRequest) (*ReadResponse, error) {
+	if fs.fids[r.Fid] != "" {
+		return fs.memFS.Read(r)
+	}
+
+	var names []string
+	for name := range fs.files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var dir []byte
+	for _, name := range names {
+		b, err := MarshalStat(fs.stat(name))
+		if err != nil {
+			return nil, err
+		}
+		dir = append(dir, b...)
+	}
+	if r.Offset >= uint64(len(dir)) {
+		return &ReadResponse{}, nil
+	}
+	return &ReadResponse{Data: dir[r.Offset:]}, nil
+}
+
+func TestFS(t *testing.T) {
+	files := map[string][]byte{
+		"hello": []byte("hello, world"),
+		"empty": nil,
+	}
+	cc, sc := net.Pipe()
+	go (&Server{Protocol: NineP2000, Handler: dirFS{&memFS{files: files, fids: make(map[Fid]string)}}}).Serve(sc)
+
+	c, root, err := Dial(cc, "glenda", "")
+	if err != nil {
+		t.Fatalf("dial failed: %v", err)
+	}
+	defer c.Close()
+
+	fsys := NewFS(c, root)
+	if err := fstest.TestFS(fsys, "hello", "empty"); err != nil {
+		t.Error(err)
+	}
+
+	b, err := fs.ReadFile(fsys, "hello")
+	if err != nil || string(b) != "hello, world" {
+		t.Errorf("ReadFile: got %q, %v", b, err)
+	}
+	if _, err := fs.Stat(fsys, "missing"); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("missing file: expected %v, got %v", fs.ErrNotExist, err)
+	}
+	if _, err := fsys.Open("../hello"); !errors.Is(err, fs.ErrInvalid) {
+		t.Errorf("invalid path: expected %v, got %v", fs.ErrInvalid, err)
+	}
+
+	f, err := fsys.Open("hello")
+	if err != nil {
+		t.Fatalf("open failed: %v", err)
+	}
+	if _, err := ioutil.ReadAll(f); err != nil {
+		t.Errorf("read failed: %v", err)
+	}
+	if err := f.Close(); err != nil {
+		t.Errorf("close failed: %v", err)
+	}
+	if err := f.Close(); !errors.Is(err, fs.ErrClosed) {
+		t.Errorf("second close: expected %v, got %v", fs.ErrClosed, err)
+	}
+	if fids := c.fids.Allocated(); len(fids) != 1 {
+		t.Errorf("fids %v allocated, expected only the root", fids)
+	}
+}
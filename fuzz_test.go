@@ -0,0 +1,67 @@
+package qp
+
+import (
+	"bytes"
+	"testing"
+)
+
+// fuzzProtocols are the protocols exercised by the fuzz targets.
+var fuzzProtocols = []Protocol{NineP2000, NineP2000Dotu, NineP2000Dote, NineP2000Dotl}
+
+// fuzzSeed adds the containers of all message test data to the corpus.
+func fuzzSeed(f *testing.F) {
+	tables := [][]MessageTestEntry{MessageTestData, MessageTestDataDotu, MessageTestDataDote, MessageTestDataDotl}
+	for _, table := range tables {
+		for _, tt := range table {
+			f.Add(tt.container)
+		}
+	}
+}
+
+// fuzzDecode decodes a single message from b. The message size is limited to
+// keep the fuzzer from spending its time on huge allocations.
+func fuzzDecode(p Protocol, b []byte) (Message, error) {
+	d := NewDecoder(p, bytes.NewReader(b))
+	d.MessageSize = 1 << 16
+	return d.ReadMessage()
+}
+
+// FuzzDecode ensures that decoding arbitrary input never panics.
+func FuzzDecode(f *testing.F) {
+	fuzzSeed(f)
+	f.Fuzz(func(t *testing.T, b []byte) {
+		for _, p := range fuzzProtocols {
+			m, err := fuzzDecode(p, b)
+			if err == nil && m == nil {
+				t.Fatalf("no message and no error")
+			}
+		}
+	})
+}
+
+// FuzzReencode ensures that successfully decoded messages survive being
+// encoded and decoded again.
+func FuzzReencode(f *testing.F) {
+	fuzzSeed(f)
+	f.Fuzz(func(t *testing.T, b []byte) {
+		for _, p := range fuzzProtocols {
+			m, err := fuzzDecode(p, b)
+			if err != nil {
+				continue
+			}
+
+			buf := new(bytes.Buffer)
+			if err := NewEncoder(p, buf).WriteMessage(m); err != nil {
+				t.Fatalf("encoding decoded %T failed: %v", m, err)
+			}
+
+			m2, err := fuzzDecode(p, buf.Bytes())
+			if err != nil {
+				t.Fatalf("decoding reencoded %T failed: %v", m, err)
+			}
+			if !MessagesEqual(m, m2) {
+				t.Fatalf("reencoded message differs.\n\tFirst:  %v\n\tSecond: %v", m, m2)
+			}
+		}
+	})
+}
@@ -0,0 +1,41 @@
+package qp
+
+// OnDecode registers hook to be called with every message of type mt decoded
+// by d, before the message is returned. Hooks of the same type run in the
+// order they were registered. Skipped messages run the hooks of their type
+// with the RawMessage, and streamed read responses with the
+// StreamingReadResponse. OnDecode must not be called while messages are being
+// decoded.
+func (d *Decoder) OnDecode(mt MessageType, hook func(Message)) {
+	if d.hooks == nil {
+		d.hooks = make(map[MessageType][]func(Message))
+	}
+	d.hooks[mt] = append(d.hooks[mt], hook)
+}
+
+// hook runs the hooks registered for the type of m, unless decoding failed.
+// It passes m and err through, so it can wrap the decoding functions.
+func (d *Decoder) hook(m Message, err error) (Message, error) {
+	if err != nil || d.hooks == nil {
+		return m, err
+	}
+
+	var mt MessageType
+	switch m := m.(type) {
+	case *RawMessage:
+		mt = m.Type
+	case *StreamingReadResponse:
+		mt, err = d.Protocol.MessageType(&ReadResponse{})
+	default:
+		mt, err = d.Protocol.MessageType(m)
+	}
+	if err != nil {
+		// A message the protocol decoded but cannot name has no hooks.
+		return m, nil
+	}
+
+	for _, h := range d.hooks[mt] {
+		h(m)
+	}
+	return m, nil
+}
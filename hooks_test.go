@@ -0,0 +1,64 @@
+package qp
+
+import (
+	"bytes"
+	"io"
+	"reflect"
+	"testing"
+)
+
+func TestDecoderOnDecode(t *testing.T) {
+	var buf bytes.Buffer
+	e := NewEncoder(NineP2000, &buf)
+	for _, m := range []Message{
+		&ReadResponse{Tag: 1, Data: []byte("hello")},
+		&ClunkResponse{Tag: 2},
+		&ReadResponse{Tag: 3},
+	} {
+		if err := e.WriteMessage(m); err != nil {
+			t.Fatalf("write failed: %v", err)
+		}
+	}
+	encoded := buf.Bytes()
+
+	for _, greedy := range []bool{false, true} {
+		d := NewDecoder(NineP2000, bytes.NewReader(encoded))
+		d.MessageSize = 8192
+		d.Greedy = greedy
+
+		var calls []string
+		var tags []Tag
+		d.OnDecode(Rread, func(m Message) {
+			calls = append(calls, "first")
+			tags = append(tags, m.GetTag())
+		})
+		d.OnDecode(Rread, func(m Message) { calls = append(calls, "second") })
+		d.OnDecode(Rerror, func(m Message) { t.Errorf("Rerror hook called with %v", m) })
+
+		for {
+			if _, err := d.ReadMessage(); err == io.EOF {
+				break
+			} else if err != nil {
+				t.Fatalf("greedy %v: read failed: %v", greedy, err)
+			}
+		}
+
+		expected := []string{"first", "second", "first", "second"}
+		if !reflect.DeepEqual(calls, expected) {
+			t.Errorf("greedy %v: got calls %v, expected %v", greedy, calls, expected)
+		}
+		if !reflect.DeepEqual(tags, []Tag{1, 3}) {
+			t.Errorf("greedy %v: hooks saw tags %v, expected [1 3]", greedy, tags)
+		}
+	}
+
+	d := NewDecoder(NineP2000, nil)
+	var n int
+	d.OnDecode(Rread, func(Message) { n++ })
+	if _, _, err := d.TryDecode(encoded); err != nil {
+		t.Fatalf("TryDecode failed: %v", err)
+	}
+	if n != 1 {
+		t.Errorf("TryDecode ran the hook %d times, expected 1", n)
+	}
+}
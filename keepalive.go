@@ -0,0 +1,78 @@
+package qp
+
+import (
+	"errors"
+	"time"
+)
+
+// ErrKeepaliveTimeout indicates that the server did not answer a keepalive
+// ping in time, and the connection was closed.
+var ErrKeepaliveTimeout = errors.New("keepalive timeout")
+
+// EnableKeepalive starts pinging the server every interval to detect a dead
+// peer. If a ping is not answered within interval, all pending and future
+// requests fail with ErrKeepaliveTimeout, and the connection is closed. The
+// pinging stops once the client is closed or has failed.
+//
+// A ping is made by calling ping, which should issue a cheap request, such as
+// a stat of the root fid. Errors returned by ping are ignored, as an error
+// response still shows that the server is alive. If ping is nil, a flush of
+// NOTAG is sent, which no request uses, so servers answer it without further
+// action. EnableKeepalive should be called at most once, after Version.
+func (c *Client) EnableKeepalive(interval time.Duration, ping func() error) {
+	if ping == nil {
+		ping = c.ping
+	}
+	go c.keepalive(interval, ping)
+}
+
+// keepalive runs the pings of EnableKeepalive.
+func (c *Client) keepalive(interval time.Duration, ping func() error) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-c.closed:
+			return
+		case <-ticker.C:
+		}
+
+		done := make(chan struct{})
+		go func() {
+			ping()
+			close(done)
+		}()
+
+		timer := time.NewTimer(interval)
+		select {
+		case <-done:
+			timer.Stop()
+		case <-c.closed:
+			timer.Stop()
+			return
+		case <-timer.C:
+			c.fail(ErrKeepaliveTimeout)
+			c.rwc.Close()
+			return
+		}
+	}
+}
+
+// ping is the default keepalive ping, flushing NOTAG. Like other flushes, it
+// is exempt from the limit set by SetMaxInflight.
+func (c *Client) ping() error {
+	m, err := c.send(func(t Tag) Message {
+		return &FlushRequest{
+			Tag:    t,
+			OldTag: NOTAG,
+		}
+	})
+	if err != nil {
+		return err
+	}
+	if _, ok := m.(*FlushResponse); !ok {
+		return unexpected(m)
+	}
+	return nil
+}
@@ -0,0 +1,65 @@
+package qp
+
+import (
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestKeepalive(t *testing.T) {
+	var pings int32
+	c := NewClient(serveFunc(func(req Message, tag Tag) Message {
+		if r, ok := req.(*FlushRequest); ok && r.OldTag == NOTAG {
+			atomic.AddInt32(&pings, 1)
+			return &FlushResponse{Tag: tag}
+		}
+		return &ErrorResponse{Tag: tag, Error: "unsupported"}
+	}), NineP2000)
+	defer c.Close()
+
+	c.EnableKeepalive(10*time.Millisecond, nil)
+	time.Sleep(100 * time.Millisecond)
+
+	if n := atomic.LoadInt32(&pings); n < 2 {
+		t.Errorf("got %d pings, expected several", n)
+	}
+	if _, err := c.Read(0, 0, 1); err == nil || err.Error() != "unsupported" {
+		t.Errorf("client unusable after pings: %v", err)
+	}
+}
+
+func TestKeepaliveTimeout(t *testing.T) {
+	var pings int32
+	c := NewClient(serveFunc(func(req Message, tag Tag) Message {
+		// A hung server answers nothing.
+		return nil
+	}), NineP2000)
+	defer c.Close()
+
+	errch := make(chan error, 1)
+	go func() {
+		_, err := c.Read(0, 0, 1)
+		errch <- err
+	}()
+
+	c.EnableKeepalive(10*time.Millisecond, func() error {
+		atomic.AddInt32(&pings, 1)
+		_, err := c.Stat(0)
+		return err
+	})
+
+	select {
+	case err := <-errch:
+		if err != ErrKeepaliveTimeout {
+			t.Errorf("pending request: expected %v, got %v", ErrKeepaliveTimeout, err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("pending request not failed by keepalive")
+	}
+	if _, err := c.Read(0, 0, 1); err != ErrKeepaliveTimeout {
+		t.Errorf("later request: expected %v, got %v", ErrKeepaliveTimeout, err)
+	}
+	if n := atomic.LoadInt32(&pings); n != 1 {
+		t.Errorf("custom ping called %d times, expected 1", n)
+	}
+}
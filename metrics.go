@@ -0,0 +1,98 @@
+package qp
+
+import "sync/atomic"
+
+// Metrics counts messages and bytes passing through instrumented readers and
+// writers. The counters are updated atomically, so a Metrics may be shared by
+// wrappers used from arbitrary goroutines. The zero value is ready for use.
+type Metrics struct {
+	// The 64-bit counters are kept first for alignment on 32-bit platforms.
+	bytesIn     uint64
+	bytesOut    uint64
+	messagesIn  [256]uint64
+	messagesOut [256]uint64
+}
+
+// MetricsSnapshot is a copy of the counters of a Metrics.
+type MetricsSnapshot struct {
+	// BytesIn and BytesOut are the total sizes of the messages read and
+	// written, including headers.
+	BytesIn  uint64
+	BytesOut uint64
+
+	// MessagesIn and MessagesOut are the counts of messages read and written,
+	// indexed by message type.
+	MessagesIn  [256]uint64
+	MessagesOut [256]uint64
+}
+
+// Snapshot returns a copy of the current counters. As the counters are read
+// one by one, a snapshot taken while messages are flowing may be slightly
+// inconsistent.
+func (m *Metrics) Snapshot() MetricsSnapshot {
+	var s MetricsSnapshot
+	s.BytesIn = atomic.LoadUint64(&m.bytesIn)
+	s.BytesOut = atomic.LoadUint64(&m.bytesOut)
+	for i := range s.MessagesIn {
+		s.MessagesIn[i] = atomic.LoadUint64(&m.messagesIn[i])
+		s.MessagesOut[i] = atomic.LoadUint64(&m.messagesOut[i])
+	}
+	return s
+}
+
+// count records a message of protocol p in the provided counters.
+func (m *Metrics) count(p Protocol, msg Message, bytes *uint64, messages *[256]uint64) {
+	atomic.AddUint64(bytes, uint64(msg.EncodedSize()+HeaderSize))
+	if mt, err := p.MessageType(msg); err == nil {
+		atomic.AddUint64(&messages[mt], 1)
+	}
+}
+
+// InstrumentReader returns a MessageReader that counts every message of
+// protocol p successfully read from r in m.
+func InstrumentReader(r MessageReader, p Protocol, m *Metrics) MessageReader {
+	return &instrumentedReader{r: r, p: p, m: m}
+}
+
+// InstrumentWriter returns a MessageWriter that counts every message of
+// protocol p successfully written to w in m.
+func InstrumentWriter(w MessageWriter, p Protocol, m *Metrics) MessageWriter {
+	return &instrumentedWriter{w: w, p: p, m: m}
+}
+
+// Instrument returns a MessageReadWriter that counts both directions of rw,
+// as done by InstrumentReader and InstrumentWriter.
+func Instrument(rw MessageReadWriter, p Protocol, m *Metrics) MessageReadWriter {
+	return struct {
+		MessageReader
+		MessageWriter
+	}{InstrumentReader(rw, p, m), InstrumentWriter(rw, p, m)}
+}
+
+type instrumentedReader struct {
+	r MessageReader
+	p Protocol
+	m *Metrics
+}
+
+func (ir *instrumentedReader) ReadMessage() (Message, error) {
+	msg, err := ir.r.ReadMessage()
+	if err == nil {
+		ir.m.count(ir.p, msg, &ir.m.bytesIn, &ir.m.messagesIn)
+	}
+	return msg, err
+}
+
+type instrumentedWriter struct {
+	w MessageWriter
+	p Protocol
+	m *Metrics
+}
+
+func (iw *instrumentedWriter) WriteMessage(msg Message) error {
+	err := iw.w.WriteMessage(msg)
+	if err == nil {
+		iw.m.count(iw.p, msg, &iw.m.bytesOut, &iw.m.messagesOut)
+	}
+	return err
+}
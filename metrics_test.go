@@ -0,0 +1,72 @@
+package qp
+
+import (
+	"bytes"
+	"sync"
+	"testing"
+)
+
+func TestMetrics(t *testing.T) {
+	var m Metrics
+	buf := new(bytes.Buffer)
+	w := InstrumentWriter(NewEncoder(NineP2000, buf), NineP2000, &m)
+	r := InstrumentReader(NewDecoder(NineP2000, buf), NineP2000, &m)
+
+	var total uint64
+	for _, tt := range MessageTestData {
+		if err := w.WriteMessage(tt.input); err != nil {
+			t.Fatalf("write failed: %v", err)
+		}
+		total += uint64(len(tt.container))
+	}
+	for range MessageTestData {
+		if _, err := r.ReadMessage(); err != nil {
+			t.Fatalf("read failed: %v", err)
+		}
+	}
+
+	s := m.Snapshot()
+	if s.BytesIn != total || s.BytesOut != total {
+		t.Errorf("got %d bytes in and %d bytes out, expected %d", s.BytesIn, s.BytesOut, total)
+	}
+	for _, tt := range MessageTestData {
+		mt := MessageType(tt.container[4])
+		if s.MessagesIn[mt] != 1 || s.MessagesOut[mt] != 1 {
+			t.Errorf("%v: got %d in and %d out, expected 1", mt, s.MessagesIn[mt], s.MessagesOut[mt])
+		}
+	}
+}
+
+func TestMetricsConcurrent(t *testing.T) {
+	var (
+		m  Metrics
+		wg sync.WaitGroup
+	)
+	for g := 0; g < 8; g++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			w := InstrumentWriter(NewEncoder(NineP2000, new(bytes.Buffer)), NineP2000, &m)
+			for i := 0; i < 100; i++ {
+				w.WriteMessage(&ClunkRequest{})
+				m.Snapshot()
+			}
+		}()
+	}
+	wg.Wait()
+
+	if s := m.Snapshot(); s.MessagesOut[Tclunk] != 800 {
+		t.Errorf("got %d clunks, expected 800", s.MessagesOut[Tclunk])
+	}
+}
+
+func BenchmarkInstrumentWriter(b *testing.B) {
+	var m Metrics
+	w := InstrumentWriter(NewEncoder(NineP2000, new(bytes.Buffer)), NineP2000, &m)
+	msg := &ClunkRequest{}
+
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		w.WriteMessage(msg)
+	}
+}
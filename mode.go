@@ -0,0 +1,120 @@
+package qp
+
+import (
+	"errors"
+	"os"
+)
+
+var (
+	// ErrInvalidOpenMode indicates that an open mode has unknown bits set, or
+	// combines flags illegally.
+	ErrInvalidOpenMode = errors.New("invalid open mode")
+
+	// ErrUnsupportedFlags indicates that os.OpenFile flags or an open mode
+	// hold flags that have no counterpart on the other side.
+	ErrUnsupportedFlags = errors.New("unsupported open flags")
+)
+
+// openModeMask holds the bits of all valid open modes.
+const openModeMask = 0x03 | OTRUNC | OCEXEC | ORCLOSE
+
+// ValidateOpenMode checks that mode only holds known bits, and that OTRUNC is
+// only used with an access mode permitting writes.
+func ValidateOpenMode(mode OpenMode) error {
+	if mode&^openModeMask != 0 {
+		return ErrInvalidOpenMode
+	}
+	if mode&OTRUNC != 0 {
+		switch mode & 0x03 {
+		case OWRITE, ORDWR:
+		default:
+			return ErrInvalidOpenMode
+		}
+	}
+	return nil
+}
+
+// openFlagsMask holds the os.OpenFile flags understood by OpenFlagsToMode.
+const openFlagsMask = os.O_WRONLY | os.O_RDWR | os.O_TRUNC | os.O_APPEND | os.O_CREATE | os.O_EXCL
+
+// OpenFlagsToMode converts os.OpenFile flags to a 9P open mode. If create is
+// set, the file is to be created with Tcreate if it does not exist. As a 9P
+// create fails if the file exists, O_EXCL needs no translation. 9P has no
+// append flag when opening, as appending is the DMAPPEND permission of a
+// file, so O_APPEND is accepted but left to the caller, who can create the
+// file with DMAPPEND, or write at the end of the file. Flags without a 9P
+// counterpart, such as O_SYNC, fail with ErrUnsupportedFlags, and O_TRUNC
+// without write access or O_EXCL without O_CREATE with ErrInvalidOpenMode.
+func OpenFlagsToMode(flag int) (mode OpenMode, create bool, err error) {
+	if flag&^openFlagsMask != 0 {
+		return 0, false, ErrUnsupportedFlags
+	}
+
+	switch flag & (os.O_WRONLY | os.O_RDWR) {
+	case os.O_RDONLY:
+		mode = OREAD
+	case os.O_WRONLY:
+		mode = OWRITE
+	case os.O_RDWR:
+		mode = ORDWR
+	default:
+		return 0, false, ErrInvalidOpenMode
+	}
+	if flag&os.O_TRUNC != 0 {
+		mode |= OTRUNC
+	}
+	if flag&os.O_EXCL != 0 && flag&os.O_CREATE == 0 {
+		return 0, false, ErrInvalidOpenMode
+	}
+	if err := ValidateOpenMode(mode); err != nil {
+		return 0, false, err
+	}
+	return mode, flag&os.O_CREATE != 0, nil
+}
+
+// OpenModeToFlags converts a 9P open mode to os.OpenFile flags. OEXEC is
+// converted to os.O_RDONLY, as executing implies reading. OCEXEC and ORCLOSE
+// have no counterpart, and fail with ErrUnsupportedFlags.
+func OpenModeToFlags(mode OpenMode) (int, error) {
+	if err := ValidateOpenMode(mode); err != nil {
+		return 0, err
+	}
+	if mode&(OCEXEC|ORCLOSE) != 0 {
+		return 0, ErrUnsupportedFlags
+	}
+
+	var flag int
+	switch mode & 0x03 {
+	case OREAD, OEXEC:
+		flag = os.O_RDONLY
+	case OWRITE:
+		flag = os.O_WRONLY
+	case ORDWR:
+		flag = os.O_RDWR
+	}
+	if mode&OTRUNC != 0 {
+		flag |= os.O_TRUNC
+	}
+	return flag, nil
+}
+
+// Perm returns the FileMode for a file with the Unix permission bits unix,
+// such as 0644. If dir is set, DMDIR is added for creating a directory. Bits
+// outside of the nine permission bits are ignored.
+func Perm(unix uint32, dir bool) FileMode {
+	m := FileMode(unix & 0777)
+	if dir {
+		m |= DMDIR
+	}
+	return m
+}
+
+// IsDir reports whether the Stat describes a directory.
+func (s *Stat) IsDir() bool {
+	return s.Mode&DMDIR != 0
+}
+
+// UnixPerm returns the Unix permission bits of the Stat, such as 0644.
+func (s *Stat) UnixPerm() uint32 {
+	return uint32(s.Mode & 0777)
+}
@@ -0,0 +1,157 @@
+package qp
+
+import (
+	"os"
+	"testing"
+)
+
+func TestValidateOpenMode(t *testing.T) {
+	tests := []struct {
+		mode  OpenMode
+		valid bool
+	}{
+		{OREAD, true},
+		{OWRITE, true},
+		{ORDWR, true},
+		{OEXEC, true},
+		{OWRITE | OTRUNC, true},
+		{ORDWR | OTRUNC | ORCLOSE | OCEXEC, true},
+		{OREAD | ORCLOSE, true},
+		{OREAD | OTRUNC, false},
+		{OEXEC | OTRUNC, false},
+		{0x04, false},
+		{0x80, false},
+	}
+
+	for i, tt := range tests {
+		err := ValidateOpenMode(tt.mode)
+		if tt.valid && err != nil {
+			t.Errorf("test %d: mode %#x rejected: %v", i, tt.mode, err)
+		}
+		if !tt.valid && err != ErrInvalidOpenMode {
+			t.Errorf("test %d: mode %#x: expected %v, got %v", i, tt.mode, ErrInvalidOpenMode, err)
+		}
+	}
+}
+
+func TestOpenModeValues(t *testing.T) {
+	// The flag values are fixed by the protocol.
+	if OTRUNC != 0x10 || OCEXEC != 0x20 || ORCLOSE != 0x40 {
+		t.Errorf("got OTRUNC=%#x OCEXEC=%#x ORCLOSE=%#x, expected 0x10 0x20 0x40", OTRUNC, OCEXEC, ORCLOSE)
+	}
+}
+
+func TestPerm(t *testing.T) {
+	tests := []struct {
+		unix uint32
+		dir  bool
+		mode FileMode
+	}{
+		{0644, false, 0644},
+		{0755, true, DMDIR | 0755},
+		{01777, false, 0777},
+	}
+
+	for i, tt := range tests {
+		m := Perm(tt.unix, tt.dir)
+		if m != tt.mode {
+			t.Errorf("test %d: got %#o, expected %#o", i, m, tt.mode)
+		}
+
+		// Round-trip through a Stat.
+		in := Stat{Mode: m, Name: "file"}
+		b := make([]byte, in.EncodedSize())
+		in.Marshal(b)
+		var s Stat
+		if err := s.Unmarshal(b); err != nil {
+			t.Fatalf("test %d: unmarshal failed: %v", i, err)
+		}
+		if s.IsDir() != tt.dir {
+			t.Errorf("test %d: IsDir() = %t, expected %t", i, s.IsDir(), tt.dir)
+		}
+		if p := s.UnixPerm(); p != tt.unix&0777 {
+			t.Errorf("test %d: UnixPerm() = %#o, expected %#o", i, p, tt.unix&0777)
+		}
+	}
+}
+
+func TestOpenFlagsToMode(t *testing.T) {
+	accesses := []struct {
+		flag int
+		mode OpenMode
+	}{
+		{os.O_RDONLY, OREAD},
+		{os.O_WRONLY, OWRITE},
+		{os.O_RDWR, ORDWR},
+	}
+
+	// Every combination of the access modes and the supported flags.
+	for _, a := range accesses {
+		for bits := 0; bits < 16; bits++ {
+			flag := a.flag
+			for i, f := range []int{os.O_TRUNC, os.O_APPEND, os.O_CREATE, os.O_EXCL} {
+				if bits&(1<<i) != 0 {
+					flag |= f
+				}
+			}
+
+			mode, create, err := OpenFlagsToMode(flag)
+			trunc := flag&os.O_TRUNC != 0
+			switch {
+			case trunc && a.mode == OREAD, flag&os.O_EXCL != 0 && flag&os.O_CREATE == 0:
+				if err != ErrInvalidOpenMode {
+					t.Errorf("flags %#x: expected %v, got %v", flag, ErrInvalidOpenMode, err)
+				}
+				continue
+			case err != nil:
+				t.Errorf("flags %#x: %v", flag, err)
+				continue
+			}
+
+			expected := a.mode
+			if trunc {
+				expected |= OTRUNC
+			}
+			if mode != expected || create != (flag&os.O_CREATE != 0) {
+				t.Errorf("flags %#x: got mode %#x, create %v, expected %#x, %v", flag, mode, create, expected, flag&os.O_CREATE != 0)
+			}
+
+			// The inverse drops the flags that only affect creation and
+			// writing.
+			back, err := OpenModeToFlags(mode)
+			if err != nil {
+				t.Errorf("mode %#x: %v", mode, err)
+			}
+			if want := flag &^ (os.O_APPEND | os.O_CREATE | os.O_EXCL); back != want {
+				t.Errorf("mode %#x: got flags %#x, expected %#x", mode, back, want)
+			}
+		}
+	}
+
+	if _, _, err := OpenFlagsToMode(os.O_RDWR | os.O_SYNC); err != ErrUnsupportedFlags {
+		t.Errorf("O_SYNC: expected %v, got %v", ErrUnsupportedFlags, err)
+	}
+	if _, _, err := OpenFlagsToMode(os.O_WRONLY | os.O_RDWR); err != ErrInvalidOpenMode {
+		t.Errorf("O_WRONLY|O_RDWR: expected %v, got %v", ErrInvalidOpenMode, err)
+	}
+}
+
+func TestOpenModeToFlags(t *testing.T) {
+	tests := []struct {
+		mode OpenMode
+		flag int
+		err  error
+	}{
+		{OEXEC, os.O_RDONLY, nil},
+		{ORDWR | OTRUNC, os.O_RDWR | os.O_TRUNC, nil},
+		{OREAD | ORCLOSE, 0, ErrUnsupportedFlags},
+		{OWRITE | OCEXEC, 0, ErrUnsupportedFlags},
+		{OREAD | OTRUNC, 0, ErrInvalidOpenMode},
+	}
+	for _, tt := range tests {
+		flag, err := OpenModeToFlags(tt.mode)
+		if flag != tt.flag || err != tt.err {
+			t.Errorf("mode %#x: got %#x, %v, expected %#x, %v", tt.mode, flag, err, tt.flag, tt.err)
+		}
+	}
+}
@@ -0,0 +1,174 @@
+package qp
+
+// pipeline sends the requests built by builds in order, without waiting for
+// any response in between, and then waits for all of the responses. The
+// responses may arrive in any order. Every request counts against the limit
+// set by SetMaxInflight. If the limit is reached, the earliest outstanding
+// request is awaited before the next is sent, so the pipeline is never deeper
+// than the limit. If a request cannot be sent, it and the requests following
+// it fail with the same error. The number of requests sent is returned.
+func (c *Client) pipeline(builds ...func(Tag) Message) ([]Message, []error, int) {
+	msgs := make([]Message, len(builds))
+	errs := make([]error, len(builds))
+	fail := func(i int, err error) {
+		for ; i < len(errs); i++ {
+			errs[i] = err
+		}
+	}
+
+	var (
+		chans []chan Message
+		sems  []chan struct{}
+		next  int
+	)
+	release := func(sem chan struct{}) {
+		if sem != nil {
+			<-sem
+		}
+	}
+	// await waits for the response to the earliest outstanding request, and
+	// releases its token.
+	await := func() {
+		msgs[next], errs[next] = c.wait(chans[next])
+		release(sems[next])
+		next++
+	}
+
+	for i, build := range builds {
+		sem, err := c.tryAcquire()
+		for err == ErrBusy && next < len(chans) {
+			await()
+			sem, err = c.tryAcquire()
+		}
+		if err == ErrBusy {
+			// The pipeline holds no tokens, so the limit applies as usual.
+			sem, err = c.acquire()
+		}
+		if err != nil {
+			fail(i, err)
+			break
+		}
+
+		t, err := c.tags.Allocate()
+		if err != nil {
+			release(sem)
+			fail(i, err)
+			break
+		}
+		defer c.releaseTag(t)
+
+		ch, err := c.start(t, build(t))
+		if err != nil {
+			release(sem)
+			fail(i, err)
+			break
+		}
+		chans = append(chans, ch)
+		sems = append(sems, sem)
+	}
+
+	for next < len(chans) {
+		await()
+	}
+	return msgs, errs, len(chans)
+}
+
+// ReadFile reads the file at path, walked from fid, with the walk, open, read
+// and clunk requests pipelined: all of them are sent before any response is
+// awaited, so a file fitting in a single read costs a single round trip rather
+// than four. Pipelining relies on the server handling the requests of a
+// connection in the order they were sent, although it may answer them in any
+// order. Each request counts against the limit set by SetMaxInflight, which
+// bounds how many of them are in flight at once.
+//
+// If any walk or the open fails, its error is returned, with
+// ErrIncompleteWalk if only part of the path exists. A failing clunk is not
+// reported, as the server forgets the fid regardless. If the first read is
+// full, the file may hold more data, which is then read through a second walk
+// to the file, without pipelining.
+func (c *Client) ReadFile(fid Fid, path []string) ([]byte, error) {
+	newfid, err := c.fids.Allocate()
+	if err != nil {
+		return nil, err
+	}
+
+	count := c.chunkSize(newfid, ReadOverhead)
+	if count == 0 {
+		c.fids.Release(newfid)
+		return nil, ErrMessageTooBig
+	}
+
+	groups := SplitWalk(path)
+	var builds []func(Tag) Message
+	for i, g := range groups {
+		from, names := newfid, g
+		if i == 0 {
+			from = fid
+		}
+		builds = append(builds, func(t Tag) Message {
+			return &WalkRequest{Tag: t, Fid: from, NewFid: newfid, Names: names}
+		})
+	}
+	builds = append(builds,
+		func(t Tag) Message { return &OpenRequest{Tag: t, Fid: newfid, Mode: OREAD} },
+		func(t Tag) Message { return &ReadRequest{Tag: t, Fid: newfid, Count: count} },
+		func(t Tag) Message { return &ClunkRequest{Tag: t, Fid: newfid} },
+	)
+
+	msgs, errs, sent := c.pipeline(builds...)
+	if sent > 0 && sent < len(builds) {
+		// A walk may have created newfid on the server, but the clunk was
+		// not sent, so the fid cannot be reused before it is clunked.
+		c.clunk(newfid, c.send)
+	} else {
+		c.fids.Release(newfid)
+	}
+
+	for i, g := range groups {
+		if errs[i] != nil {
+			return nil, errs[i]
+		}
+		r, ok := msgs[i].(*WalkResponse)
+		if !ok {
+			return nil, unexpected(msgs[i])
+		}
+		if len(r.Qids) > len(g) {
+			return nil, ErrInvalidWalk
+		}
+		if len(r.Qids) < len(g) {
+			return nil, ErrIncompleteWalk
+		}
+	}
+
+	n := len(groups)
+	if errs[n] != nil {
+		return nil, errs[n]
+	}
+	or, ok := msgs[n].(*OpenResponse)
+	if !ok {
+		return nil, unexpected(msgs[n])
+	}
+	if errs[n+1] != nil {
+		return nil, errs[n+1]
+	}
+	rr, ok := msgs[n+1].(*ReadResponse)
+	if !ok {
+		return nil, unexpected(msgs[n+1])
+	}
+
+	data := rr.Data
+	if uint32(len(data)) < count && (or.IOUnit == 0 || uint32(len(data)) < or.IOUnit) {
+		return data, nil
+	}
+
+	// The read was full, and the first fid is gone.
+	f, _, err := c.WalkPath(fid, path)
+	if err != nil {
+		return nil, err
+	}
+	defer c.Clunk(f)
+	if _, _, err := c.Open(f, OREAD); err != nil {
+		return nil, err
+	}
+	return c.readAll(f, uint64(len(data)), data)
+}
@@ -0,0 +1,292 @@
+package qp
+
+import (
+	"bytes"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// serveBatch serves requests in batches of n, answering each batch in reverse
+// order once all of its requests have arrived.
+func serveBatch(n int, handle func(req Message, tag Tag) Message) net.Conn {
+	cc, sc := net.Pipe()
+	go func() {
+		d := NewDecoder(NineP2000, sc)
+		e := NewEncoder(NineP2000, sc)
+		for {
+			batch := make([]Message, n)
+			for i := range batch {
+				m, err := d.ReadMessage()
+				if err != nil {
+					sc.Close()
+					return
+				}
+				batch[i] = m
+			}
+			for i := len(batch) - 1; i >= 0; i-- {
+				e.WriteMessage(handle(batch[i], batch[i].GetTag()))
+			}
+		}
+	}()
+	return cc
+}
+
+func TestClientReadFile(t *testing.T) {
+	var got []string
+	c := NewClient(serveBatch(4, func(req Message, tag Tag) Message {
+		mt, _ := NineP2000.MessageType(req)
+		got = append(got, mt.String())
+		switch r := req.(type) {
+		case *WalkRequest:
+			if r.Names[0] == "missing" {
+				return &ErrorResponse{Tag: tag, Error: "file not found"}
+			}
+			return &WalkResponse{Tag: tag, Qids: make([]Qid, len(r.Names))}
+		case *OpenRequest:
+			return &OpenResponse{Tag: tag}
+		case *ReadRequest:
+			return &ReadResponse{Tag: tag, Data: []byte("hello, world")}
+		case *ClunkRequest:
+			return &ClunkResponse{Tag: tag}
+		}
+		return &ErrorResponse{Tag: tag, Error: "unexpected request"}
+	}), NineP2000)
+	defer c.Close()
+
+	data, err := c.ReadFile(1, []string{"dir", "hello"})
+	if err != nil {
+		t.Fatalf("read failed: %v", err)
+	}
+	if string(data) != "hello, world" {
+		t.Errorf("got %q, expected %q", data, "hello, world")
+	}
+	// The responses are sent in reverse order, so the handler sees the
+	// requests in reverse too.
+	if s := strings.Join(got, " "); s != "Tclunk Tread Topen Twalk" {
+		t.Errorf("got requests %s", s)
+	}
+
+	if _, err := c.ReadFile(1, []string{"missing"}); err == nil || err.Error() != "file not found" {
+		t.Errorf("missing file: expected file not found, got %v", err)
+	}
+	if fids := c.fids.Allocated(); len(fids) != 0 {
+		t.Errorf("fids %v still allocated", fids)
+	}
+}
+
+func TestClientReadFileLarge(t *testing.T) {
+	content := bytes.Repeat([]byte("9P"), 1000)
+	fs := &memFS{
+		files: map[string][]byte{"big": content},
+		fids:  make(map[Fid]string),
+	}
+	cc, sc := net.Pipe()
+	go (&Server{Protocol: NineP2000, Handler: fs}).Serve(sc)
+
+	c, root, err := Dial(cc, "glenda", "", WithMessageSize(256))
+	if err != nil {
+		t.Fatalf("dial failed: %v", err)
+	}
+	defer c.Close()
+
+	data, err := c.ReadFile(root, []string{"big"})
+	if err != nil {
+		t.Fatalf("read failed: %v", err)
+	}
+	if !bytes.Equal(data, content) {
+		t.Errorf("got %d bytes, expected %d", len(data), len(content))
+	}
+	if len(fs.fids) != 1 {
+		t.Errorf("server holds %d fids, expected only the root", len(fs.fids))
+	}
+}
+
+func TestClientReadFilePartial(t *testing.T) {
+	var (
+		mu      sync.Mutex
+		clunked []Fid
+	)
+	c := NewClient(serveFunc(func(req Message, tag Tag) Message {
+		switch r := req.(type) {
+		case *WalkRequest:
+			return &WalkResponse{Tag: tag, Qids: make([]Qid, len(r.Names))}
+		case *OpenRequest:
+			return &OpenResponse{Tag: tag}
+		case *ClunkRequest:
+			mu.Lock()
+			clunked = append(clunked, r.Fid)
+			mu.Unlock()
+			return &ClunkResponse{Tag: tag}
+		}
+		return &ErrorResponse{Tag: tag, Error: "unexpected request"}
+	}), NineP2000)
+	defer c.Close()
+
+	// The read runs out of tags after the walk and open were sent.
+	c.tags.Limit = 2
+	if _, err := c.ReadFile(1, []string{"hello"}); err != ErrNoFreeTags {
+		t.Errorf("expected %v, got %v", ErrNoFreeTags, err)
+	}
+	mu.Lock()
+	if len(clunked) != 1 {
+		t.Errorf("got clunks of %v, expected the walked fid to be clunked", clunked)
+	}
+	mu.Unlock()
+	if fids := c.fids.Allocated(); len(fids) != 0 {
+		t.Errorf("fids %v still allocated", fids)
+	}
+}
+
+func TestClientReadFileMaxInflight(t *testing.T) {
+	var (
+		mu               sync.Mutex
+		outstanding, max int
+	)
+	c := NewClient(serveFunc(func(req Message, tag Tag) Message {
+		mu.Lock()
+		outstanding++
+		if outstanding > max {
+			max = outstanding
+		}
+		mu.Unlock()
+
+		// Answering takes a while, so further requests would pile up
+		// without the limit.
+		time.Sleep(5 * time.Millisecond)
+		mu.Lock()
+		outstanding--
+		mu.Unlock()
+
+		switch r := req.(type) {
+		case *WalkRequest:
+			return &WalkResponse{Tag: tag, Qids: make([]Qid, len(r.Names))}
+		case *OpenRequest:
+			return &OpenResponse{Tag: tag}
+		case *ReadRequest:
+			return &ReadResponse{Tag: tag, Data: []byte("hello, world")}
+		case *ClunkRequest:
+			return &ClunkResponse{Tag: tag}
+		}
+		return &ErrorResponse{Tag: tag, Error: "unexpected request"}
+	}), NineP2000)
+	defer c.Close()
+
+	for _, wait := range []bool{true, false} {
+		mu.Lock()
+		max = 0
+		mu.Unlock()
+		c.SetMaxInflight(2, wait)
+		data, err := c.ReadFile(1, []string{"dir", "hello"})
+		if err != nil {
+			t.Fatalf("wait %v: read failed: %v", wait, err)
+		}
+		if string(data) != "hello, world" {
+			t.Errorf("wait %v: got %q, expected %q", wait, data, "hello, world")
+		}
+		mu.Lock()
+		if max > 2 {
+			t.Errorf("wait %v: %d requests in flight, expected at most 2", wait, max)
+		}
+		mu.Unlock()
+	}
+}
+
+// countingConn counts the writes to a connection.
+type countingConn struct {
+	net.Conn
+	writes int64
+}
+
+func (cc *countingConn) Write(b []byte) (int, error) {
+	atomic.AddInt64(&cc.writes, 1)
+	return cc.Conn.Write(b)
+}
+
+func TestClientWriteBuffer(t *testing.T) {
+	conn := &countingConn{Conn: serveBatch(4, func(req Message, tag Tag) Message {
+		switch r := req.(type) {
+		case *WalkRequest:
+			return &WalkResponse{Tag: tag, Qids: make([]Qid, len(r.Names))}
+		case *OpenRequest:
+			return &OpenResponse{Tag: tag}
+		case *ReadRequest:
+			return &ReadResponse{Tag: tag, Data: []byte("hello")}
+		}
+		return &ClunkResponse{Tag: tag}
+	})}
+	c := NewClient(conn, NineP2000)
+	defer c.Close()
+
+	if err := c.SetWriteBuffer(4096); err != nil {
+		t.Fatalf("setting buffer failed: %v", err)
+	}
+	if _, err := c.ReadFile(1, []string{"hello"}); err != nil {
+		t.Fatalf("read failed: %v", err)
+	}
+	if n := atomic.LoadInt64(&conn.writes); n != 1 {
+		t.Errorf("pipelined requests took %d writes, expected 1", n)
+	}
+
+	if err := c.SetWriteBuffer(0); err != nil {
+		t.Fatalf("removing buffer failed: %v", err)
+	}
+	if _, err := c.ReadFile(1, []string{"hello"}); err != nil {
+		t.Fatalf("unbuffered read failed: %v", err)
+	}
+	if n := atomic.LoadInt64(&conn.writes); n != 1+4 {
+		t.Errorf("unbuffered requests took %d writes, expected 4", n-1)
+	}
+}
+
+func TestClientWriteBufferKeepalive(t *testing.T) {
+	var pings int64
+	c := NewClient(serveFunc(func(req Message, tag Tag) Message {
+		atomic.AddInt64(&pings, 1)
+		return &FlushResponse{Tag: tag}
+	}), NineP2000)
+	defer c.Close()
+	c.EnableKeepalive(time.Millisecond, nil)
+
+	// Run with -race, replacing the writer while pings are written.
+	for i := 0; i < 50; i++ {
+		if err := c.SetWriteBuffer(4096 * (i % 2)); err != nil {
+			t.Fatalf("setting write buffer failed: %v", err)
+		}
+		time.Sleep(200 * time.Microsecond)
+	}
+	if atomic.LoadInt64(&pings) == 0 {
+		t.Error("no pings sent")
+	}
+}
+
+func BenchmarkClientWriteBuffer(b *testing.B) {
+	data := make([]byte, 16)
+	builds := make([]func(Tag) Message, 16)
+	for i := range builds {
+		builds[i] = func(t Tag) Message { return &WriteRequest{Tag: t, Fid: 1, Data: data} }
+	}
+
+	for _, size := range []int{0, 4096} {
+		b.Run(fmt.Sprintf("buffer=%d", size), func(b *testing.B) {
+			conn := &countingConn{Conn: serveFunc(func(req Message, tag Tag) Message {
+				return &WriteResponse{Tag: tag, Count: uint32(len(data))}
+			})}
+			c := NewClient(conn, NineP2000)
+			defer c.Close()
+			c.SetWriteBuffer(size)
+
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				if _, errs, _ := c.pipeline(builds...); errs[0] != nil {
+					b.Fatalf("write failed: %v", errs[0])
+				}
+			}
+			b.ReportMetric(float64(atomic.LoadInt64(&conn.writes))/float64(b.N), "writes/op")
+		})
+	}
+}
@@ -0,0 +1,162 @@
+package qp
+
+import (
+	"errors"
+	"sync"
+)
+
+var (
+	// ErrNoFreeTags indicates that all tags of a TagPool are in use.
+	ErrNoFreeTags = errors.New("no free tags")
+
+	// ErrNoFreeFids indicates that all fids of a FidPool are in use.
+	ErrNoFreeFids = errors.New("no free fids")
+)
+
+// TagPool hands out unique tags for outstanding requests. Tags are recycled
+// once released. NOTAG is never handed out, as it is reserved for Tversion.
+// TagPool is thread safe, and may be shared between goroutines.
+type TagPool struct {
+	// Limit is the maximum number of outstanding tags. Zero, or a value larger
+	// than the tag space, allows every tag except NOTAG to be used.
+	Limit int
+
+	mu   sync.Mutex
+	next Tag
+	used int
+	free []Tag
+}
+
+// limit returns the effective limit of outstanding tags.
+func (tp *TagPool) limit() int {
+	if tp.Limit <= 0 || tp.Limit > int(NOTAG) {
+		return int(NOTAG)
+	}
+	return tp.Limit
+}
+
+// Allocate returns an unused tag, or ErrNoFreeTags if the pool is exhausted.
+func (tp *TagPool) Allocate() (Tag, error) {
+	tp.mu.Lock()
+	defer tp.mu.Unlock()
+
+	if tp.used >= tp.limit() {
+		return NOTAG, ErrNoFreeTags
+	}
+	tp.used++
+
+	if l := len(tp.free); l > 0 {
+		t := tp.free[l-1]
+		tp.free = tp.free[:l-1]
+		return t, nil
+	}
+
+	// As every tag below next is either in use or in the free list, next
+	// cannot reach NOTAG while the limit holds.
+	t := tp.next
+	tp.next++
+	return t, nil
+}
+
+// Release returns a tag to the pool for reuse. Releasing NOTAG is a no-op.
+// Releasing a tag that is not allocated corrupts the pool.
+func (tp *TagPool) Release(t Tag) {
+	if t == NOTAG {
+		return
+	}
+
+	tp.mu.Lock()
+	defer tp.mu.Unlock()
+
+	tp.used--
+	tp.free = append(tp.free, t)
+}
+
+// FidPool hands out unique fids for file handles. Fids are allocated from a
+// counter, and recycled once released. NOFID is never handed out. FidPool is
+// thread safe, and may be shared between goroutines.
+type FidPool struct {
+	// Limit is the maximum number of outstanding fids. Zero, or a value larger
+	// than the fid space, allows every fid except NOFID to be used.
+	Limit int
+
+	mu   sync.Mutex
+	next Fid
+	used uint64
+	free []Fid
+}
+
+// limit returns the effective limit of outstanding fids.
+func (fp *FidPool) limit() uint64 {
+	if fp.Limit <= 0 || uint64(fp.Limit) > uint64(NOFID) {
+		return uint64(NOFID)
+	}
+	return uint64(fp.Limit)
+}
+
+// Allocate returns an unused fid, or ErrNoFreeFids if the pool is exhausted.
+func (fp *FidPool) Allocate() (Fid, error) {
+	fp.mu.Lock()
+	defer fp.mu.Unlock()
+
+	if fp.used >= fp.limit() {
+		return NOFID, ErrNoFreeFids
+	}
+	fp.used++
+
+	if l := len(fp.free); l > 0 {
+		f := fp.free[l-1]
+		fp.free = fp.free[:l-1]
+		return f, nil
+	}
+
+	f := fp.next
+	fp.next++
+	return f, nil
+}
+
+// Release returns a fid to the pool for reuse. Releasing NOFID is a no-op.
+// Releasing a fid that is not allocated corrupts the pool.
+func (fp *FidPool) Release(f Fid) {
+	if f == NOFID {
+		return
+	}
+
+	fp.mu.Lock()
+	defer fp.mu.Unlock()
+
+	fp.used--
+	fp.free = append(fp.free, f)
+}
+
+// Allocated returns the fids currently allocated from the pool, in ascending
+// order.
+func (fp *FidPool) Allocated() []Fid {
+	fp.mu.Lock()
+	defer fp.mu.Unlock()
+
+	free := make(map[Fid]bool, len(fp.free))
+	for _, f := range fp.free {
+		free[f] = true
+	}
+
+	fids := make([]Fid, 0, fp.used)
+	for f := Fid(0); f < fp.next; f++ {
+		if !free[f] {
+			fids = append(fids, f)
+		}
+	}
+	return fids
+}
+
+// Reset returns every fid to the pool, as when the fids of a session are
+// discarded by a new version negotiation. Fids allocated before Reset must not
+// be released afterwards.
+func (fp *FidPool) Reset() {
+	fp.mu.Lock()
+	defer fp.mu.Unlock()
+
+	fp.next = 0
+	fp.used = 0
+	fp.free = nil
+}
@@ -0,0 +1,182 @@
+package qp
+
+import (
+	"reflect"
+	"sync"
+	"testing"
+)
+
+func TestTagPoolExhaustion(t *testing.T) {
+	tp := TagPool{Limit: 16}
+
+	seen := make(map[Tag]bool)
+	for i := 0; i < 16; i++ {
+		tag, err := tp.Allocate()
+		if err != nil {
+			t.Fatalf("allocation %d failed: %v", i, err)
+		}
+		if tag == NOTAG {
+			t.Fatalf("allocation %d returned NOTAG", i)
+		}
+		if seen[tag] {
+			t.Fatalf("allocation %d returned duplicate tag %d", i, tag)
+		}
+		seen[tag] = true
+	}
+
+	if _, err := tp.Allocate(); err != ErrNoFreeTags {
+		t.Fatalf("expected %v, got %v", ErrNoFreeTags, err)
+	}
+
+	tp.Release(5)
+	tag, err := tp.Allocate()
+	if err != nil {
+		t.Fatalf("allocation after release failed: %v", err)
+	}
+	if tag != 5 {
+		t.Errorf("expected released tag 5 to be reused, got %d", tag)
+	}
+}
+
+func TestTagPoolFull(t *testing.T) {
+	var tp TagPool
+	for i := 0; i < int(NOTAG); i++ {
+		tag, err := tp.Allocate()
+		if err != nil {
+			t.Fatalf("allocation %d failed: %v", i, err)
+		}
+		if tag == NOTAG {
+			t.Fatalf("allocation %d returned NOTAG", i)
+		}
+	}
+	if _, err := tp.Allocate(); err != ErrNoFreeTags {
+		t.Fatalf("expected %v, got %v", ErrNoFreeTags, err)
+	}
+
+	// Releasing NOTAG must not free up a slot.
+	tp.Release(NOTAG)
+	if _, err := tp.Allocate(); err != ErrNoFreeTags {
+		t.Fatalf("expected %v after releasing NOTAG, got %v", ErrNoFreeTags, err)
+	}
+}
+
+func TestTagPoolConcurrent(t *testing.T) {
+	var (
+		tp TagPool
+		mu sync.Mutex
+		wg sync.WaitGroup
+	)
+	inuse := make(map[Tag]bool)
+
+	for g := 0; g < 8; g++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < 1000; i++ {
+				tag, err := tp.Allocate()
+				if err != nil {
+					t.Errorf("allocation failed: %v", err)
+					return
+				}
+				mu.Lock()
+				if inuse[tag] {
+					t.Errorf("tag %d handed out twice", tag)
+				}
+				inuse[tag] = true
+				mu.Unlock()
+
+				mu.Lock()
+				delete(inuse, tag)
+				mu.Unlock()
+				tp.Release(tag)
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+func TestFidPoolExhaustion(t *testing.T) {
+	fp := FidPool{Limit: 16}
+
+	seen := make(map[Fid]bool)
+	for i := 0; i < 16; i++ {
+		fid, err := fp.Allocate()
+		if err != nil {
+			t.Fatalf("allocation %d failed: %v", i, err)
+		}
+		if fid == NOFID {
+			t.Fatalf("allocation %d returned NOFID", i)
+		}
+		if seen[fid] {
+			t.Fatalf("allocation %d returned duplicate fid %d", i, fid)
+		}
+		seen[fid] = true
+	}
+
+	if _, err := fp.Allocate(); err != ErrNoFreeFids {
+		t.Fatalf("expected %v, got %v", ErrNoFreeFids, err)
+	}
+
+	// Releasing NOFID must not free up a slot.
+	fp.Release(NOFID)
+	if _, err := fp.Allocate(); err != ErrNoFreeFids {
+		t.Fatalf("expected %v after releasing NOFID, got %v", ErrNoFreeFids, err)
+	}
+}
+
+func TestFidPoolReuse(t *testing.T) {
+	fp := FidPool{Limit: 2}
+
+	a, _ := fp.Allocate()
+	b, _ := fp.Allocate()
+	fp.Release(a)
+
+	c, err := fp.Allocate()
+	if err != nil {
+		t.Fatalf("allocation after release failed: %v", err)
+	}
+	if c != a {
+		t.Errorf("expected released fid %d to be reused, got %d", a, c)
+	}
+
+	fp.Release(b)
+	fp.Release(c)
+	for i := 0; i < 2; i++ {
+		if _, err := fp.Allocate(); err != nil {
+			t.Fatalf("allocation %d after releasing all failed: %v", i, err)
+		}
+	}
+}
+
+func TestFidPoolReset(t *testing.T) {
+	var fp FidPool
+	for i := 0; i < 3; i++ {
+		fp.Allocate()
+	}
+	fp.Reset()
+
+	f, err := fp.Allocate()
+	if err != nil {
+		t.Fatalf("allocate after reset failed: %v", err)
+	}
+	if f != 0 {
+		t.Errorf("got fid %d after reset, expected 0", f)
+	}
+}
+
+func TestFidPoolAllocated(t *testing.T) {
+	var fp FidPool
+	for i := 0; i < 5; i++ {
+		fp.Allocate()
+	}
+	fp.Release(1)
+	fp.Release(3)
+
+	if got, expected := fp.Allocated(), []Fid{0, 2, 4}; !reflect.DeepEqual(got, expected) {
+		t.Errorf("got %v, expected %v", got, expected)
+	}
+	fp.Reset()
+	if got := fp.Allocated(); len(got) != 0 {
+		t.Errorf("got %v after reset, expected none", got)
+	}
+}
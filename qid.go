@@ -0,0 +1,48 @@
+package qp
+
+import "sync"
+
+// QidGen mints qids for server implementations. Each qid gets a path unique to
+// the generator, counting up from zero, and a version that can be bumped as
+// the file changes. The zero value is ready for use. QidGen is thread safe,
+// and may be shared between goroutines.
+type QidGen struct {
+	mu       sync.Mutex
+	next     uint64
+	versions map[uint64]uint32
+}
+
+// Next returns a qid with a new path and version zero, typed as a directory if
+// isDir is set, and as a plain file otherwise.
+func (g *QidGen) Next(isDir bool) Qid {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	q := Qid{Type: QTFILE, Path: g.next}
+	if isDir {
+		q.Type = QTDIR
+	}
+	g.next++
+	return q
+}
+
+// Version returns the current version of path, which is zero until bumped.
+func (g *QidGen) Version(path uint64) uint32 {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	return g.versions[path]
+}
+
+// Bump increments the version of path, as done when the file is modified, and
+// returns the new version. The version wraps around after the largest uint32.
+func (g *QidGen) Bump(path uint64) uint32 {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if g.versions == nil {
+		g.versions = make(map[uint64]uint32)
+	}
+	g.versions[path]++
+	return g.versions[path]
+}
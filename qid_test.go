@@ -0,0 +1,66 @@
+package qp
+
+import (
+	"sync"
+	"testing"
+)
+
+func TestQidGen(t *testing.T) {
+	var g QidGen
+	dir := g.Next(true)
+	file := g.Next(false)
+
+	if dir.Type != QTDIR || file.Type != QTFILE {
+		t.Errorf("got types %#x and %#x, expected %#x and %#x", dir.Type, file.Type, QTDIR, QTFILE)
+	}
+	if dir.Path == file.Path {
+		t.Errorf("directory and file share path %d", dir.Path)
+	}
+	if dir.Version != 0 || file.Version != 0 {
+		t.Errorf("got versions %d and %d, expected 0", dir.Version, file.Version)
+	}
+
+	if v := g.Bump(file.Path); v != 1 {
+		t.Errorf("bump: got version %d, expected 1", v)
+	}
+	g.Bump(file.Path)
+	if v := g.Version(file.Path); v != 2 {
+		t.Errorf("got version %d after two bumps, expected 2", v)
+	}
+	if v := g.Version(dir.Path); v != 0 {
+		t.Errorf("got version %d for untouched path, expected 0", v)
+	}
+}
+
+func TestQidGenConcurrent(t *testing.T) {
+	var (
+		g     QidGen
+		mu    sync.Mutex
+		paths = make(map[uint64]bool)
+		wg    sync.WaitGroup
+	)
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(isDir bool) {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				q := g.Next(isDir)
+				g.Bump(0)
+				mu.Lock()
+				if paths[q.Path] {
+					t.Errorf("path %d minted twice", q.Path)
+				}
+				paths[q.Path] = true
+				mu.Unlock()
+			}
+		}(i%2 == 0)
+	}
+	wg.Wait()
+
+	if len(paths) != 800 {
+		t.Errorf("got %d unique paths, expected 800", len(paths))
+	}
+	if v := g.Version(0); v != 800 {
+		t.Errorf("got version %d after 800 bumps, expected 800", v)
+	}
+}
@@ -0,0 +1,46 @@
+package qp
+
+import "encoding/binary"
+
+// ReadRawMessage is like ReadMessage, but also returns the framed bytes,
+// header included, that the message was decoded from, for forwarding messages
+// verbatim rather than re-encoding them. The bytes are a copy owned by the
+// caller, which costs an allocation the size of every message, so it is best
+// reserved for proxies. They are not updated if the message is modified.
+// Skipped messages are returned without their bytes, and StreamReads is not
+// applied, as the data of a streamed read response is not kept.
+func (d *Decoder) ReadRawMessage() (Message, []byte, error) {
+	d.keepRaw = true
+	defer func() { d.keepRaw, d.raw = false, nil }()
+
+	var m Message
+	var err error
+	if d.Greedy {
+		m, err = d.greedyRead(d.Reader)
+	} else if err = d.discardStream(); err == nil {
+		m, err = d.simpleRead(d.Reader, nil)
+	}
+	m, err = d.hook(m, err)
+	if err != nil {
+		return nil, nil, err
+	}
+	return m, d.raw, nil
+}
+
+// keep records a copy of the frame of m, with body b, if ReadRawMessage is in
+// progress.
+func (d *Decoder) keep(m Message, b []byte) {
+	if !d.keepRaw {
+		return
+	}
+	mt, err := d.Protocol.MessageType(m)
+	if err != nil {
+		return
+	}
+
+	raw := make([]byte, HeaderSize+len(b))
+	binary.LittleEndian.PutUint32(raw[0:4], uint32(len(raw)))
+	raw[4] = byte(mt)
+	copy(raw[HeaderSize:], b)
+	d.raw = raw
+}
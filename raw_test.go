@@ -0,0 +1,60 @@
+package qp
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestDecoderReadRawMessage(t *testing.T) {
+	var frames [][]byte
+	for _, m := range []Message{
+		&WalkRequest{Tag: 1, Fid: 2, NewFid: 3, Names: []string{"a", "b"}},
+		&ReadResponse{Tag: 4, Data: []byte("hello")},
+		&ClunkResponse{Tag: 5},
+	} {
+		var buf bytes.Buffer
+		if err := NewEncoder(NineP2000, &buf).WriteMessage(m); err != nil {
+			t.Fatalf("write failed: %v", err)
+		}
+		frames = append(frames, buf.Bytes())
+	}
+	// Trailing data is ignored when decoding, but must still be forwarded.
+	trailing := append([]byte{}, frames[2]...)
+	trailing[0]++
+	trailing = append(trailing, 0xFF)
+	frames = append(frames, trailing)
+	stream := bytes.Join(frames, nil)
+
+	for _, greedy := range []bool{false, true} {
+		d := NewDecoder(NineP2000, bytes.NewReader(stream))
+		d.MessageSize = 8192
+		d.Greedy = greedy
+
+		for i, frame := range frames {
+			m, raw, err := d.ReadRawMessage()
+			if err != nil {
+				t.Fatalf("greedy %v: read %d failed: %v", greedy, i, err)
+			}
+			if !bytes.Equal(raw, frame) {
+				t.Errorf("greedy %v: message %d: got raw bytes %x, expected %x", greedy, i, raw, frame)
+			}
+			if m == nil {
+				t.Errorf("greedy %v: message %d: got no message", greedy, i)
+			}
+		}
+	}
+
+	// The kept frame is not returned for a skipped message.
+	d := NewDecoder(NineP2000, bytes.NewReader(stream))
+	d.Skip = func(mt MessageType) bool { return mt == Twalk }
+	m, raw, err := d.ReadRawMessage()
+	if err != nil {
+		t.Fatalf("read failed: %v", err)
+	}
+	if _, ok := m.(*RawMessage); !ok || raw != nil {
+		t.Errorf("skipped message: got %v with raw bytes %x, expected a RawMessage without", m, raw)
+	}
+	if _, raw, _ := d.ReadRawMessage(); !bytes.Equal(raw, frames[1]) {
+		t.Errorf("after skipped message: got raw bytes %x, expected %x", raw, frames[1])
+	}
+}
@@ -0,0 +1,40 @@
+package qp
+
+import "io"
+
+// Recorder returns an Encoder writing messages of protocol p to w, while also
+// copying the exact bytes of every message, header included, to sink. A
+// recorded session can later be decoded with Replay. The message is written to
+// w before sink, and a failure of either is returned by WriteMessage.
+func Recorder(p Protocol, w, sink io.Writer) *Encoder {
+	return NewEncoder(p, io.MultiWriter(w, sink))
+}
+
+// Replay decodes the messages of protocol p recorded in src, sending them on
+// the returned message channel, which is closed when src is exhausted or
+// decoding fails. In the latter case, the error is sent on the error channel
+// first. The error channel is closed once decoding stops, without sending
+// anything if src ended at a message boundary. The message channel must be
+// drained for decoding to finish.
+func Replay(src io.Reader, p Protocol) (<-chan Message, <-chan error) {
+	msgs := make(chan Message)
+	errs := make(chan error, 1)
+	go func() {
+		defer close(errs)
+		defer close(msgs)
+
+		d := NewDecoder(p, src)
+		for {
+			m, err := d.ReadMessage()
+			if err == io.EOF {
+				return
+			}
+			if err != nil {
+				errs <- err
+				return
+			}
+			msgs <- m
+		}
+	}()
+	return msgs, errs
+}
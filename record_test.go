@@ -0,0 +1,59 @@
+package qp
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+)
+
+func TestRecorder(t *testing.T) {
+	var conn, sink, expected bytes.Buffer
+	e := Recorder(NineP2000, &conn, &sink)
+	for _, tt := range MessageTestData {
+		if err := e.WriteMessage(tt.input); err != nil {
+			t.Fatalf("write failed: %v", err)
+		}
+		expected.Write(tt.container)
+	}
+	if !bytes.Equal(conn.Bytes(), expected.Bytes()) {
+		t.Errorf("connection got\n\t%x\nexpected\n\t%x", conn.Bytes(), expected.Bytes())
+	}
+	if !bytes.Equal(sink.Bytes(), expected.Bytes()) {
+		t.Errorf("recording got\n\t%x\nexpected\n\t%x", sink.Bytes(), expected.Bytes())
+	}
+
+	msgs, errs := Replay(&sink, NineP2000)
+	i := 0
+	for m := range msgs {
+		if i >= len(MessageTestData) {
+			t.Fatalf("replayed more than %d messages", len(MessageTestData))
+		}
+		if !MessagesEqual(m, MessageTestData[i].input) {
+			t.Errorf("message %d: got %v, expected %v", i, m, MessageTestData[i].input)
+		}
+		i++
+	}
+	if i != len(MessageTestData) {
+		t.Errorf("replayed %d messages, expected %d", i, len(MessageTestData))
+	}
+	if err := <-errs; err != nil {
+		t.Errorf("replay failed: %v", err)
+	}
+}
+
+func TestReplayTruncated(t *testing.T) {
+	rec := MessageTestData[0].container
+	rec = append(append([]byte{}, rec...), MessageTestData[1].container[:HeaderSize+1]...)
+
+	msgs, errs := Replay(bytes.NewReader(rec), NineP2000)
+	n := 0
+	for range msgs {
+		n++
+	}
+	if n != 1 {
+		t.Errorf("replayed %d messages, expected 1", n)
+	}
+	if err := <-errs; !errors.Is(err, ErrPayloadTooShort) {
+		t.Errorf("expected %v, got %v", ErrPayloadTooShort, err)
+	}
+}
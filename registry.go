@@ -0,0 +1,101 @@
+package qp
+
+import (
+	"reflect"
+	"sync"
+)
+
+// Registry is a Protocol built from registered message types, for adding
+// custom messages without implementing Protocol by hand. Message types that
+// are not registered are delegated to the base protocol, if any. Registry is
+// thread safe, but registering while messages are being encoded or decoded
+// makes it unpredictable which of them see the new type.
+type Registry struct {
+	base Protocol
+
+	mu        sync.RWMutex
+	factories map[MessageType]registration
+	types     map[reflect.Type]MessageType
+}
+
+// registration is a registered message type, with the concrete type returned
+// by its factory.
+type registration struct {
+	factory func() Message
+	typ     reflect.Type
+}
+
+// NewRegistry returns an empty Registry extending base, which may be nil.
+func NewRegistry(base Protocol) *Registry {
+	return &Registry{
+		base:      base,
+		factories: make(map[MessageType]registration),
+		types:     make(map[reflect.Type]MessageType),
+	}
+}
+
+// Extend returns a Registry extending base with the message types of extra,
+// for experimenting with a variant of an existing protocol. See Register.
+func Extend(base Protocol, extra map[MessageType]func() Message) *Registry {
+	r := NewRegistry(base)
+	for mt, factory := range extra {
+		r.Register(mt, factory)
+	}
+	return r
+}
+
+// Register registers message type mt, with factory returning a new, empty
+// message of the type. The concrete type returned by factory is encoded as
+// mt. Registering a type that is already registered, or known by the base
+// protocol, replaces it. Registering a concrete type that is already
+// registered as another message type moves it, leaving the other message type
+// to the base protocol. Messages whose Unmarshal keeps a slice of its input
+// must not be decoded by a Decoder with PoolBuffers set.
+func (r *Registry) Register(mt MessageType, factory func() Message) {
+	t := reflect.TypeOf(factory())
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	// Drop the mappings being replaced, so that every registered type is
+	// encoded as the message type it decodes from.
+	if old, ok := r.factories[mt]; ok {
+		delete(r.types, old.typ)
+	}
+	if old, ok := r.types[t]; ok {
+		delete(r.factories, old)
+	}
+
+	r.factories[mt] = registration{factory: factory, typ: t}
+	r.types[t] = mt
+}
+
+// Message returns an empty Message based on the provided message type.
+func (r *Registry) Message(mt MessageType) (Message, error) {
+	r.mu.RLock()
+	reg, ok := r.factories[mt]
+	r.mu.RUnlock()
+
+	switch {
+	case ok:
+		return reg.factory(), nil
+	case r.base != nil:
+		return r.base.Message(mt)
+	}
+	return nil, ErrUnknownMessageType
+}
+
+// MessageType returns the message type of a given message.
+func (r *Registry) MessageType(m Message) (MessageType, error) {
+	r.mu.RLock()
+	mt, ok := r.types[reflect.TypeOf(m)]
+	r.mu.RUnlock()
+
+	switch {
+	case ok:
+		return mt, nil
+	case r.base != nil:
+		return r.base.MessageType(m)
+	}
+	return 0, ErrUnknownMessageType
+}
@@ -0,0 +1,192 @@
+package qp
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+)
+
+// Test if the types live up to their interface
+var (
+	_ Protocol = (*Registry)(nil)
+	_ Message  = (*pingMessage)(nil)
+)
+
+// pingMessage is a custom message carrying a sequence number.
+type pingMessage struct {
+	Tag
+
+	Seq uint32
+}
+
+func (pm *pingMessage) EncodedSize() int { return 2 + 4 }
+
+func (pm *pingMessage) Marshal(b []byte) error {
+	binary.LittleEndian.PutUint16(b[0:2], uint16(pm.Tag))
+	binary.LittleEndian.PutUint32(b[2:6], pm.Seq)
+	return nil
+}
+
+func (pm *pingMessage) Unmarshal(b []byte) error {
+	if len(b) < 2+4 {
+		return ErrPayloadTooShort
+	}
+	pm.Tag = Tag(binary.LittleEndian.Uint16(b[0:2]))
+	pm.Seq = binary.LittleEndian.Uint32(b[2:6])
+	return nil
+}
+
+// aliasMessage is a custom message keeping a slice of its encoded body.
+type aliasMessage struct {
+	Tag
+
+	Data []byte
+}
+
+func (am *aliasMessage) EncodedSize() int { return 2 + len(am.Data) }
+
+func (am *aliasMessage) Marshal(b []byte) error {
+	binary.LittleEndian.PutUint16(b[0:2], uint16(am.Tag))
+	copy(b[2:], am.Data)
+	return nil
+}
+
+func (am *aliasMessage) Unmarshal(b []byte) error {
+	if len(b) < 2 {
+		return ErrPayloadTooShort
+	}
+	am.Tag = Tag(binary.LittleEndian.Uint16(b[0:2]))
+	am.Data = b[2:]
+	return nil
+}
+
+func TestRegistryAliasingMessage(t *testing.T) {
+	const Talias MessageType = 202
+
+	r := NewRegistry(NineP2000)
+	r.Register(Talias, func() Message { return &aliasMessage{} })
+
+	buf := new(bytes.Buffer)
+	e := NewEncoder(r, buf)
+	for i, data := range []string{"first", "other"} {
+		if err := e.WriteMessage(&aliasMessage{Tag: Tag(i), Data: []byte(data)}); err != nil {
+			t.Fatalf("write failed: %v", err)
+		}
+	}
+
+	// Without PoolBuffers, every message gets a body of its own.
+	d := NewDecoder(r, buf)
+	first, err := d.ReadMessage()
+	if err != nil {
+		t.Fatalf("read failed: %v", err)
+	}
+	if _, err := d.ReadMessage(); err != nil {
+		t.Fatalf("read failed: %v", err)
+	}
+	if data := string(first.(*aliasMessage).Data); data != "first" {
+		t.Errorf("first message corrupted by the next read: got %q, expected %q", data, "first")
+	}
+}
+
+func TestRegistry(t *testing.T) {
+	const Tping MessageType = 200
+
+	r := NewRegistry(NineP2000)
+	r.Register(Tping, func() Message { return &pingMessage{} })
+
+	buf := new(bytes.Buffer)
+	e := NewEncoder(r, buf)
+	if err := e.WriteMessage(&pingMessage{Tag: 1, Seq: 42}); err != nil {
+		t.Fatalf("write of custom message failed: %v", err)
+	}
+	if err := e.WriteMessage(&ClunkRequest{Tag: 2, Fid: 3}); err != nil {
+		t.Fatalf("write of base message failed: %v", err)
+	}
+	if buf.Bytes()[4] != byte(Tping) {
+		t.Errorf("custom message encoded as type %d, expected %d", buf.Bytes()[4], Tping)
+	}
+
+	d := NewDecoder(r, buf)
+	m, err := d.ReadMessage()
+	if err != nil {
+		t.Fatalf("read of custom message failed: %v", err)
+	}
+	if pm, ok := m.(*pingMessage); !ok || pm.Tag != 1 || pm.Seq != 42 {
+		t.Errorf("got %#v, expected ping with tag 1 and seq 42", m)
+	}
+	m, err = d.ReadMessage()
+	if err != nil {
+		t.Fatalf("read of base message failed: %v", err)
+	}
+	if cr, ok := m.(*ClunkRequest); !ok || cr.Tag != 2 || cr.Fid != 3 {
+		t.Errorf("got %#v, expected clunk of fid 3 with tag 2", m)
+	}
+
+	// Without a base protocol, only registered types are known.
+	r = NewRegistry(nil)
+	if _, err := r.Message(Tclunk); err != ErrUnknownMessageType {
+		t.Errorf("expected %v, got %v", ErrUnknownMessageType, err)
+	}
+	if _, err := r.MessageType(&ClunkRequest{}); err != ErrUnknownMessageType {
+		t.Errorf("expected %v, got %v", ErrUnknownMessageType, err)
+	}
+}
+
+func TestRegistryReplace(t *testing.T) {
+	const (
+		Tping  MessageType = 200
+		Tping2 MessageType = 204
+	)
+
+	// A new type for a registered message type replaces the old type in
+	// both directions.
+	r := NewRegistry(NineP2000)
+	r.Register(Tping, func() Message { return &pingMessage{} })
+	r.Register(Tping, func() Message { return &aliasMessage{} })
+	if _, err := r.MessageType(&pingMessage{}); err != ErrUnknownMessageType {
+		t.Errorf("replaced type: expected %v, got %v", ErrUnknownMessageType, err)
+	}
+	if mt, err := r.MessageType(&aliasMessage{}); err != nil || mt != Tping {
+		t.Errorf("new type: got type %d (%v), expected %d", mt, err, Tping)
+	}
+	if m, err := r.Message(Tping); err != nil {
+		t.Errorf("message type: %v", err)
+	} else if _, ok := m.(*aliasMessage); !ok {
+		t.Errorf("message type decodes as %T, expected *aliasMessage", m)
+	}
+
+	// A registered type moved to a new message type leaves the old one.
+	r = NewRegistry(NineP2000)
+	r.Register(Tping, func() Message { return &pingMessage{} })
+	r.Register(Tping2, func() Message { return &pingMessage{} })
+	if mt, err := r.MessageType(&pingMessage{}); err != nil || mt != Tping2 {
+		t.Errorf("moved type: got type %d (%v), expected %d", mt, err, Tping2)
+	}
+	if _, err := r.Message(Tping); err != ErrUnknownMessageType {
+		t.Errorf("old message type: expected %v, got %v", ErrUnknownMessageType, err)
+	}
+	if _, err := r.Message(Tping2); err != nil {
+		t.Errorf("new message type: %v", err)
+	}
+}
+
+func TestExtend(t *testing.T) {
+	const Tping MessageType = 200
+
+	p := Extend(NineP2000, map[MessageType]func() Message{
+		Tping: func() Message { return &pingMessage{} },
+	})
+
+	if mt, err := p.MessageType(&pingMessage{}); err != nil || mt != Tping {
+		t.Errorf("custom message: got type %d (%v), expected %d", mt, err, Tping)
+	}
+	if _, err := p.Message(Tping); err != nil {
+		t.Errorf("custom message type: %v", err)
+	}
+	if mt, err := p.MessageType(&ClunkRequest{}); err != nil || mt != Tclunk {
+		t.Errorf("base message: got type %d (%v), expected %d", mt, err, Tclunk)
+	}
+	if _, err := NineP2000.Message(Tping); err != ErrUnknownMessageType {
+		t.Errorf("base protocol modified: expected %v, got %v", ErrUnknownMessageType, err)
+	}
+}
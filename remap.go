@@ -0,0 +1,35 @@
+package qp
+
+import "reflect"
+
+// fidType is the type of fid fields.
+var fidType = reflect.TypeOf(Fid(0))
+
+// RemapTag sets the tag of m to t.
+func RemapTag(m Message, t Tag) {
+	m.SetTag(t)
+}
+
+// RemapFid replaces every fid field of m holding old with new, such as fid,
+// newfid, afid and dfid, and reports whether any field was changed. m must be
+// a pointer to a message struct.
+func RemapFid(m Message, old, new Fid) bool {
+	v := reflect.ValueOf(m)
+	if v.Kind() != reflect.Ptr || v.Elem().Kind() != reflect.Struct {
+		return false
+	}
+	v = v.Elem()
+
+	var changed bool
+	for i := 0; i < v.NumField(); i++ {
+		f := v.Field(i)
+		if f.Type() != fidType || !f.CanSet() {
+			continue
+		}
+		if Fid(f.Uint()) == old {
+			f.SetUint(uint64(new))
+			changed = true
+		}
+	}
+	return changed
+}
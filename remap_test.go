@@ -0,0 +1,98 @@
+package qp
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+// remapFids lists the fid fields of every message type carrying fids. Types
+// not listed carry none.
+var remapFids = map[string][]string{
+	"*qp.AuthRequest":            {"AuthFid"},
+	"*qp.AuthRequestDotu":        {"AuthFid"},
+	"*qp.AttachRequest":          {"Fid", "AuthFid"},
+	"*qp.AttachRequestDotu":      {"Fid", "AuthFid"},
+	"*qp.WalkRequest":            {"Fid", "NewFid"},
+	"*qp.OpenRequest":            {"Fid"},
+	"*qp.OpenRequestDotl":        {"Fid"},
+	"*qp.CreateRequest":          {"Fid"},
+	"*qp.CreateRequestDotu":      {"Fid"},
+	"*qp.CreateRequestDotl":      {"Fid"},
+	"*qp.ReadRequest":            {"Fid"},
+	"*qp.WriteRequest":           {"Fid"},
+	"*qp.ClunkRequest":           {"Fid"},
+	"*qp.RemoveRequest":          {"Fid"},
+	"*qp.StatRequest":            {"Fid"},
+	"*qp.WriteStatRequest":       {"Fid"},
+	"*qp.WriteStatRequestDotu":   {"Fid"},
+	"*qp.SimpleReadRequestDote":  {"Fid"},
+	"*qp.SimpleWriteRequestDote": {"Fid"},
+	"*qp.StatfsRequestDotl":      {"Fid"},
+	"*qp.GetAttrRequestDotl":     {"Fid"},
+	"*qp.SetAttrRequestDotl":     {"Fid"},
+	"*qp.ReadDirRequestDotl":     {"Fid"},
+	"*qp.ReadLinkRequestDotl":    {"Fid"},
+	"*qp.MkdirRequestDotl":       {"DirectoryFid"},
+	"*qp.RenameRequestDotl":      {"Fid", "DirectoryFid"},
+}
+
+func TestRemapTag(t *testing.T) {
+	for _, table := range roundTripTables {
+		for i, tt := range table.data {
+			c := CloneMessage(tt.input)
+			RemapTag(c, 0x1234)
+			if c.GetTag() != 0x1234 {
+				t.Errorf("%s: test %d: %T has tag %d after remap, expected %d", table.name, i, c, c.GetTag(), 0x1234)
+			}
+		}
+	}
+}
+
+func TestRemapFid(t *testing.T) {
+	const old, new Fid = 1000, 2000
+
+	for _, table := range roundTripTables {
+		for i, tt := range table.data {
+			name := fmt.Sprintf("%T", tt.input)
+			fields := remapFids[name]
+
+			c := CloneMessage(tt.input)
+			v := reflect.ValueOf(c).Elem()
+			for _, f := range fields {
+				v.FieldByName(f).SetUint(uint64(old + 1))
+			}
+			if RemapFid(c, old, new) {
+				t.Errorf("%s: test %d: %s without fid %d reported a change", table.name, i, name, old)
+			}
+
+			var n int
+			for j := 0; j < v.NumField(); j++ {
+				if v.Field(j).Type() == fidType {
+					n++
+				}
+			}
+			if n != len(fields) {
+				t.Errorf("%s: test %d: %s has %d fid fields, but %d are listed", table.name, i, name, n, len(fields))
+			}
+
+			// Each fid field is remapped on its own.
+			for _, f := range fields {
+				v.FieldByName(f).SetUint(uint64(old))
+				if !RemapFid(c, old, new) {
+					t.Errorf("%s: test %d: remap of %s.%s reported no change", table.name, i, name, f)
+				}
+				for _, g := range fields {
+					expected := old + 1
+					if g == f {
+						expected = new
+					}
+					if got := Fid(v.FieldByName(g).Uint()); got != expected {
+						t.Errorf("%s: test %d: remap of %s.%s left %s as %d, expected %d", table.name, i, name, f, g, got, expected)
+					}
+				}
+				v.FieldByName(f).SetUint(uint64(old + 1))
+			}
+		}
+	}
+}
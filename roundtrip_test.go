@@ -0,0 +1,117 @@
+package qp
+
+import (
+	"bytes"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// roundTripTables holds the message tables of each protocol. Every message
+// type a protocol knows must have an entry in one of the tables.
+var roundTripTables = []struct {
+	name string
+	p    Protocol
+	data []MessageTestEntry
+}{
+	{"9P2000", NineP2000, MessageTestData},
+	{"9P2000.u", NineP2000Dotu, MessageTestDataDotu},
+	{"9P2000.e", NineP2000Dote, MessageTestDataDote},
+	{"9P2000.L", NineP2000Dotl, MessageTestDataDotl},
+}
+
+func TestRoundTrip(t *testing.T) {
+	for _, table := range roundTripTables {
+		for i, tt := range table.data {
+			buf := new(bytes.Buffer)
+			if err := NewEncoder(table.p, buf).WriteMessage(tt.input); err != nil {
+				t.Errorf("%s: test %d: encode of %T failed: %v", table.name, i, tt.input, err)
+				continue
+			}
+
+			d := NewDecoder(table.p, buf)
+			d.Strict = true
+			m, err := d.ReadMessage()
+			if err != nil {
+				t.Errorf("%s: test %d: decode of %T failed: %v", table.name, i, tt.input, err)
+				continue
+			}
+			if !MessagesEqual(tt.input, m) {
+				t.Errorf("%s: test %d: round trip of %T changed the message.\n\tExpected: %#v\n\tGot:      %#v", table.name, i, tt.input, tt.input, m)
+			}
+		}
+	}
+}
+
+func TestRoundTripCoverage(t *testing.T) {
+	// Protocols share message types with the protocols they extend, so an
+	// entry in any table covers the type.
+	covered := make(map[reflect.Type]bool)
+	for _, table := range roundTripTables {
+		for _, tt := range table.data {
+			covered[reflect.TypeOf(tt.input)] = true
+		}
+	}
+
+	for _, table := range roundTripTables {
+		for mt := 0; mt < 256; mt++ {
+			m, err := table.p.Message(MessageType(mt))
+			if err != nil {
+				continue
+			}
+			if !covered[reflect.TypeOf(m)] {
+				t.Errorf("%s: no round trip entry for %v (%T)", table.name, MessageType(mt), m)
+			}
+		}
+	}
+}
+
+func TestUnknownMessageTypes(t *testing.T) {
+	// Rerror has no request counterpart, so the type byte before it must not
+	// decode to anything.
+	frame := []byte{7, 0, 0, 0, byte(Terror), 0xFF, 0xFF}
+
+	for _, table := range roundTripTables {
+		if m, err := table.p.Message(Terror); m != nil || err != ErrUnknownMessageType {
+			t.Errorf("%s: Terror: got %v, %v, expected nil, %v", table.name, m, err, ErrUnknownMessageType)
+		}
+		if _, err := NewDecoder(table.p, bytes.NewReader(frame)).ReadMessage(); !errors.Is(err, ErrUnknownMessageType) {
+			t.Errorf("%s: decoding Terror: expected %v, got %v", table.name, ErrUnknownMessageType, err)
+		}
+
+		for mt := 0; mt < 256; mt++ {
+			m, err := table.p.Message(MessageType(mt))
+			if (m == nil) != (err != nil) || err != nil && err != ErrUnknownMessageType {
+				t.Errorf("%s: %v: got %v, %v", table.name, MessageType(mt), m, err)
+			}
+		}
+	}
+
+	for _, mt := range []MessageType{0, Tversion - 1, Rwstat + 1, 255} {
+		if _, err := NineP2000.Message(mt); err != ErrUnknownMessageType {
+			t.Errorf("9P2000: %v: expected %v, got %v", mt, ErrUnknownMessageType, err)
+		}
+	}
+}
+
+func TestMessageTypeIsValid(t *testing.T) {
+	for i := 0; i < 256; i++ {
+		mt := MessageType(i)
+
+		decodes := false
+		for _, table := range roundTripTables {
+			if _, err := table.p.Message(mt); err == nil {
+				decodes = true
+			}
+		}
+		if mt.IsValid() != decodes {
+			t.Errorf("%v: IsValid is %v, but decoding by any protocol is %v", mt, mt.IsValid(), decodes)
+		}
+
+		request := decodes && strings.HasPrefix(mt.String(), "T")
+		if mt.IsRequest() != request {
+			t.Errorf("%v: IsRequest is %v, expected %v", mt, mt.IsRequest(), request)
+		}
+	}
+}
@@ -0,0 +1,165 @@
+package qp
+
+import (
+	"errors"
+	"fmt"
+	"io"
+)
+
+// Handler handles the requests of a Server. Each method is called with a
+// request, and returns the response to be sent, or an error, which is sent to
+// the client as an ErrorResponse. The server sets the tag of the response, so
+// handlers need not do so.
+type Handler interface {
+	Version(*VersionRequest) (*VersionResponse, error)
+	Auth(*AuthRequest) (*AuthResponse, error)
+	Attach(*AttachRequest) (*AttachResponse, error)
+	Flush(*FlushRequest) (*FlushResponse, error)
+	Walk(*WalkRequest) (*WalkResponse, error)
+	Open(*OpenRequest) (*OpenResponse, error)
+	Create(*CreateRequest) (*CreateResponse, error)
+	Read(*ReadRequest) (*ReadResponse, error)
+	Write(*WriteRequest) (*WriteResponse, error)
+	Clunk(*ClunkRequest) (*ClunkResponse, error)
+	Remove(*RemoveRequest) (*RemoveResponse, error)
+	Stat(*StatRequest) (*StatResponse, error)
+	WriteStat(*WriteStatRequest) (*WriteStatResponse, error)
+}
+
+// Server reads requests from a connection, dispatches them to a Handler, and
+// writes the responses back. Requests are handled sequentially in the order
+// they are read.
+type Server struct {
+	// Protocol is the protocol codec used for decoding requests and encoding
+	// responses.
+	Protocol Protocol
+
+	// Handler handles the decoded requests.
+	Handler Handler
+}
+
+// errNoResponse is returned to the client when a handler returns neither a
+// response nor an error.
+var errNoResponse = errors.New("no response")
+
+// Serve serves requests read from rw until the reader is exhausted or an error
+// occurs. It returns nil when the client disconnects at a message boundary.
+func (s *Server) Serve(rw io.ReadWriter) error {
+	return s.ServeConn(struct {
+		MessageReader
+		MessageWriter
+	}{NewDecoder(s.Protocol, rw), NewEncoder(s.Protocol, rw)})
+}
+
+// ServeConn is like Serve, but reads and writes messages through rw, such as
+// a Conn or a Trace wrapper. The Protocol of the server is not used.
+func (s *Server) ServeConn(rw MessageReadWriter) error {
+	for {
+		m, err := rw.ReadMessage()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		if err := rw.WriteMessage(s.dispatch(m)); err != nil {
+			return err
+		}
+	}
+}
+
+// dispatch calls the handler method for the request, and returns the response
+// with the tag of the request. Requests failing ValidateMessage are answered
+// with an error without reaching the handler.
+func (s *Server) dispatch(m Message) Message {
+	if err := ValidateMessage(m); err != nil {
+		return NewErrorResponse(m.GetTag(), err)
+	}
+
+	var (
+		resp Message
+		err  error
+	)
+
+	// A nil response pointer must not end up in resp, as it would not compare
+	// equal to nil, hence the explicit checks.
+	h := s.Handler
+	switch req := m.(type) {
+	case *VersionRequest:
+		var r *VersionResponse
+		if r, err = h.Version(req); r != nil {
+			r.Tag, resp = req.Tag, r
+		}
+	case *AuthRequest:
+		var r *AuthResponse
+		if r, err = h.Auth(req); r != nil {
+			r.Tag, resp = req.Tag, r
+		}
+	case *AttachRequest:
+		var r *AttachResponse
+		if r, err = h.Attach(req); r != nil {
+			r.Tag, resp = req.Tag, r
+		}
+	case *FlushRequest:
+		var r *FlushResponse
+		if r, err = h.Flush(req); r != nil {
+			r.Tag, resp = req.Tag, r
+		}
+	case *WalkRequest:
+		var r *WalkResponse
+		if r, err = h.Walk(req); r != nil {
+			r.Tag, resp = req.Tag, r
+		}
+	case *OpenRequest:
+		var r *OpenResponse
+		if r, err = h.Open(req); r != nil {
+			r.Tag, resp = req.Tag, r
+		}
+	case *CreateRequest:
+		var r *CreateResponse
+		if r, err = h.Create(req); r != nil {
+			r.Tag, resp = req.Tag, r
+		}
+	case *ReadRequest:
+		var r *ReadResponse
+		if r, err = h.Read(req); r != nil {
+			r.Tag, resp = req.Tag, r
+		}
+	case *WriteRequest:
+		var r *WriteResponse
+		if r, err = h.Write(req); r != nil {
+			r.Tag, resp = req.Tag, r
+		}
+	case *ClunkRequest:
+		var r *ClunkResponse
+		if r, err = h.Clunk(req); r != nil {
+			r.Tag, resp = req.Tag, r
+		}
+	case *RemoveRequest:
+		var r *RemoveResponse
+		if r, err = h.Remove(req); r != nil {
+			r.Tag, resp = req.Tag, r
+		}
+	case *StatRequest:
+		var r *StatResponse
+		if r, err = h.Stat(req); r != nil {
+			r.Tag, resp = req.Tag, r
+		}
+	case *WriteStatRequest:
+		var r *WriteStatResponse
+		if r, err = h.WriteStat(req); r != nil {
+			r.Tag, resp = req.Tag, r
+		}
+	default:
+		err = fmt.Errorf("unsupported request %T", m)
+	}
+
+	if err == nil && resp == nil {
+		err = errNoResponse
+	}
+	if err != nil {
+		return NewErrorResponse(m.GetTag(), err)
+	}
+	return resp
+}
@@ -0,0 +1,227 @@
+package qp
+
+import (
+	"errors"
+	"net"
+	"testing"
+	"time"
+)
+
+// memFS is a tiny in-memory file server with a root directory holding flat
+// files.
+type memFS struct {
+	files map[string][]byte
+	fids  map[Fid]string
+}
+
+var errNotFound = errors.New("file not found")
+
+func (fs *memFS) qid(name string) Qid {
+	if name == "" {
+		return Qid{Type: QTDIR, Path: 0}
+	}
+	var path uint64
+	for _, c := range name {
+		path = path*31 + uint64(c)
+	}
+	return Qid{Type: QTFILE, Path: path}
+}
+
+func (fs *memFS) Version(r *VersionRequest) (*VersionResponse, error) {
+	return &VersionResponse{MessageSize: r.MessageSize, Version: Version}, nil
+}
+
+func (fs *memFS) Auth(r *AuthRequest) (*AuthResponse, error) {
+	return nil, errors.New("authentication not required")
+}
+
+func (fs *memFS) Attach(r *AttachRequest) (*AttachResponse, error) {
+	fs.fids[r.Fid] = ""
+	return &AttachResponse{Qid: fs.qid("")}, nil
+}
+
+func (fs *memFS) Flush(r *FlushRequest) (*FlushResponse, error) {
+	return &FlushResponse{}, nil
+}
+
+func (fs *memFS) Walk(r *WalkRequest) (*WalkResponse, error) {
+	name, ok := fs.fids[r.Fid]
+	if !ok {
+		return nil, errors.New("unknown fid")
+	}
+	var qids []Qid
+	for _, n := range r.Names {
+		if name != "" {
+			break
+		}
+		if _, ok := fs.files[n]; !ok {
+			break
+		}
+		name = n
+		qids = append(qids, fs.qid(name))
+	}
+	if len(r.Names) > 0 && len(qids) == 0 {
+		return nil, errNotFound
+	}
+	if len(qids) == len(r.Names) {
+		fs.fids[r.NewFid] = name
+	}
+	return &WalkResponse{Qids: qids}, nil
+}
+
+func (fs *memFS) Open(r *OpenRequest) (*OpenResponse, error) {
+	name, ok := fs.fids[r.Fid]
+	if !ok {
+		return nil, errors.New("unknown fid")
+	}
+	return &OpenResponse{Qid: fs.qid(name)}, nil
+}
+
+func (fs *memFS) Create(r *CreateRequest) (*CreateResponse, error) {
+	if name := fs.fids[r.Fid]; name != "" {
+		return nil, errors.New("not a directory")
+	}
+	fs.files[r.Name] = nil
+	fs.fids[r.Fid] = r.Name
+	return &CreateResponse{Qid: fs.qid(r.Name)}, nil
+}
+
+func (fs *memFS) Read(r *ReadRequest) (*ReadResponse, error) {
+	data := fs.files[fs.fids[r.Fid]]
+	if r.Offset >= uint64(len(data)) {
+		return &ReadResponse{}, nil
+	}
+	data = data[r.Offset:]
+	if uint64(len(data)) > uint64(r.Count) {
+		data = data[:r.Count]
+	}
+	return &ReadResponse{Data: data}, nil
+}
+
+func (fs *memFS) Write(r *WriteRequest) (*WriteResponse, error) {
+	name := fs.fids[r.Fid]
+	data := fs.files[name]
+	for uint64(len(data)) < r.Offset+uint64(len(r.Data)) {
+		data = append(data, 0)
+	}
+	copy(data[r.Offset:], r.Data)
+	fs.files[name] = data
+	return &WriteResponse{Count: uint32(len(r.Data))}, nil
+}
+
+func (fs *memFS) Clunk(r *ClunkRequest) (*ClunkResponse, error) {
+	delete(fs.fids, r.Fid)
+	return &ClunkResponse{}, nil
+}
+
+func (fs *memFS) Remove(r *RemoveRequest) (*RemoveResponse, error) {
+	delete(fs.files, fs.fids[r.Fid])
+	delete(fs.fids, r.Fid)
+	return &RemoveResponse{}, nil
+}
+
+func (fs *memFS) Stat(r *StatRequest) (*StatResponse, error) {
+	name := fs.fids[r.Fid]
+	return &StatResponse{Stat: Stat{
+		Qid:    fs.qid(name),
+		Name:   name,
+		Length: uint64(len(fs.files[name])),
+	}}, nil
+}
+
+func (fs *memFS) WriteStat(r *WriteStatRequest) (*WriteStatResponse, error) {
+	return nil, errors.New("permission denied")
+}
+
+func TestServer(t *testing.T) {
+	fs := &memFS{
+		files: map[string][]byte{"hello": []byte("hello, world")},
+		fids:  make(map[Fid]string),
+	}
+	s := &Server{Protocol: NineP2000, Handler: fs}
+
+	cc, sc := net.Pipe()
+	errch := make(chan error, 1)
+	go func() {
+		errch <- s.Serve(sc)
+	}()
+
+	c := NewClient(cc, NineP2000)
+
+	if _, _, err := c.Version(8192, Version); err != nil {
+		t.Fatalf("version failed: %v", err)
+	}
+	root, _, err := c.Attach(NOFID, "glenda", "")
+	if err != nil {
+		t.Fatalf("attach failed: %v", err)
+	}
+
+	if _, _, err := c.Walk(root, []string{"missing"}); err == nil || err.Error() != errNotFound.Error() {
+		t.Errorf("walk to missing file: expected %v, got %v", errNotFound, err)
+	}
+
+	fid, qids, err := c.Walk(root, []string{"hello"})
+	if err != nil {
+		t.Fatalf("walk failed: %v", err)
+	}
+	if len(qids) != 1 || qids[0] != fs.qid("hello") {
+		t.Errorf("walk: got qids %v, expected [%v]", qids, fs.qid("hello"))
+	}
+	if _, _, err := c.Open(fid, ORDWR); err != nil {
+		t.Fatalf("open failed: %v", err)
+	}
+
+	if _, err := c.Write(fid, 7, []byte("9P")); err != nil {
+		t.Fatalf("write failed: %v", err)
+	}
+	data, err := c.Read(fid, 0, 1024)
+	if err != nil {
+		t.Fatalf("read failed: %v", err)
+	}
+	if string(data) != "hello, 9Prld" {
+		t.Errorf("read: got %q, expected %q", data, "hello, 9Prld")
+	}
+
+	if err := c.Clunk(fid); err != nil {
+		t.Errorf("clunk failed: %v", err)
+	}
+	if _, ok := fs.fids[fid]; ok {
+		t.Errorf("fid %d not clunked on server", fid)
+	}
+
+	// Closing the connection shuts the server down gracefully.
+	c.Close()
+	select {
+	case err := <-errch:
+		if err != nil {
+			t.Errorf("serve returned error on disconnect: %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("server did not terminate")
+	}
+}
+
+func TestServerDispatchError(t *testing.T) {
+	s := &Server{Protocol: NineP2000, Handler: &memFS{}}
+
+	m := s.dispatch(&WriteStatRequest{Tag: 12})
+	er, ok := m.(*ErrorResponse)
+	if !ok {
+		t.Fatalf("expected *ErrorResponse, got %T", m)
+	}
+	if er.Tag != 12 || er.Error != "permission denied" {
+		t.Errorf("got %v, expected Rerror{tag:12 ename:permission denied}", er)
+	}
+
+	// Tversion must carry NOTAG.
+	m = s.dispatch(&VersionRequest{Tag: 14, MessageSize: 8192, Version: Version})
+	if er, ok := m.(*ErrorResponse); !ok || er.Tag != 14 || er.Error != ErrInvalidTag.Error() {
+		t.Errorf("expected %v error response with tag 14, got %v", ErrInvalidTag, m)
+	}
+
+	// Responses are not valid requests.
+	m = s.dispatch(&ReadResponse{Tag: 13})
+	if er, ok := m.(*ErrorResponse); !ok || er.Tag != 13 {
+		t.Errorf("expected error response with tag 13, got %v", m)
+	}
+}
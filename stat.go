@@ -0,0 +1,180 @@
+package qp
+
+import (
+	"math"
+	"os"
+	"time"
+)
+
+// The atime and mtime fields of Stat hold Unix seconds in 32 bits, which
+// cannot represent times before 1970 or after early 2106. The setters clamp
+// such times to the nearest representable one.
+
+// AccessTime returns the last access time of the file.
+func (s *Stat) AccessTime() time.Time {
+	return time.Unix(int64(s.Atime), 0)
+}
+
+// ModTime returns the last modification time of the file.
+func (s *Stat) ModTime() time.Time {
+	return time.Unix(int64(s.Mtime), 0)
+}
+
+// SetAccessTime sets the last access time of the file, truncated to seconds
+// and clamped to the range of the field.
+func (s *Stat) SetAccessTime(t time.Time) {
+	s.Atime = unixSeconds(t)
+}
+
+// SetModTime sets the last modification time of the file, truncated to seconds
+// and clamped to the range of the field.
+func (s *Stat) SetModTime(t time.Time) {
+	s.Mtime = unixSeconds(t)
+}
+
+// unixSeconds converts t to Unix seconds, clamped to the range of uint32.
+func unixSeconds(t time.Time) uint32 {
+	switch sec := t.Unix(); {
+	case sec < 0:
+		return 0
+	case sec > math.MaxUint32:
+		return math.MaxUint32
+	default:
+		return uint32(sec)
+	}
+}
+
+// modeFlags maps FileMode flags to their os.FileMode counterparts.
+var modeFlags = []struct {
+	qp FileMode
+	os os.FileMode
+}{
+	{DMDIR, os.ModeDir},
+	{DMAPPEND, os.ModeAppend},
+	{DMEXCL, os.ModeExclusive},
+	{DMTMP, os.ModeTemporary},
+	{DMSYMLINK, os.ModeSymlink},
+	{DMDEVICE, os.ModeDevice},
+	{DMNAMEDPIPE, os.ModeNamedPipe},
+	{DMSOCKET, os.ModeSocket},
+	{DMSETUID, os.ModeSetuid},
+	{DMSETGID, os.ModeSetgid},
+}
+
+// OSFileMode returns the os.FileMode equivalent of m. Flags without an
+// equivalent, such as DMAUTH, are dropped.
+func (m FileMode) OSFileMode() os.FileMode {
+	mode := os.FileMode(m & 0777)
+	for _, f := range modeFlags {
+		if m&f.qp != 0 {
+			mode |= f.os
+		}
+	}
+	return mode
+}
+
+// fileModeFromOS returns the FileMode equivalent of m.
+func fileModeFromOS(m os.FileMode) FileMode {
+	mode := FileMode(m.Perm())
+	for _, f := range modeFlags {
+		if m&f.os != 0 {
+			mode |= f.qp
+		}
+	}
+	return mode
+}
+
+// FileInfo returns an os.FileInfo describing the Stat. The Stat is copied, so
+// later changes to it are not reflected. Sys returns the copy as a *Stat.
+func (s *Stat) FileInfo() os.FileInfo {
+	c := *s
+	return fileInfo{&c}
+}
+
+// StatFromFileInfo returns a Stat describing fi, for answering a stat request
+// from a local file. The qid type is derived from the mode, but the qid path
+// and version, and the owners, are left for the caller to fill in. The access
+// time is set to the modification time, as os.FileInfo carries no access time.
+func StatFromFileInfo(fi os.FileInfo) Stat {
+	s := Stat{
+		Mode:   fileModeFromOS(fi.Mode()),
+		Length: uint64(fi.Size()),
+		Name:   fi.Name(),
+	}
+	if s.Mode&DMDIR != 0 {
+		// Directories have no length.
+		s.Length = 0
+	}
+	s.Qid.Type = QidType(s.Mode >> 24)
+	s.SetModTime(fi.ModTime())
+	s.Atime = s.Mtime
+	return s
+}
+
+// fileInfo implements os.FileInfo for a Stat.
+type fileInfo struct {
+	s *Stat
+}
+
+func (fi fileInfo) Name() string       { return fi.s.Name }
+func (fi fileInfo) Size() int64        { return int64(fi.s.Length) }
+func (fi fileInfo) Mode() os.FileMode  { return fi.s.Mode.OSFileMode() }
+func (fi fileInfo) ModTime() time.Time { return fi.s.ModTime() }
+func (fi fileInfo) IsDir() bool        { return fi.s.IsDir() }
+func (fi fileInfo) Sys() interface{}   { return fi.s }
+
+// MarkNoChange sets every field of the Stat to the value which, in a write
+// stat request, leaves the field unchanged: all ones for numbers and the empty
+// string for strings. Fields to change can then be set individually, such as
+// Length for a truncate.
+func (s *Stat) MarkNoChange() {
+	*s = Stat{
+		Type: math.MaxUint16,
+		Dev:  math.MaxUint32,
+		Qid: Qid{
+			Type:    math.MaxUint8,
+			Version: math.MaxUint32,
+			Path:    math.MaxUint64,
+		},
+		Mode:   math.MaxUint32,
+		Atime:  math.MaxUint32,
+		Mtime:  math.MaxUint32,
+		Length: math.MaxUint64,
+	}
+}
+
+// ChangesMode reports whether a write stat request with the Stat changes the
+// mode of the file.
+func (s *Stat) ChangesMode() bool { return s.Mode != math.MaxUint32 }
+
+// ChangesAccessTime reports whether a write stat request with the Stat changes
+// the last access time of the file.
+func (s *Stat) ChangesAccessTime() bool { return s.Atime != math.MaxUint32 }
+
+// ChangesModTime reports whether a write stat request with the Stat changes
+// the last modification time of the file.
+func (s *Stat) ChangesModTime() bool { return s.Mtime != math.MaxUint32 }
+
+// ChangesLength reports whether a write stat request with the Stat changes the
+// length of the file.
+func (s *Stat) ChangesLength() bool { return s.Length != math.MaxUint64 }
+
+// ChangesName reports whether a write stat request with the Stat renames the
+// file.
+func (s *Stat) ChangesName() bool { return s.Name != "" }
+
+// ChangesGID reports whether a write stat request with the Stat changes the
+// group of the file.
+func (s *Stat) ChangesGID() bool { return s.GID != "" }
+
+// Canonical returns the wire encoding of s, with its leading size field. The
+// encoding holds every field in a fixed order and width, so stats are equal
+// exactly when their canonical forms are, which makes it suitable as a cache
+// key. nil is returned if s is too large to be encoded.
+func (s *Stat) Canonical() []byte {
+	b, err := MarshalStat(*s)
+	if err != nil {
+		return nil
+	}
+	return b
+}
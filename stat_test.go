@@ -0,0 +1,150 @@
+package qp
+
+import (
+	"bytes"
+	"math"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestStatTimes(t *testing.T) {
+	tests := []struct {
+		in   time.Time
+		wire uint32
+	}{
+		{time.Unix(0, 0), 0},
+		{time.Unix(1234567890, 999999999), 1234567890},
+		{time.Unix(math.MaxUint32, 0), math.MaxUint32},
+		{time.Unix(-1, 0), 0},
+		{time.Date(1900, 1, 1, 0, 0, 0, 0, time.UTC), 0},
+		{time.Date(2200, 1, 1, 0, 0, 0, 0, time.UTC), math.MaxUint32},
+	}
+
+	for i, tt := range tests {
+		var s Stat
+		s.SetAccessTime(tt.in)
+		s.SetModTime(tt.in)
+		if s.Atime != tt.wire || s.Mtime != tt.wire {
+			t.Errorf("test %d: %v stored as atime %d and mtime %d, expected %d", i, tt.in, s.Atime, s.Mtime, tt.wire)
+		}
+		if exp := time.Unix(int64(tt.wire), 0); !s.AccessTime().Equal(exp) || !s.ModTime().Equal(exp) {
+			t.Errorf("test %d: got access time %v and mod time %v, expected %v", i, s.AccessTime(), s.ModTime(), exp)
+		}
+	}
+}
+
+func TestStatFileInfo(t *testing.T) {
+	mtime := time.Unix(1234567890, 0)
+	tests := []struct {
+		stat Stat
+		mode os.FileMode
+	}{
+		{Stat{Name: "file", Length: 12, Mode: 0644}, 0644},
+		{Stat{Name: "dir", Qid: Qid{Type: QTDIR}, Mode: DMDIR | 0755}, os.ModeDir | 0755},
+		{Stat{Name: "log", Length: 3, Qid: Qid{Type: QTAPPEND}, Mode: DMAPPEND | 0622}, os.ModeAppend | 0622},
+		{Stat{Name: "lock", Qid: Qid{Type: QTEXCL | QTTMP}, Mode: DMEXCL | DMTMP | 0600}, os.ModeExclusive | os.ModeTemporary | 0600},
+	}
+
+	for i, tt := range tests {
+		tt.stat.SetModTime(mtime)
+		tt.stat.Atime = tt.stat.Mtime
+
+		fi := tt.stat.FileInfo()
+		if fi.Name() != tt.stat.Name || fi.Size() != int64(tt.stat.Length) || !fi.ModTime().Equal(mtime) {
+			t.Errorf("test %d: got name %q, size %d and mtime %v", i, fi.Name(), fi.Size(), fi.ModTime())
+		}
+		if fi.Mode() != tt.mode {
+			t.Errorf("test %d: got mode %v, expected %v", i, fi.Mode(), tt.mode)
+		}
+		if fi.IsDir() != tt.mode.IsDir() {
+			t.Errorf("test %d: IsDir returned %v", i, fi.IsDir())
+		}
+
+		if s := StatFromFileInfo(fi); s != tt.stat {
+			t.Errorf("test %d: reverse conversion:\n\tExpected: %#v\n\tGot:      %#v", i, tt.stat, s)
+		}
+	}
+
+	if m := (DMAUTH | 0400).OSFileMode(); m != 0400 {
+		t.Errorf("DMAUTH translated to %v, expected it to be dropped", m)
+	}
+}
+
+func TestStatMarkNoChange(t *testing.T) {
+	var s Stat
+	s.MarkNoChange()
+	if s.ChangesMode() || s.ChangesAccessTime() || s.ChangesModTime() || s.ChangesLength() || s.ChangesName() || s.ChangesGID() {
+		t.Errorf("no-op stat reports changes: %v", &s)
+	}
+
+	// The sentinel values are all ones on the wire.
+	b := make([]byte, s.EncodedSize())
+	if err := s.Marshal(b); err != nil {
+		t.Fatalf("marshal failed: %v", err)
+	}
+	for i, c := range b[2 : len(b)-8] {
+		if c != 0xFF {
+			t.Errorf("byte %d of no-op stat is %#x, expected 0xff", i+2, c)
+		}
+	}
+
+	// A truncate only changes the length.
+	s.Length = 0
+	if !s.ChangesLength() || s.ChangesMode() || s.ChangesName() {
+		t.Errorf("truncate stat reports wrong changes: %v", &s)
+	}
+}
+
+func TestStatCanonical(t *testing.T) {
+	newStat := func() Stat {
+		return Stat{
+			Type:   1,
+			Dev:    2,
+			Qid:    Qid{Type: QTFILE, Version: 3, Path: 4},
+			Mode:   0644,
+			Atime:  5,
+			Mtime:  6,
+			Length: 7,
+			Name:   "name",
+			UID:    "uid",
+			GID:    "gid",
+			MUID:   "muid",
+		}
+	}
+
+	a, b := newStat(), newStat()
+	canonical := a.Canonical()
+	if !bytes.Equal(canonical, b.Canonical()) {
+		t.Fatalf("equal stats encoded differently:\n\t%x\n\t%x", canonical, b.Canonical())
+	}
+
+	changes := map[string]func(*Stat){
+		"Type":        func(s *Stat) { s.Type++ },
+		"Dev":         func(s *Stat) { s.Dev++ },
+		"Qid.Type":    func(s *Stat) { s.Qid.Type = QTDIR },
+		"Qid.Version": func(s *Stat) { s.Qid.Version++ },
+		"Qid.Path":    func(s *Stat) { s.Qid.Path++ },
+		"Mode":        func(s *Stat) { s.Mode++ },
+		"Atime":       func(s *Stat) { s.Atime++ },
+		"Mtime":       func(s *Stat) { s.Mtime++ },
+		"Length":      func(s *Stat) { s.Length++ },
+		"Name":        func(s *Stat) { s.Name = "Name" },
+		"UID":         func(s *Stat) { s.UID = "Uid" },
+		"GID":         func(s *Stat) { s.GID = "Gid" },
+		"MUID":        func(s *Stat) { s.MUID = "Muid" },
+	}
+	for field, change := range changes {
+		s := newStat()
+		change(&s)
+		if bytes.Equal(s.Canonical(), canonical) {
+			t.Errorf("changing %s did not change the canonical form", field)
+		}
+	}
+
+	long := Stat{Name: strings.Repeat("x", maxStringSize)}
+	if b := long.Canonical(); b != nil {
+		t.Errorf("got %d bytes for a stat too large to encode", len(b))
+	}
+}
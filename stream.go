@@ -0,0 +1,217 @@
+package qp
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"io"
+)
+
+// ErrShortStream indicates that the reader of a streamed message ended before
+// the declared amount of data was written. The message is left truncated on
+// the wire, so the connection cannot be used any further.
+var ErrShortStream = errors.New("stream shorter than count")
+
+// StreamingWriteRequest is a WriteRequest whose data is read from an
+// io.Reader while it is written, rather than held in memory. It is written
+// with Encoder.WriteStream.
+type StreamingWriteRequest struct {
+	Tag
+
+	// Fid is the fid to write to.
+	Fid Fid
+
+	// Offset is the offset to write at.
+	Offset uint64
+
+	// Count is the amount of bytes to write, which are read from Data.
+	Count uint32
+
+	// Data provides the bytes to write.
+	Data io.Reader
+}
+
+// WriteStream writes m as a WriteRequest, copying exactly m.Count bytes from
+// m.Data to the Encoders io.Writer after the fixed fields, so the data is
+// never buffered as a whole. The message is checked against MessageSize up
+// front. If m.Data ends early, ErrShortStream is returned. Other messages are
+// held back until the stream is complete.
+func (e *Encoder) WriteStream(m *StreamingWriteRequest) error {
+	mt, err := e.Protocol.MessageType(&WriteRequest{})
+	if err != nil {
+		return err
+	}
+	size := uint64(WriteOverhead) + uint64(m.Count)
+	if size > maxDataSize || e.MessageSize > 0 && size > uint64(e.MessageSize) {
+		return ErrMessageTooBig
+	}
+
+	b := writeHeader(mt, m.Tag, m.Fid, m.Offset, m.Count)
+
+	e.writeLock.Lock()
+	defer e.writeLock.Unlock()
+
+	if err := write(e.Writer, b[:]); err != nil {
+		return err
+	}
+	if _, err := io.CopyN(e.Writer, m.Data, int64(m.Count)); err != nil {
+		if err == io.EOF {
+			err = ErrShortStream
+		}
+		return err
+	}
+	return nil
+}
+
+// zeroCopySize is the smallest amount of data that WriteMessage writes from
+// the Data of a WriteRequest directly. Smaller requests are copied into a
+// single buffer, as a separate write would cost more than the copy.
+const zeroCopySize = 4096
+
+// writeHeader returns the header and fixed fields of a WriteRequest of type
+// mt carrying count bytes of data.
+func writeHeader(mt MessageType, t Tag, fid Fid, offset uint64, count uint32) [WriteOverhead]byte {
+	var b [WriteOverhead]byte
+	binary.LittleEndian.PutUint32(b[0:4], uint32(WriteOverhead)+count)
+	b[4] = byte(mt)
+	binary.LittleEndian.PutUint16(b[5:7], uint16(t))
+	binary.LittleEndian.PutUint32(b[7:11], uint32(fid))
+	binary.LittleEndian.PutUint64(b[11:19], offset)
+	binary.LittleEndian.PutUint32(b[19:23], count)
+	return b
+}
+
+// writeZeroCopy writes wr of type mt like writeMessage, writing its data
+// directly from wr.Data rather than copying it into an encoding buffer.
+func (e *Encoder) writeZeroCopy(ctx context.Context, mt MessageType, wr *WriteRequest) error {
+	if err := checkData(wr.Data); err != nil {
+		return err
+	}
+	b := writeHeader(mt, wr.Tag, wr.Fid, wr.Offset, uint32(len(wr.Data)))
+
+	e.writeLock.Lock()
+	defer e.writeLock.Unlock()
+
+	w := e.writer(ctx)
+
+	if err := write(w, b[:]); err != nil {
+		return err
+	}
+	return write(w, wr.Data)
+}
+
+// StreamingReadResponse is a ReadResponse whose data is left on the wire to be
+// read through DataReader, rather than held in memory. It is returned by
+// Decoder.ReadMessage when StreamReads is set. The data must be consumed
+// before the next message is read from the Decoder, which discards anything
+// left of it, after which DataReader only returns io.EOF.
+type StreamingReadResponse struct {
+	Tag
+
+	// Count is the amount of bytes of data.
+	Count uint32
+
+	// data reads the data from rest, which is the remainder of the body,
+	// including any trailing bytes.
+	data, rest *streamReader
+}
+
+// DataReader returns a reader of the Count bytes of data. If the stream
+// ends early, it fails with io.ErrUnexpectedEOF.
+func (srr *StreamingReadResponse) DataReader() io.Reader {
+	if srr.data == nil {
+		return &streamReader{}
+	}
+	return srr.data
+}
+
+// Marshal fails with ErrBodySkipped, as the data is not kept.
+func (srr *StreamingReadResponse) Marshal(b []byte) error { return ErrBodySkipped }
+
+// Unmarshal decodes the tag and count of the message body, ignoring the data.
+func (srr *StreamingReadResponse) Unmarshal(b []byte) error {
+	if len(b) < 2+4 {
+		return ErrPayloadTooShort
+	}
+	srr.Tag = Tag(binary.LittleEndian.Uint16(b[0:2]))
+	srr.Count = binary.LittleEndian.Uint32(b[2:6])
+	return nil
+}
+
+// EncodedSize returns the size of the message body, including the data.
+func (srr *StreamingReadResponse) EncodedSize() int { return 2 + 4 + int(srr.Count) }
+
+// streamReader reads the remaining n bytes of a message body from r.
+type streamReader struct {
+	r io.Reader
+	n int64
+}
+
+func (sr *streamReader) Read(p []byte) (int, error) {
+	if sr.n <= 0 {
+		return 0, io.EOF
+	}
+	if int64(len(p)) > sr.n {
+		p = p[:sr.n]
+	}
+	n, err := sr.r.Read(p)
+	sr.n -= int64(n)
+	if err == io.EOF && sr.n > 0 {
+		err = io.ErrUnexpectedEOF
+	} else if err == io.EOF {
+		err = nil
+	}
+	return n, err
+}
+
+// streamRead is like simpleRead, but returns read responses as a
+// StreamingReadResponse, leaving the data to be read from r.
+func (d *Decoder) streamRead(r io.Reader) (Message, error) {
+	size, m, err := d.readFrame(r)
+	if err != nil {
+		return nil, err
+	}
+	if _, ok := m.(*ReadResponse); !ok {
+		return d.readBody(r, size, m, nil)
+	}
+
+	var b [2 + 4]byte
+	if size < ReadOverhead {
+		return nil, ErrPayloadTooShort
+	}
+	if _, err := io.ReadFull(r, b[:]); err != nil {
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			err = errTruncated
+		}
+		return nil, err
+	}
+	srr := &StreamingReadResponse{}
+	srr.Unmarshal(b[:])
+
+	rest := int64(size) - ReadOverhead
+	switch {
+	case int64(srr.Count) > rest:
+		return nil, ErrPayloadTooShort
+	case d.Strict && int64(srr.Count) < rest:
+		return nil, ErrTrailingData
+	}
+
+	srr.rest = &streamReader{r: r, n: rest}
+	srr.data = &streamReader{r: srr.rest, n: int64(srr.Count)}
+	d.stream = srr
+	return srr, nil
+}
+
+// discardStream discards what is left of the last streamed read response.
+func (d *Decoder) discardStream() error {
+	if d.stream == nil {
+		return nil
+	}
+	_, err := io.Copy(io.Discard, d.stream.rest)
+	d.stream.data.n = 0
+	d.stream = nil
+	if err == io.ErrUnexpectedEOF {
+		err = errTruncated
+	}
+	return err
+}
@@ -0,0 +1,188 @@
+package qp
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"io/ioutil"
+	"strings"
+	"testing"
+)
+
+func TestEncoderWriteStream(t *testing.T) {
+	data := strings.Repeat("9P", 1000)
+
+	var expected bytes.Buffer
+	if err := NewEncoder(NineP2000, &expected).WriteMessage(&WriteRequest{Tag: 1, Fid: 2, Offset: 3, Data: []byte(data)}); err != nil {
+		t.Fatalf("write failed: %v", err)
+	}
+
+	var buf bytes.Buffer
+	e := NewEncoder(NineP2000, &buf)
+	m := &StreamingWriteRequest{Tag: 1, Fid: 2, Offset: 3, Count: uint32(len(data)), Data: strings.NewReader(data + "trailing")}
+	if err := e.WriteStream(m); err != nil {
+		t.Fatalf("stream failed: %v", err)
+	}
+	if !bytes.Equal(buf.Bytes(), expected.Bytes()) {
+		t.Errorf("got\n\t%x\nexpected\n\t%x", buf.Bytes(), expected.Bytes())
+	}
+
+	m.Data = strings.NewReader(data[:10])
+	if err := e.WriteStream(m); err != ErrShortStream {
+		t.Errorf("short reader: expected %v, got %v", ErrShortStream, err)
+	}
+
+	buf.Reset()
+	e.MessageSize = 1024
+	m.Data = strings.NewReader(data)
+	if err := e.WriteStream(m); err != ErrMessageTooBig {
+		t.Errorf("large message: expected %v, got %v", ErrMessageTooBig, err)
+	}
+	if buf.Len() != 0 {
+		t.Errorf("%d bytes written despite error", buf.Len())
+	}
+}
+
+func TestDecoderStreamReads(t *testing.T) {
+	data := strings.Repeat("9P", 1000)
+
+	var buf bytes.Buffer
+	e := NewEncoder(NineP2000, &buf)
+	for _, m := range []Message{
+		&ReadResponse{Tag: 1, Data: []byte(data)},
+		&ReadResponse{Tag: 2, Data: []byte(data)},
+		&ClunkResponse{Tag: 3},
+	} {
+		if err := e.WriteMessage(m); err != nil {
+			t.Fatalf("write failed: %v", err)
+		}
+	}
+
+	d := NewDecoder(NineP2000, &buf)
+	d.StreamReads = true
+
+	// The first response is drained by the caller.
+	m, err := d.ReadMessage()
+	if err != nil {
+		t.Fatalf("read failed: %v", err)
+	}
+	srr, ok := m.(*StreamingReadResponse)
+	if !ok {
+		t.Fatalf("got %T, expected *StreamingReadResponse", m)
+	}
+	if srr.Tag != 1 || srr.Count != uint32(len(data)) {
+		t.Errorf("got tag %d and count %d, expected 1 and %d", srr.Tag, srr.Count, len(data))
+	}
+	var out bytes.Buffer
+	if _, err := io.Copy(&out, srr.DataReader()); err != nil {
+		t.Fatalf("copy failed: %v", err)
+	}
+	if out.String() != data {
+		t.Errorf("got %d bytes of data, expected %q", out.Len(), data)
+	}
+
+	// The second response is only partly read, so the decoder must discard
+	// the rest.
+	m, err = d.ReadMessage()
+	if err != nil {
+		t.Fatalf("read failed: %v", err)
+	}
+	srr = m.(*StreamingReadResponse)
+	var b [10]byte
+	if _, err := io.ReadFull(srr.DataReader(), b[:]); err != nil {
+		t.Fatalf("partial read failed: %v", err)
+	}
+
+	m, err = d.ReadMessage()
+	if err != nil {
+		t.Fatalf("read after undrained stream failed: %v", err)
+	}
+	if cr, ok := m.(*ClunkResponse); !ok || cr.Tag != 3 {
+		t.Errorf("got %#v, expected ClunkResponse with tag 3", m)
+	}
+	if n, err := srr.DataReader().Read(b[:]); n != 0 || err != io.EOF {
+		t.Errorf("discarded stream: got %d, %v, expected 0, EOF", n, err)
+	}
+	if _, err := d.ReadMessage(); err != io.EOF {
+		t.Errorf("expected EOF, got %v", err)
+	}
+}
+
+func TestDecoderStreamReadsTruncated(t *testing.T) {
+	var buf bytes.Buffer
+	if err := NewEncoder(NineP2000, &buf).WriteMessage(&ReadResponse{Tag: 1, Data: make([]byte, 100)}); err != nil {
+		t.Fatalf("write failed: %v", err)
+	}
+	b := buf.Bytes()[:buf.Len()-10]
+
+	d := NewDecoder(NineP2000, bytes.NewReader(b))
+	d.StreamReads = true
+	m, err := d.ReadMessage()
+	if err != nil {
+		t.Fatalf("read failed: %v", err)
+	}
+	if _, err := ioutil.ReadAll(m.(*StreamingReadResponse).DataReader()); err != io.ErrUnexpectedEOF {
+		t.Errorf("drained truncated stream: expected %v, got %v", io.ErrUnexpectedEOF, err)
+	}
+
+	d = NewDecoder(NineP2000, bytes.NewReader(b))
+	d.StreamReads = true
+	if _, err := d.ReadMessage(); err != nil {
+		t.Fatalf("read failed: %v", err)
+	}
+	if _, err := d.ReadMessage(); !errors.Is(err, ErrPayloadTooShort) {
+		t.Errorf("discarded truncated stream: expected %v, got %v", ErrPayloadTooShort, err)
+	}
+}
+
+// recordingWriter records the slices passed to Write, without copying them.
+type recordingWriter struct {
+	writes [][]byte
+	buf    bytes.Buffer
+}
+
+func (rw *recordingWriter) Write(b []byte) (int, error) {
+	rw.writes = append(rw.writes, b)
+	return rw.buf.Write(b)
+}
+
+func TestEncoderWriteZeroCopy(t *testing.T) {
+	shared := make([]byte, 3*zeroCopySize)
+	for i := range shared {
+		shared[i] = byte(i)
+	}
+	data := shared[zeroCopySize : 2*zeroCopySize+1]
+	m := &WriteRequest{Tag: 1, Fid: 2, Offset: 3, Data: data}
+
+	var rw recordingWriter
+	if err := NewEncoder(NineP2000, &rw).WriteMessage(m); err != nil {
+		t.Fatalf("write failed: %v", err)
+	}
+	expected, err := NewEncoder(NineP2000, nil).AppendMessage(nil, m)
+	if err != nil {
+		t.Fatalf("append failed: %v", err)
+	}
+	if !bytes.Equal(rw.buf.Bytes(), expected) {
+		t.Errorf("wire bytes differ from the encoded message")
+	}
+
+	aliased := false
+	for _, b := range rw.writes {
+		if len(b) > 0 && &b[0] == &data[0] && len(b) == len(data) {
+			aliased = true
+		}
+	}
+	if !aliased {
+		t.Errorf("data was copied: none of the %d writes aliases it", len(rw.writes))
+	}
+
+	// Small writes are still sent in one write.
+	rw = recordingWriter{}
+	m.Data = data[:zeroCopySize-1]
+	if err := NewEncoder(NineP2000, &rw).WriteMessage(m); err != nil {
+		t.Fatalf("small write failed: %v", err)
+	}
+	if len(rw.writes) != 1 {
+		t.Errorf("small write took %d writes, expected 1", len(rw.writes))
+	}
+}
@@ -0,0 +1,384 @@
+package qp
+
+import (
+	"fmt"
+	"strconv"
+)
+
+// messageTypeNames maps message types to their names as used in the protocol
+// specifications.
+var messageTypeNames = map[MessageType]string{
+	Tversion:  "Tversion",
+	Rversion:  "Rversion",
+	Tauth:     "Tauth",
+	Rauth:     "Rauth",
+	Tattach:   "Tattach",
+	Rattach:   "Rattach",
+	Terror:    "Terror",
+	Rerror:    "Rerror",
+	Tflush:    "Tflush",
+	Rflush:    "Rflush",
+	Twalk:     "Twalk",
+	Rwalk:     "Rwalk",
+	Topen:     "Topen",
+	Ropen:     "Ropen",
+	Tcreate:   "Tcreate",
+	Rcreate:   "Rcreate",
+	Tread:     "Tread",
+	Rread:     "Rread",
+	Twrite:    "Twrite",
+	Rwrite:    "Rwrite",
+	Tclunk:    "Tclunk",
+	Rclunk:    "Rclunk",
+	Tremove:   "Tremove",
+	Rremove:   "Rremove",
+	Tstat:     "Tstat",
+	Rstat:     "Rstat",
+	Twstat:    "Twstat",
+	Rwstat:    "Rwstat",
+	Tsession:  "Tsession",
+	Rsession:  "Rsession",
+	Tsread:    "Tsread",
+	Rsread:    "Rsread",
+	Tswrite:   "Tswrite",
+	Rswrite:   "Rswrite",
+	Tlerror:   "Tlerror",
+	Rlerror:   "Rlerror",
+	Tstatfs:   "Tstatfs",
+	Rstatfs:   "Rstatfs",
+	Tlopen:    "Tlopen",
+	Rlopen:    "Rlopen",
+	Tlcreate:  "Tlcreate",
+	Rlcreate:  "Rlcreate",
+	Trename:   "Trename",
+	Rrename:   "Rrename",
+	Treadlink: "Treadlink",
+	Rreadlink: "Rreadlink",
+	Tgetattr:  "Tgetattr",
+	Rgetattr:  "Rgetattr",
+	Tsetattr:  "Tsetattr",
+	Rsetattr:  "Rsetattr",
+	Treaddir:  "Treaddir",
+	Rreaddir:  "Rreaddir",
+	Tmkdir:    "Tmkdir",
+	Rmkdir:    "Rmkdir",
+}
+
+// String returns the name of the message type, such as "Tversion", or
+// "MessageType(n)" if the type is unknown.
+func (mt MessageType) String() string {
+	if s, ok := messageTypeNames[mt]; ok {
+		return s
+	}
+	return fmt.Sprintf("MessageType(%d)", mt)
+}
+
+// String returns the fid in decimal, or "NOFID".
+func (f Fid) String() string {
+	if f == NOFID {
+		return "NOFID"
+	}
+	return strconv.FormatUint(uint64(f), 10)
+}
+
+// MarshalText implements encoding.TextMarshaler, formatting the fid as done by
+// String.
+func (f Fid) MarshalText() ([]byte, error) {
+	return []byte(f.String()), nil
+}
+
+// UnmarshalText implements encoding.TextUnmarshaler, parsing the formats
+// produced by MarshalText.
+func (f *Fid) UnmarshalText(b []byte) error {
+	if string(b) == "NOFID" {
+		*f = NOFID
+		return nil
+	}
+	n, err := strconv.ParseUint(string(b), 10, 32)
+	if err != nil {
+		return fmt.Errorf("invalid fid %q", b)
+	}
+	*f = Fid(n)
+	return nil
+}
+
+// String returns the Qid formatted as "(path.version type)", with the path in
+// hexadecimal and the type as a set of flag characters: d for directory, a for
+// append-only, l for exclusive, m for mount, A for auth and t for temporary. A
+// plain file is shown as f.
+func (q Qid) String() string {
+	t := ""
+	for _, f := range qidTypeFlags {
+		if q.Type&f.bit != 0 {
+			t += f.name
+		}
+	}
+	if t == "" {
+		t = "f"
+	}
+	return fmt.Sprintf("(%x.%d %s)", q.Path, q.Version, t)
+}
+
+var qidTypeFlags = []struct {
+	bit  QidType
+	name string
+}{
+	{QTDIR, "d"},
+	{QTAPPEND, "a"},
+	{QTEXCL, "l"},
+	{QTMOUNT, "m"},
+	{QTAUTH, "A"},
+	{QTTMP, "t"},
+}
+
+// String returns a compact representation of the Stat struct.
+func (s *Stat) String() string {
+	return fmt.Sprintf("{name:%s uid:%s gid:%s muid:%s qid:%v mode:%#o atime:%d mtime:%d length:%d type:%d dev:%d}",
+		s.Name, s.UID, s.GID, s.MUID, s.Qid, s.Mode, s.Atime, s.Mtime, s.Length, s.Type, s.Dev)
+}
+
+// String returns a compact representation of the StatDotu struct.
+func (s *StatDotu) String() string {
+	return fmt.Sprintf("{name:%s uid:%s gid:%s muid:%s qid:%v mode:%#o atime:%d mtime:%d length:%d type:%d dev:%d extension:%s n_uid:%d n_gid:%d n_muid:%d}",
+		s.Name, s.UID, s.GID, s.MUID, s.Qid, s.Mode, s.Atime, s.Mtime, s.Length, s.Type, s.Dev, s.Extensions, s.UIDno, s.GIDno, s.MUIDno)
+}
+
+// 9P2000 messages.
+
+func (vr *VersionRequest) String() string {
+	return fmt.Sprintf("Tversion{tag:%d msize:%d version:%s}", vr.Tag, vr.MessageSize, vr.Version)
+}
+
+func (vr *VersionResponse) String() string {
+	return fmt.Sprintf("Rversion{tag:%d msize:%d version:%s}", vr.Tag, vr.MessageSize, vr.Version)
+}
+
+func (ar *AuthRequest) String() string {
+	return fmt.Sprintf("Tauth{tag:%d afid:%d uname:%s aname:%s}", ar.Tag, ar.AuthFid, ar.Username, ar.Service)
+}
+
+func (ar *AuthResponse) String() string {
+	return fmt.Sprintf("Rauth{tag:%d aqid:%v}", ar.Tag, ar.AuthQid)
+}
+
+func (ar *AttachRequest) String() string {
+	return fmt.Sprintf("Tattach{tag:%d fid:%d afid:%d uname:%s aname:%s}", ar.Tag, ar.Fid, ar.AuthFid, ar.Username, ar.Service)
+}
+
+func (ar *AttachResponse) String() string {
+	return fmt.Sprintf("Rattach{tag:%d qid:%v}", ar.Tag, ar.Qid)
+}
+
+func (er *ErrorResponse) String() string {
+	return fmt.Sprintf("Rerror{tag:%d ename:%s}", er.Tag, er.Error)
+}
+
+func (fr *FlushRequest) String() string {
+	return fmt.Sprintf("Tflush{tag:%d oldtag:%d}", fr.Tag, fr.OldTag)
+}
+
+func (fr *FlushResponse) String() string {
+	return fmt.Sprintf("Rflush{tag:%d}", fr.Tag)
+}
+
+func (wr *WalkRequest) String() string {
+	return fmt.Sprintf("Twalk{tag:%d fid:%d newfid:%d wname:%v}", wr.Tag, wr.Fid, wr.NewFid, wr.Names)
+}
+
+func (wr *WalkResponse) String() string {
+	return fmt.Sprintf("Rwalk{tag:%d wqid:%v}", wr.Tag, wr.Qids)
+}
+
+func (or *OpenRequest) String() string {
+	return fmt.Sprintf("Topen{tag:%d fid:%d mode:%d}", or.Tag, or.Fid, or.Mode)
+}
+
+func (or *OpenResponse) String() string {
+	return fmt.Sprintf("Ropen{tag:%d qid:%v iounit:%d}", or.Tag, or.Qid, or.IOUnit)
+}
+
+func (cr *CreateRequest) String() string {
+	return fmt.Sprintf("Tcreate{tag:%d fid:%d name:%s perm:%#o mode:%d}", cr.Tag, cr.Fid, cr.Name, cr.Permissions, cr.Mode)
+}
+
+func (cr *CreateResponse) String() string {
+	return fmt.Sprintf("Rcreate{tag:%d qid:%v iounit:%d}", cr.Tag, cr.Qid, cr.IOUnit)
+}
+
+func (rr *ReadRequest) String() string {
+	return fmt.Sprintf("Tread{tag:%d fid:%d offset:%d count:%d}", rr.Tag, rr.Fid, rr.Offset, rr.Count)
+}
+
+func (rr *ReadResponse) String() string {
+	return fmt.Sprintf("Rread{tag:%d count:%d}", rr.Tag, len(rr.Data))
+}
+
+func (wr *WriteRequest) String() string {
+	return fmt.Sprintf("Twrite{tag:%d fid:%d offset:%d count:%d}", wr.Tag, wr.Fid, wr.Offset, len(wr.Data))
+}
+
+func (wr *WriteResponse) String() string {
+	return fmt.Sprintf("Rwrite{tag:%d count:%d}", wr.Tag, wr.Count)
+}
+
+func (cr *ClunkRequest) String() string {
+	return fmt.Sprintf("Tclunk{tag:%d fid:%d}", cr.Tag, cr.Fid)
+}
+
+func (cr *ClunkResponse) String() string {
+	return fmt.Sprintf("Rclunk{tag:%d}", cr.Tag)
+}
+
+func (rr *RemoveRequest) String() string {
+	return fmt.Sprintf("Tremove{tag:%d fid:%d}", rr.Tag, rr.Fid)
+}
+
+func (rr *RemoveResponse) String() string {
+	return fmt.Sprintf("Rremove{tag:%d}", rr.Tag)
+}
+
+func (sr *StatRequest) String() string {
+	return fmt.Sprintf("Tstat{tag:%d fid:%d}", sr.Tag, sr.Fid)
+}
+
+func (sr *StatResponse) String() string {
+	return fmt.Sprintf("Rstat{tag:%d stat:%v}", sr.Tag, &sr.Stat)
+}
+
+func (wsr *WriteStatRequest) String() string {
+	return fmt.Sprintf("Twstat{tag:%d fid:%d stat:%v}", wsr.Tag, wsr.Fid, &wsr.Stat)
+}
+
+func (wsr *WriteStatResponse) String() string {
+	return fmt.Sprintf("Rwstat{tag:%d}", wsr.Tag)
+}
+
+// 9P2000.u messages.
+
+func (ar *AuthRequestDotu) String() string {
+	return fmt.Sprintf("Tauth{tag:%d afid:%d uname:%s aname:%s n_uname:%d}", ar.Tag, ar.AuthFid, ar.Username, ar.Service, ar.UIDno)
+}
+
+func (ar *AttachRequestDotu) String() string {
+	return fmt.Sprintf("Tattach{tag:%d fid:%d afid:%d uname:%s aname:%s n_uname:%d}", ar.Tag, ar.Fid, ar.AuthFid, ar.Username, ar.Service, ar.UIDno)
+}
+
+func (er *ErrorResponseDotu) String() string {
+	return fmt.Sprintf("Rerror{tag:%d ename:%s errno:%d}", er.Tag, er.Error, er.Errno)
+}
+
+func (cr *CreateRequestDotu) String() string {
+	return fmt.Sprintf("Tcreate{tag:%d fid:%d name:%s perm:%#o mode:%d extension:%s}", cr.Tag, cr.Fid, cr.Name, cr.Permissions, cr.Mode, cr.Extensions)
+}
+
+func (sr *StatResponseDotu) String() string {
+	return fmt.Sprintf("Rstat{tag:%d stat:%v}", sr.Tag, &sr.Stat)
+}
+
+func (wsr *WriteStatRequestDotu) String() string {
+	return fmt.Sprintf("Twstat{tag:%d fid:%d stat:%v}", wsr.Tag, wsr.Fid, &wsr.Stat)
+}
+
+// 9P2000.e messages.
+
+func (sr *SessionRequestDote) String() string {
+	return fmt.Sprintf("Tsession{tag:%d key:%x}", sr.Tag, sr.Key)
+}
+
+func (sr *SessionResponseDote) String() string {
+	return fmt.Sprintf("Rsession{tag:%d}", sr.Tag)
+}
+
+func (srr *SimpleReadRequestDote) String() string {
+	return fmt.Sprintf("Tsread{tag:%d fid:%d wname:%v}", srr.Tag, srr.Fid, srr.Names)
+}
+
+func (srr *SimpleReadResponseDote) String() string {
+	return fmt.Sprintf("Rsread{tag:%d count:%d}", srr.Tag, len(srr.Data))
+}
+
+func (swr *SimpleWriteRequestDote) String() string {
+	return fmt.Sprintf("Tswrite{tag:%d fid:%d wname:%v count:%d}", swr.Tag, swr.Fid, swr.Names, len(swr.Data))
+}
+
+func (swr *SimpleWriteResponseDote) String() string {
+	return fmt.Sprintf("Rswrite{tag:%d count:%d}", swr.Tag, swr.Count)
+}
+
+// 9P2000.L messages.
+
+func (er *ErrorResponseDotl) String() string {
+	return fmt.Sprintf("Rlerror{tag:%d ecode:%d}", er.Tag, er.Errno)
+}
+
+func (sr *StatfsRequestDotl) String() string {
+	return fmt.Sprintf("Tstatfs{tag:%d fid:%d}", sr.Tag, sr.Fid)
+}
+
+func (sr *StatfsResponseDotl) String() string {
+	return fmt.Sprintf("Rstatfs{tag:%d type:%#x bsize:%d blocks:%d bfree:%d bavail:%d files:%d ffree:%d fsid:%#x namelen:%d}", sr.Tag, sr.Type, sr.BlockSize, sr.Blocks, sr.BlocksFree, sr.BlocksAvailable, sr.Files, sr.FilesFree, sr.FSID, sr.NameLength)
+}
+
+func (or *OpenRequestDotl) String() string {
+	return fmt.Sprintf("Tlopen{tag:%d fid:%d flags:%#o}", or.Tag, or.Fid, or.Flags)
+}
+
+func (or *OpenResponseDotl) String() string {
+	return fmt.Sprintf("Rlopen{tag:%d qid:%v iounit:%d}", or.Tag, or.Qid, or.IOUnit)
+}
+
+func (cr *CreateRequestDotl) String() string {
+	return fmt.Sprintf("Tlcreate{tag:%d fid:%d name:%s flags:%#o mode:%#o gid:%d}", cr.Tag, cr.Fid, cr.Name, cr.Flags, cr.Mode, cr.GID)
+}
+
+func (cr *CreateResponseDotl) String() string {
+	return fmt.Sprintf("Rlcreate{tag:%d qid:%v iounit:%d}", cr.Tag, cr.Qid, cr.IOUnit)
+}
+
+func (rr *RenameRequestDotl) String() string {
+	return fmt.Sprintf("Trename{tag:%d fid:%d dfid:%d name:%s}", rr.Tag, rr.Fid, rr.DirectoryFid, rr.Name)
+}
+
+func (rr *RenameResponseDotl) String() string {
+	return fmt.Sprintf("Rrename{tag:%d}", rr.Tag)
+}
+
+func (rr *ReadLinkRequestDotl) String() string {
+	return fmt.Sprintf("Treadlink{tag:%d fid:%d}", rr.Tag, rr.Fid)
+}
+
+func (rr *ReadLinkResponseDotl) String() string {
+	return fmt.Sprintf("Rreadlink{tag:%d target:%s}", rr.Tag, rr.Target)
+}
+
+func (gr *GetAttrRequestDotl) String() string {
+	return fmt.Sprintf("Tgetattr{tag:%d fid:%d request_mask:%#x}", gr.Tag, gr.Fid, gr.RequestMask)
+}
+
+func (gr *GetAttrResponseDotl) String() string {
+	return fmt.Sprintf("Rgetattr{tag:%d valid:%#x qid:%v mode:%#o uid:%d gid:%d nlink:%d rdev:%d size:%d blksize:%d blocks:%d atime:%d.%09d mtime:%d.%09d ctime:%d.%09d}", gr.Tag, gr.Valid, gr.Qid, gr.Mode, gr.UID, gr.GID, gr.NLink, gr.RDev, gr.Size, gr.BlockSize, gr.Blocks, gr.AtimeSec, gr.AtimeNsec, gr.MtimeSec, gr.MtimeNsec, gr.CtimeSec, gr.CtimeNsec)
+}
+
+func (sr *SetAttrRequestDotl) String() string {
+	return fmt.Sprintf("Tsetattr{tag:%d fid:%d valid:%#x mode:%#o uid:%d gid:%d size:%d atime:%d.%09d mtime:%d.%09d}", sr.Tag, sr.Fid, sr.Valid, sr.Mode, sr.UID, sr.GID, sr.Size, sr.AtimeSec, sr.AtimeNsec, sr.MtimeSec, sr.MtimeNsec)
+}
+
+func (sr *SetAttrResponseDotl) String() string {
+	return fmt.Sprintf("Rsetattr{tag:%d}", sr.Tag)
+}
+
+func (rr *ReadDirRequestDotl) String() string {
+	return fmt.Sprintf("Treaddir{tag:%d fid:%d offset:%d count:%d}", rr.Tag, rr.Fid, rr.Offset, rr.Count)
+}
+
+func (rr *ReadDirResponseDotl) String() string {
+	return fmt.Sprintf("Rreaddir{tag:%d entries:%d}", rr.Tag, len(rr.Entries))
+}
+
+func (mr *MkdirRequestDotl) String() string {
+	return fmt.Sprintf("Tmkdir{tag:%d dfid:%d name:%s mode:%#o gid:%d}", mr.Tag, mr.DirectoryFid, mr.Name, mr.Mode, mr.GID)
+}
+
+func (mr *MkdirResponseDotl) String() string {
+	return fmt.Sprintf("Rmkdir{tag:%d qid:%v}", mr.Tag, mr.Qid)
+}
@@ -0,0 +1,138 @@
+package qp
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestMessageTypeString(t *testing.T) {
+	tests := []struct {
+		mt   MessageType
+		name string
+	}{
+		{Tversion, "Tversion"},
+		{Rread, "Rread"},
+		{Rerror, "Rerror"},
+		{Tsession, "Tsession"},
+		{Rgetattr, "Rgetattr"},
+		{MessageType(255), "MessageType(255)"},
+	}
+
+	for i, tt := range tests {
+		if s := tt.mt.String(); s != tt.name {
+			t.Errorf("test %d: got %q, expected %q", i, s, tt.name)
+		}
+	}
+}
+
+func TestMessageString(t *testing.T) {
+	tests := []struct {
+		m Message
+		s string
+	}{
+		{
+			&WalkRequest{Tag: 3, Fid: 1, NewFid: 2, Names: []string{"usr", "local"}},
+			"Twalk{tag:3 fid:1 newfid:2 wname:[usr local]}",
+		},
+		{
+			&ReadResponse{Tag: 4, Data: []byte("hello")},
+			"Rread{tag:4 count:5}",
+		},
+		{
+			&WriteRequest{Tag: 5, Fid: 6, Offset: 7, Data: []byte("hello")},
+			"Twrite{tag:5 fid:6 offset:7 count:5}",
+		},
+		{
+			&ErrorResponseDotu{Tag: 1, Error: "no such file", Errno: 2},
+			"Rerror{tag:1 ename:no such file errno:2}",
+		},
+	}
+
+	for i, tt := range tests {
+		if s := fmt.Sprintf("%v", tt.m); s != tt.s {
+			t.Errorf("test %d: got %q, expected %q", i, s, tt.s)
+		}
+	}
+}
+
+func TestMessageStringNames(t *testing.T) {
+	tables := []struct {
+		p    Protocol
+		data []MessageTestEntry
+	}{
+		{NineP2000, MessageTestData},
+		{NineP2000Dotu, MessageTestDataDotu},
+		{NineP2000Dote, MessageTestDataDote},
+		{NineP2000Dotl, MessageTestDataDotl},
+	}
+
+	for _, table := range tables {
+		for i, tt := range table.data {
+			mt, err := table.p.MessageType(tt.input)
+			if err != nil {
+				t.Fatalf("test %d: could not get message type: %v", i, err)
+			}
+			st, ok := tt.input.(fmt.Stringer)
+			if !ok {
+				t.Errorf("test %d: %T does not implement fmt.Stringer", i, tt.input)
+				continue
+			}
+			if s := st.String(); !strings.HasPrefix(s, mt.String()+"{") {
+				t.Errorf("test %d: %q does not start with %s", i, s, mt)
+			}
+		}
+	}
+}
+
+func TestQidString(t *testing.T) {
+	tests := []struct {
+		q Qid
+		s string
+	}{
+		{Qid{Type: QTFILE, Version: 3, Path: 0x1234}, "(1234.3 f)"},
+		{Qid{Type: QTDIR, Version: 0, Path: 1}, "(1.0 d)"},
+		{Qid{Type: QTDIR | QTAPPEND | QTTMP, Version: 7, Path: 0xff}, "(ff.7 dat)"},
+	}
+
+	for i, tt := range tests {
+		if s := tt.q.String(); s != tt.s {
+			t.Errorf("test %d: got %q, expected %q", i, s, tt.s)
+		}
+	}
+}
+
+func TestFidText(t *testing.T) {
+	for _, f := range []Fid{0, 42, NOFID - 1, NOFID} {
+		b, err := json.Marshal(f)
+		if err != nil {
+			t.Fatalf("%d: marshal failed: %v", f, err)
+		}
+		var got Fid
+		if err := json.Unmarshal(b, &got); err != nil {
+			t.Fatalf("%s: unmarshal failed: %v", b, err)
+		}
+		if got != f {
+			t.Errorf("%s: got %d, expected %d", b, got, f)
+		}
+	}
+
+	b, err := json.Marshal(&WalkRequest{Tag: 1, Fid: 2, NewFid: NOFID})
+	if err != nil {
+		t.Fatalf("marshal failed: %v", err)
+	}
+	if expected := `{"Tag":1,"Fid":"2","NewFid":"NOFID","Names":null}`; string(b) != expected {
+		t.Errorf("got %s, expected %s", b, expected)
+	}
+	if s := fmt.Sprintf("%s %v", Fid(7), NOFID); s != "7 NOFID" {
+		t.Errorf("got %q, expected %q", s, "7 NOFID")
+	}
+
+	var f Fid
+	for _, s := range []string{`"-1"`, `"4294967296"`, `"nofid"`, `""`} {
+		if err := json.Unmarshal([]byte(s), &f); err == nil {
+			t.Errorf("%s: unmarshal succeeded with %d", s, f)
+		}
+	}
+}
@@ -0,0 +1,42 @@
+package qp
+
+import "time"
+
+// WithReadTimeout returns a MessageReader that reads from r with a deadline of
+// d for each message. The deadline is set through setter, typically the
+// SetReadDeadline method of the connection underlying r, before each read, and
+// cleared after it. Errors are passed through unchanged, so a timeout between
+// messages can be detected with os.IsTimeout. Decoders wrap errors occurring
+// in the middle of a message, but errors.Is(err, os.ErrDeadlineExceeded)
+// detects timeouts in both cases. A read timing out may leave part of a
+// message consumed, so the connection should be dropped afterwards.
+// For example, a server dropping clients silent for a minute:
+//
+//	rw := struct {
+//		MessageReader
+//		MessageWriter
+//	}{
+//		WithReadTimeout(NewDecoder(p, conn), time.Minute, conn.SetReadDeadline),
+//		NewEncoder(p, conn),
+//	}
+//	err := s.ServeConn(rw)
+func WithReadTimeout(r MessageReader, d time.Duration, setter func(time.Time) error) MessageReader {
+	return &timeoutReader{r: r, d: d, setter: setter}
+}
+
+type timeoutReader struct {
+	r      MessageReader
+	d      time.Duration
+	setter func(time.Time) error
+}
+
+func (tr *timeoutReader) ReadMessage() (Message, error) {
+	if err := tr.setter(time.Now().Add(tr.d)); err != nil {
+		return nil, err
+	}
+	m, err := tr.r.ReadMessage()
+	if cerr := tr.setter(time.Time{}); err == nil {
+		err = cerr
+	}
+	return m, err
+}
@@ -0,0 +1,37 @@
+package qp
+
+import (
+	"errors"
+	"net"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestWithReadTimeout(t *testing.T) {
+	a, b := net.Pipe()
+	defer a.Close()
+	defer b.Close()
+
+	r := WithReadTimeout(NewDecoder(NineP2000, b), 50*time.Millisecond, b.SetReadDeadline)
+
+	go NewEncoder(NineP2000, a).WriteMessage(&ClunkRequest{Tag: 1, Fid: 2})
+	m, err := r.ReadMessage()
+	if err != nil {
+		t.Fatalf("read failed: %v", err)
+	}
+	if !MessagesEqual(m, &ClunkRequest{Tag: 1, Fid: 2}) {
+		t.Errorf("got %v, expected Tclunk", m)
+	}
+
+	// An idle client times out.
+	if _, err := r.ReadMessage(); !os.IsTimeout(err) {
+		t.Errorf("idle: expected timeout, got %v", err)
+	}
+
+	// As does a client going silent mid-message.
+	go a.Write([]byte{11, 0, 0, 0})
+	if _, err := r.ReadMessage(); !errors.Is(err, os.ErrDeadlineExceeded) {
+		t.Errorf("mid-message: expected %v, got %v", os.ErrDeadlineExceeded, err)
+	}
+}
@@ -0,0 +1,55 @@
+package qp
+
+// Trace directions passed to the log function of the tracing wrappers.
+const (
+	TraceRead  = "<-"
+	TraceWrite = "->"
+)
+
+// TraceReader returns a MessageReader that calls log with TraceRead and every
+// message successfully read from r. Messages and errors are passed through
+// unchanged.
+func TraceReader(r MessageReader, log func(dir string, m Message)) MessageReader {
+	return &traceReader{r: r, log: log}
+}
+
+// TraceWriter returns a MessageWriter that calls log with TraceWrite and every
+// message successfully written to w. Errors are passed through unchanged.
+func TraceWriter(w MessageWriter, log func(dir string, m Message)) MessageWriter {
+	return &traceWriter{w: w, log: log}
+}
+
+// Trace returns a MessageReadWriter that traces both directions of rw, as done
+// by TraceReader and TraceWriter.
+func Trace(rw MessageReadWriter, log func(dir string, m Message)) MessageReadWriter {
+	return struct {
+		MessageReader
+		MessageWriter
+	}{TraceReader(rw, log), TraceWriter(rw, log)}
+}
+
+type traceReader struct {
+	r   MessageReader
+	log func(string, Message)
+}
+
+func (tr *traceReader) ReadMessage() (Message, error) {
+	m, err := tr.r.ReadMessage()
+	if err == nil {
+		tr.log(TraceRead, m)
+	}
+	return m, err
+}
+
+type traceWriter struct {
+	w   MessageWriter
+	log func(string, Message)
+}
+
+func (tw *traceWriter) WriteMessage(m Message) error {
+	err := tw.w.WriteMessage(m)
+	if err == nil {
+		tw.log(TraceWrite, m)
+	}
+	return err
+}
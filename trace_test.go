@@ -0,0 +1,49 @@
+package qp
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+)
+
+// Test if the types live up to their interface
+var (
+	_ MessageReader     = (*Decoder)(nil)
+	_ MessageWriter     = (*Encoder)(nil)
+	_ MessageReadWriter = (*Conn)(nil)
+)
+
+func TestTrace(t *testing.T) {
+	var log []string
+	logf := func(dir string, m Message) {
+		log = append(log, fmt.Sprintf("%s %v", dir, m))
+	}
+
+	buf := new(bytes.Buffer)
+	w := TraceWriter(NewEncoder(NineP2000, buf), logf)
+	r := TraceReader(NewDecoder(NineP2000, buf), logf)
+
+	m := &WalkRequest{Tag: 3, Fid: 1, NewFid: 2, Names: []string{"usr", "local"}}
+	if err := w.WriteMessage(m); err != nil {
+		t.Fatalf("write failed: %v", err)
+	}
+	if !bytes.Equal(buf.Bytes(), []byte{0x1d, 0x0, 0x0, 0x0, byte(Twalk), 0x3, 0x0, 0x1, 0x0, 0x0, 0x0, 0x2, 0x0, 0x0, 0x0, 0x2, 0x0, 0x3, 0x0, 0x75, 0x73, 0x72, 0x5, 0x0, 0x6c, 0x6f, 0x63, 0x61, 0x6c}) {
+		t.Errorf("traced write altered output: %#v", buf.Bytes())
+	}
+	if _, err := r.ReadMessage(); err != nil {
+		t.Fatalf("read failed: %v", err)
+	}
+
+	// Errors are passed through, and not logged.
+	if _, err := r.ReadMessage(); err == nil {
+		t.Errorf("expected error reading empty buffer")
+	}
+
+	expected := []string{
+		"-> Twalk{tag:3 fid:1 newfid:2 wname:[usr local]}",
+		"<- Twalk{tag:3 fid:1 newfid:2 wname:[usr local]}",
+	}
+	if fmt.Sprint(log) != fmt.Sprint(expected) {
+		t.Errorf("got log %q, expected %q", log, expected)
+	}
+}
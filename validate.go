@@ -0,0 +1,141 @@
+package qp
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"reflect"
+	"strconv"
+	"unicode/utf8"
+)
+
+var (
+	// ErrInvalidTag indicates that a request carries a tag it may not use:
+	// Tversion must be tagged NOTAG, and other requests must not be.
+	ErrInvalidTag = errors.New("invalid tag")
+
+	// ErrInvalidFid indicates that a request uses NOFID where a fid is
+	// required.
+	ErrInvalidFid = errors.New("invalid fid")
+
+	// ErrInvalidRange indicates that the offset and count of a read or write
+	// request address bytes beyond the largest 64-bit offset.
+	ErrInvalidRange = errors.New("invalid offset range")
+
+	// ErrInvalidUTF8 indicates that a string field does not hold valid UTF-8.
+	ErrInvalidUTF8 = errors.New("invalid UTF-8")
+)
+
+// ValidateMessage checks that the special values NOTAG and NOFID are only used
+// where the protocol permits them. NOTAG is reserved for Tversion, which must
+// carry it, and NOFID may only stand in for a missing authentication fid.
+// Reads and writes must not extend past the largest 64-bit offset. Messages
+// other than 9P2000 requests are not checked.
+func ValidateMessage(m Message) error {
+	switch r := m.(type) {
+	case *VersionRequest:
+		if r.Tag != NOTAG {
+			return ErrInvalidTag
+		}
+		return nil
+	case *AuthRequest:
+		return validateFids(r.Tag, r.AuthFid)
+	case *AttachRequest:
+		return validateFids(r.Tag, r.Fid)
+	case *FlushRequest:
+		return validateFids(r.Tag)
+	case *WalkRequest:
+		return validateFids(r.Tag, r.Fid, r.NewFid)
+	case *OpenRequest:
+		return validateFids(r.Tag, r.Fid)
+	case *CreateRequest:
+		return validateFids(r.Tag, r.Fid)
+	case *ReadRequest:
+		if err := validateFids(r.Tag, r.Fid); err != nil {
+			return err
+		}
+		return validateRange(r.Offset, uint64(r.Count))
+	case *WriteRequest:
+		if err := validateFids(r.Tag, r.Fid); err != nil {
+			return err
+		}
+		return validateRange(r.Offset, uint64(len(r.Data)))
+	case *ClunkRequest:
+		return validateFids(r.Tag, r.Fid)
+	case *RemoveRequest:
+		return validateFids(r.Tag, r.Fid)
+	case *StatRequest:
+		return validateFids(r.Tag, r.Fid)
+	case *WriteStatRequest:
+		return validateFids(r.Tag, r.Fid)
+	}
+	return nil
+}
+
+// validateFids checks that a request other than Tversion is not tagged NOTAG,
+// and that none of its required fids are NOFID.
+func validateFids(t Tag, fids ...Fid) error {
+	if t == NOTAG {
+		return ErrInvalidTag
+	}
+	for _, f := range fids {
+		if f == NOFID {
+			return ErrInvalidFid
+		}
+	}
+	return nil
+}
+
+// validateRange checks that count bytes from offset do not overflow.
+func validateRange(offset, count uint64) error {
+	if count > math.MaxUint64-offset {
+		return ErrInvalidRange
+	}
+	return nil
+}
+
+// validateUTF8 checks that every string field of m, including those of nested
+// structs and slices, holds valid UTF-8. The error names the offending field.
+func validateUTF8(m Message) error {
+	v := reflect.ValueOf(m)
+	if v.Kind() == reflect.Ptr {
+		v = v.Elem()
+	}
+	if field := invalidUTF8(v, ""); field != "" {
+		return fmt.Errorf("%s: %w", field, ErrInvalidUTF8)
+	}
+	return nil
+}
+
+// invalidUTF8 returns the path of the first string in v not holding valid
+// UTF-8, prefixed by path, or "" if all are valid.
+func invalidUTF8(v reflect.Value, path string) string {
+	switch v.Kind() {
+	case reflect.String:
+		if !utf8.ValidString(v.String()) {
+			return path
+		}
+	case reflect.Struct:
+		t := v.Type()
+		for i := 0; i < v.NumField(); i++ {
+			name := t.Field(i).Name
+			if path != "" {
+				name = path + "." + name
+			}
+			if field := invalidUTF8(v.Field(i), name); field != "" {
+				return field
+			}
+		}
+	case reflect.Slice:
+		if v.Type().Elem().Kind() == reflect.Uint8 {
+			// Data, not a string.
+			return ""
+		}
+		for i := 0; i < v.Len(); i++ {
+			if field := invalidUTF8(v.Index(i), path+"["+strconv.Itoa(i)+"]"); field != "" {
+				return field
+			}
+		}
+	}
+	return ""
+}
@@ -0,0 +1,83 @@
+package qp
+
+import (
+	"bytes"
+	"errors"
+	"math"
+	"strings"
+	"testing"
+)
+
+func TestValidateMessage(t *testing.T) {
+	tests := []struct {
+		m   Message
+		err error
+	}{
+		{&VersionRequest{Tag: NOTAG}, nil},
+		{&VersionRequest{Tag: 0}, ErrInvalidTag},
+		{&AttachRequest{Tag: 1, Fid: 2, AuthFid: NOFID}, nil},
+		{&AttachRequest{Tag: 1, Fid: NOFID, AuthFid: NOFID}, ErrInvalidFid},
+		{&AttachRequest{Tag: NOTAG, Fid: 2, AuthFid: NOFID}, ErrInvalidTag},
+		{&AuthRequest{Tag: 1, AuthFid: NOFID}, ErrInvalidFid},
+		{&WalkRequest{Tag: 1, Fid: 1, NewFid: NOFID}, ErrInvalidFid},
+		{&WalkRequest{Tag: 1, Fid: 1, NewFid: 1}, nil},
+		{&ClunkRequest{Tag: NOTAG, Fid: 1}, ErrInvalidTag},
+		{&FlushRequest{Tag: 1, OldTag: NOTAG}, nil},
+		{&ReadRequest{Tag: 1, Fid: 1, Offset: math.MaxUint64 - 10, Count: 10}, nil},
+		{&ReadRequest{Tag: 1, Fid: 1, Offset: math.MaxUint64 - 10, Count: 11}, ErrInvalidRange},
+		{&ReadRequest{Tag: 1, Fid: 1, Offset: math.MaxUint64, Count: 0}, nil},
+		{&WriteRequest{Tag: 1, Fid: 1, Offset: math.MaxUint64 - 1, Data: []byte{1}}, nil},
+		{&WriteRequest{Tag: 1, Fid: 1, Offset: math.MaxUint64 - 1, Data: []byte{1, 2}}, ErrInvalidRange},
+
+		// Responses are not checked.
+		{&VersionResponse{Tag: 0}, nil},
+		{&ReadResponse{Tag: NOTAG}, nil},
+	}
+
+	for i, tt := range tests {
+		if err := ValidateMessage(tt.m); err != tt.err {
+			t.Errorf("test %d: %v: expected %v, got %v", i, tt.m, tt.err, err)
+		}
+	}
+}
+
+func TestValidateUTF8(t *testing.T) {
+	latin1 := "caf\xe9"
+	tests := []struct {
+		m     Message
+		field string
+	}{
+		{&CreateRequest{Tag: 1, Fid: 2, Name: latin1}, "Name"},
+		{&WalkRequest{Tag: 1, Fid: 2, NewFid: 3, Names: []string{"usr", latin1}}, "Names[1]"},
+		{&WriteStatRequest{Tag: 1, Fid: 2, Stat: Stat{Name: "x", UID: latin1}}, "Stat.UID"},
+	}
+	for _, tt := range tests {
+		var buf bytes.Buffer
+		e := NewEncoder(NineP2000, &buf)
+		e.ValidateUTF8 = true
+		err := e.WriteMessage(tt.m)
+		if !errors.Is(err, ErrInvalidUTF8) || !strings.HasPrefix(err.Error(), tt.field+":") {
+			t.Errorf("%T: encode: expected %v naming %s, got %v", tt.m, ErrInvalidUTF8, tt.field, err)
+		}
+		if buf.Len() != 0 {
+			t.Errorf("%T: encode: %d bytes written despite error", tt.m, buf.Len())
+		}
+
+		// Validation is off by default.
+		if err := Encode(&buf, tt.m); err != nil {
+			t.Fatalf("%T: encode without validation failed: %v", tt.m, err)
+		}
+		d := NewDecoder(NineP2000, bytes.NewReader(buf.Bytes()))
+		d.ValidateUTF8 = true
+		if _, err := d.ReadMessage(); !errors.Is(err, ErrInvalidUTF8) {
+			t.Errorf("%T: decode: expected %v, got %v", tt.m, ErrInvalidUTF8, err)
+		}
+	}
+
+	var buf bytes.Buffer
+	e := NewEncoder(NineP2000, &buf)
+	e.ValidateUTF8 = true
+	if err := e.WriteMessage(&CreateRequest{Tag: 1, Fid: 2, Name: "café"}); err != nil {
+		t.Errorf("valid UTF-8 rejected: %v", err)
+	}
+}
@@ -0,0 +1,17 @@
+package qp
+
+// SplitWalk splits a path into groups of at most MAXWELEM elements, each
+// suitable for a single walk request. An empty path yields a single empty
+// group, which walks to the same file, cloning the fid.
+func SplitWalk(names []string) [][]string {
+	if len(names) == 0 {
+		return [][]string{nil}
+	}
+
+	groups := make([][]string, 0, (len(names)+MAXWELEM-1)/MAXWELEM)
+	for len(names) > MAXWELEM {
+		groups = append(groups, names[:MAXWELEM:MAXWELEM])
+		names = names[MAXWELEM:]
+	}
+	return append(groups, names)
+}
@@ -0,0 +1,45 @@
+package qp
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestSplitWalk(t *testing.T) {
+	path := make([]string, 40)
+	for i := range path {
+		path[i] = fmt.Sprintf("d%d", i)
+	}
+
+	tests := []struct {
+		n     int
+		sizes []int
+	}{
+		{0, []int{0}},
+		{1, []int{1}},
+		{MAXWELEM, []int{MAXWELEM}},
+		{MAXWELEM + 1, []int{MAXWELEM, 1}},
+		{40, []int{MAXWELEM, MAXWELEM, 8}},
+	}
+
+	for i, tt := range tests {
+		groups := SplitWalk(path[:tt.n])
+		if len(groups) != len(tt.sizes) {
+			t.Errorf("test %d: got %d groups, expected %d", i, len(groups), len(tt.sizes))
+			continue
+		}
+
+		var joined []string
+		for j, g := range groups {
+			if len(g) != tt.sizes[j] {
+				t.Errorf("test %d: group %d has %d elements, expected %d", i, j, len(g), tt.sizes[j])
+			}
+			joined = append(joined, g...)
+		}
+		for j := range joined {
+			if joined[j] != path[j] {
+				t.Errorf("test %d: element %d is %s, expected %s", i, j, joined[j], path[j])
+			}
+		}
+	}
+}